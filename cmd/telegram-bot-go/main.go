@@ -1,10 +1,20 @@
 package main
 
 import (
+	"fmt"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/bot"
+	"os"
 )
 
-// Main starts execution
+// Main starts execution. The migrate subcommand manages the database migrations instead of starting the bot.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := bot.Migrate(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	_ = bot.Start()
 }
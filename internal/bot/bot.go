@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/handlers"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/leader"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/notificator"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/config"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/logger"
-	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/mongodb"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/bolt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/memory"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -55,41 +59,83 @@ func Start() error {
 
 	log.Info("connecting database...")
 
-	db, err := mongodb.New(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, closeDB, err := openDatabase(ctx, cfg, log)
 	if err != nil {
-		log.ErrorF("an error occurred on connection to mongo: %v", err)
-		panic(fmt.Sprintf("failed to load config: %s", err.Error()))
+		log.Error(err.Error())
 		return err
 	}
+	defer closeDB()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if err = migrateDatabase(db, cfg.Database.MigrationsDryRun, log); err != nil {
+		log.ErrorF("failed to migrate database: %v", err)
+		return err
+	}
 
-	errInit := db.Init(ctx)
+	if err = seedConference(db, cfg.Conference); err != nil {
+		log.ErrorF("failed to store the default conference: %v", err)
+		return err
+	}
 
-	if errInit != nil {
-		log.ErrorF("failed to init user with unique field tgID: %v", errInit)
+	if err = seedOwners(db, cfg.Administrators.IDs); err != nil {
+		log.ErrorF("failed to grant the owner role to the admins: %v", err)
+		return err
 	}
 
-	defer func() {
-		if errC := db.Close(); errC != nil {
-			log.WarnF("failed to close connection to mongo: %v", errC)
+	log.Info("database was connected successfully")
+
+	queue := sender.New(bot, db)
+	queue.Start(ctx)
+
+	var rdb redis.Store
+
+	switch cfg.Cache.Backend {
+	case config.CacheMemory:
+		log.Warn("user states are kept in memory and will be lost on restart")
+		rdb = memory.New()
+	case config.CacheBolt:
+		boltDB, errB := bolt.New(cfg.Cache.BoltPath)
+		if errB != nil {
+			log.ErrorF("failed to open bolt cache: %v", errB)
+			return errB
 		}
-	}()
 
-	log.Info("database was connected successfully")
+		defer func() {
+			if errC := boltDB.Close(); errC != nil {
+				log.WarnF("failed to close bolt cache: %v", errC)
+			}
+		}()
+
+		rdb = boltDB
+	default:
+		rdb = redis.New(cfg.Redis.Host, cfg.Redis.Port)
+	}
+
+	var clk clock.Clock = clock.Real{}
+
+	if cfg.Simulation {
+		log.Warn("time simulation is enabled, do not use it in production")
+		clk = &clock.Simulated{}
+	}
 
 	client := handlers.Client{
-		FSM:           fsm.New(redis.New(cfg.Redis.Host, cfg.Redis.Port), ctx),
+		FSM:           fsm.New(rdb, ctx, handlers.StateTTLs(cfg.StateTTL, cfg.LongStateTTL)),
 		Cfg:           cfg,
 		Database:      db,
+		Sender:        queue,
+		Clock:         clk,
 		NotifiedUsers: make(map[string]bool, 100),
 	}
 
 	handlers.Set(dispatcher, &client)
 
 	updater := ext.NewUpdater(dispatcher, nil)
-	not := notificator.Notificator{NotifiedUsers: make(map[string]bool, 100), Database: db, Cfg: cfg}
+	elector := leader.New(rdb, "notificator-leader")
+	go elector.Run(ctx)
+
+	not := notificator.Notificator{NotifiedUsers: make(map[string]bool, 100), Database: db, Cfg: cfg, Sender: queue, Leader: elector, Clock: clk, Marks: rdb}
 
 	log.Info("start polling")
 
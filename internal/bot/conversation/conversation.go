@@ -0,0 +1,294 @@
+// Package conversation provides a conversation engine on top of the finite state machine.
+// A conversation is a set of steps, each step declares its prompt, keyboard, validator and next step.
+// The engine keeps a navigation stack of the user in the state, so a generic back button works on every step.
+package conversation
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"strings"
+)
+
+const (
+	// ChoicePrefix is the prefix of the callback data of the choices on a step.
+	ChoicePrefix = "step;"
+	// Back is the callback data of the generic back button.
+	Back = "stepBack"
+)
+
+// Step is a step of a conversation with the payload of type T.
+type Step[T any] struct {
+	// Prompt returns the text of the step.
+	Prompt func(data *T) string
+	// Keyboard returns the rows of the keyboard of the step. The back button is appended by the engine. It is optional.
+	Keyboard func(data *T) [][]gotgbot.InlineKeyboardButton
+	// Text reports whether the step accepts text messages as input, otherwise only choices are accepted.
+	Text bool
+	// Message stores a message of any kind in the payload, e.g. a photo with a caption, the error text is shown to the user.
+	// A step with Message accepts every message instead of Validate and Save. It is optional.
+	Message func(data *T, msg *gotgbot.Message) error
+	// Validate checks the input, the error text is shown to the user. It is optional.
+	Validate func(data *T, input string) error
+	// Save stores the input in the payload. It is optional.
+	Save func(data *T, input string)
+	// Next returns the name of the next step, the conversation is finished if it is empty. It is optional.
+	// A step that returns its own name is shown again in place, e.g. to toggle the options of a multiple choice.
+	Next func(data *T, input string) string
+	// Show shows the prompt with the keyboard instead of Reply, e.g. to send a preview before it. It is optional.
+	Show func(bot *gotgbot.Bot, ctx *ext.Context, data *T, text string, kb gotgbot.InlineKeyboardMarkup) error
+}
+
+// Conversation is a set of steps with the payload of type T.
+// The name of the conversation is the name of the state of the users taking part in it.
+type Conversation[T any] struct {
+	Name  string             // Name is the name of the conversation.
+	First string             // First is the name of the first step.
+	Steps map[string]Step[T] // Steps are the steps of the conversation by their names.
+	// Allow reports whether the user may take part in the conversation, e.g. has the permission of the staff flow.
+	// The input and the back button of the other users are dropped. It is optional.
+	Allow func(tgID int64) bool
+	// Done is called when the conversation is finished. It should reply to the user.
+	Done func(bot *gotgbot.Bot, ctx *ext.Context, data *T) error
+
+	fsm fsm.StateController
+}
+
+// flow is a registered conversation regardless of its payload type.
+type flow interface {
+	handle(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State, input string, text bool) error
+	back(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error
+}
+
+// Engine routes choices, text messages and the back button to the registered conversations.
+type Engine struct {
+	fsm   fsm.StateController
+	flows map[string]flow
+}
+
+// New creates an engine that keeps the conversations in the given state controller.
+func New(controller fsm.StateController) *Engine {
+	return &Engine{fsm: controller, flows: make(map[string]flow)}
+}
+
+// Register adds the conversation to the engine and returns it.
+func Register[T any](e *Engine, c *Conversation[T]) *Conversation[T] {
+	c.fsm = e.fsm
+	e.flows[c.Name] = c
+	return c
+}
+
+// Choice returns a keyboard button which passes the input to the current step.
+func Choice(text, input string) gotgbot.InlineKeyboardButton {
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: ChoicePrefix + input}
+}
+
+// Owns reports whether the state name is the name of a registered conversation.
+func (e *Engine) Owns(name string) bool {
+	_, exists := e.flows[name]
+	return exists
+}
+
+// Active reports whether the state belongs to an unfinished conversation.
+func (e *Engine) Active(state fsm.State) bool {
+	_, exists := e.flows[state.Name]
+	return exists && len(state.Stack) != 0
+}
+
+// ChoiceCBHandler passes the choice of the user to the current step of the conversation.
+func (e *Engine) ChoiceCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	state, err := e.fsm.GetState(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	if !e.Active(state) {
+		return expired(bot, ctx)
+	}
+
+	return e.flows[state.Name].handle(bot, ctx, state, strings.TrimPrefix(ctx.CallbackQuery.Data, ChoicePrefix), false)
+}
+
+// BackCBHandler returns the user to the previous step of the conversation.
+func (e *Engine) BackCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	state, err := e.fsm.GetState(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	if !e.Active(state) {
+		return expired(bot, ctx)
+	}
+
+	return e.flows[state.Name].back(bot, ctx, state)
+}
+
+// MessageHandler passes the message of the user to the current step of the conversation.
+// The state should be active.
+func (e *Engine) MessageHandler(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error {
+	return e.flows[state.Name].handle(bot, ctx, state, ctx.EffectiveMessage.Text, true)
+}
+
+// Start starts the conversation for the user with the given payload and shows the first step.
+func (c *Conversation[T]) Start(bot *gotgbot.Bot, ctx *ext.Context, data T) error {
+	return c.show(bot, ctx, []string{c.First}, &data)
+}
+
+func (c *Conversation[T]) handle(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State, input string, text bool) error {
+	if c.Allow != nil && !c.Allow(ctx.EffectiveUser.Id) {
+		return denied(bot, ctx)
+	}
+
+	step, exists := c.Steps[state.Stack[len(state.Stack)-1]]
+	if !exists {
+		return expired(bot, ctx)
+	}
+
+	message := text && step.Message != nil
+
+	if text && !message && (!step.Text || input == "") {
+		_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+		return err
+	}
+
+	var data T
+
+	if err := state.Decode(&data); err != nil {
+		return err
+	}
+
+	if message {
+		if err := step.Message(&data, ctx.EffectiveMessage); err != nil {
+			return reject(bot, ctx, err.Error())
+		}
+	}
+
+	if step.Validate != nil && !message {
+		if err := step.Validate(&data, input); err != nil {
+			return reject(bot, ctx, err.Error())
+		}
+	}
+
+	if step.Save != nil && !message {
+		step.Save(&data, input)
+	}
+
+	var next string
+	if step.Next != nil {
+		next = step.Next(&data, input)
+	}
+
+	if next == "" {
+		finished, err := fsm.NewState(c.Name, data)
+		if err != nil {
+			return err
+		}
+
+		if err = c.fsm.SetState(ctx.EffectiveUser.Id, finished); err != nil {
+			return err
+		}
+
+		return c.Done(bot, ctx, &data)
+	}
+
+	stack := state.Stack
+	if next != stack[len(stack)-1] {
+		stack = append(stack, next)
+	}
+
+	return c.show(bot, ctx, stack, &data)
+}
+
+func (c *Conversation[T]) back(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error {
+	if c.Allow != nil && !c.Allow(ctx.EffectiveUser.Id) {
+		return denied(bot, ctx)
+	}
+
+	if len(state.Stack) < 2 {
+		return expired(bot, ctx)
+	}
+
+	var data T
+
+	if err := state.Decode(&data); err != nil {
+		return err
+	}
+
+	return c.show(bot, ctx, state.Stack[:len(state.Stack)-1], &data)
+}
+
+// show saves the navigation stack and the payload in the state and shows the last step of the stack.
+func (c *Conversation[T]) show(bot *gotgbot.Bot, ctx *ext.Context, stack []string, data *T) error {
+	step := c.Steps[stack[len(stack)-1]]
+
+	state, err := fsm.NewState(c.Name, data)
+	if err != nil {
+		return err
+	}
+
+	state.Stack = stack
+
+	if err = c.fsm.SetState(ctx.EffectiveUser.Id, state); err != nil {
+		return err
+	}
+
+	var kb [][]gotgbot.InlineKeyboardButton
+	if step.Keyboard != nil {
+		kb = step.Keyboard(data)
+	}
+
+	if len(stack) > 1 {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "⬅️ Назад", CallbackData: Back}})
+	}
+
+	if step.Show != nil {
+		return step.Show(bot, ctx, data, step.Prompt(data), gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb})
+	}
+
+	return Reply(bot, ctx, step.Prompt(data), gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb})
+}
+
+// Reply edits the message with the pressed button or sends a new message if the user wrote a text.
+func Reply(bot *gotgbot.Bot, ctx *ext.Context, text string, kb gotgbot.InlineKeyboardMarkup) error {
+	if cb := ctx.CallbackQuery; cb != nil {
+		_, _, err := cb.Message.EditText(bot, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: kb})
+		return err
+	}
+
+	_, err := bot.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{ReplyMarkup: kb})
+
+	return err
+}
+
+// reject tells the user why the input doesn't fit the step.
+func reject(bot *gotgbot.Bot, ctx *ext.Context, reason string) error {
+	if cb := ctx.CallbackQuery; cb != nil {
+		_, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: reason})
+		return err
+	}
+
+	_, err := bot.SendMessage(ctx.EffectiveChat.Id, reason, nil)
+
+	return err
+}
+
+// denied answers the button press of a user who may not take part in the conversation, their message is deleted.
+func denied(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if cb := ctx.CallbackQuery; cb != nil {
+		_, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Недостаточно прав"})
+		return err
+	}
+
+	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+
+	return err
+}
+
+// expired tells the user that the pressed button belongs to a finished conversation.
+func expired(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if cb := ctx.CallbackQuery; cb != nil {
+		_, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Это действие уже недоступно"})
+		return err
+	}
+	return nil
+}
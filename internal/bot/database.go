@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/config"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/logger"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/memory"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/migrate"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/mongodb"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/sqldb"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// openDatabase connects the database of the configured backend. The returned function closes the connection.
+func openDatabase(ctx context.Context, cfg *config.Config, log *logger.Slog) (storage.Repository, func(), error) {
+	switch cfg.Database.Backend {
+	case config.DatabaseMemory:
+		log.Warn("data is kept in memory and will be lost on restart, do not use it in production")
+		return memory.NewRepository(), func() {}, nil
+	case config.DatabaseSQLite, config.DatabasePostgres:
+		sdb, err := sqldb.New(cfg.Database.Backend, cfg.Database.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("an error occurred on connection to %s: %w", cfg.Database.Backend, err)
+		}
+
+		return sdb, func() {
+			if errC := sdb.Close(); errC != nil {
+				log.WarnF("failed to close connection to %s: %v", cfg.Database.Backend, errC)
+			}
+		}, nil
+	default:
+		mdb, err := mongodb.New(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("an error occurred on connection to mongo: %w", err)
+		}
+
+		if err = mdb.Init(ctx); err != nil {
+			return nil, nil, err
+		}
+
+		return mdb, func() {
+			if errC := mdb.Close(); errC != nil {
+				log.WarnF("failed to close connection to mongo: %v", errC)
+			}
+		}, nil
+	}
+}
+
+// migrateDatabase applies the pending migrations of the database on start.
+// In dry-run mode it only logs them and fails if there are any, since the bot can't run on an outdated schema.
+func migrateDatabase(db storage.Repository, dryRun bool, log *logger.Slog) error {
+	m, ok := db.(migrate.Migrator)
+	if !ok {
+		return nil
+	}
+
+	pending, err := migrate.Up(m, dryRun)
+
+	for _, migration := range pending {
+		if dryRun {
+			log.InfoF("migration %d (%s) would be applied", migration.Version, migration.Name)
+		} else {
+			log.InfoF("migration %d (%s) applied", migration.Version, migration.Name)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if dryRun && len(pending) != 0 {
+		return fmt.Errorf("%d pending migrations were not applied in dry-run mode", len(pending))
+	}
+
+	return nil
+}
+
+// seedConference stores the conference given by the environment as the default one.
+// The creator of an already stored default conference is kept, the rest is taken from the environment.
+func seedConference(db storage.Repository, conf config.Conference) error {
+	if conf.Name == "" {
+		return nil
+	}
+
+	conference := models.Conference{
+		ID:                   models.DefaultConferenceID,
+		Name:                 conf.Name,
+		URL:                  conf.URL,
+		TimeFrom:             time.Time(conf.TimeFrom),
+		TimeUntil:            time.Time(conf.TimeUntil),
+		TimeReviewsAvailable: time.Time(conf.TimeReviewsAvailable),
+	}
+
+	stored, err := db.SelectConference(models.DefaultConferenceID)
+	switch {
+	case err == nil:
+		conference.CreatedBy = stored.CreatedBy
+	case !errors.Is(err, storage.ErrNotFound):
+		return err
+	}
+
+	return db.SaveConference(conference)
+}
+
+// seedOwners grants the owner role to the admins given by the environment, so the bot always has someone to grant the other roles.
+func seedOwners(db storage.Repository, ids []int) error {
+	for _, id := range ids {
+		owner := models.UserRole{TgID: id, Role: models.RoleOwner, GrantedAt: time.Now().UTC()}
+		if _, err := db.GrantRole(owner); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Migrate runs the migrate subcommand with its arguments:
+//
+//	migrate status           shows the applied and pending migrations
+//	migrate up [-dry-run]    applies the pending migrations or only lists them
+func Migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate status | migrate up [-dry-run]")
+	}
+
+	log := logger.New(logger.DebugLevel)
+
+	cfg, err := config.New()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, closeDB, err := openDatabase(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	m, ok := db.(migrate.Migrator)
+	if !ok {
+		return fmt.Errorf("the %s backend has no migrations", cfg.Database.Backend)
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, errS := migrate.Statuses(m)
+		if errS != nil {
+			return errS
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "list the pending migrations without applying them")
+		if err = flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		pending, errU := migrate.Up(m, *dryRun)
+		for _, migration := range pending {
+			if *dryRun {
+				fmt.Printf("would apply %d (%s)\n", migration.Version, migration.Name)
+			} else {
+				fmt.Printf("applied %d (%s)\n", migration.Version, migration.Name)
+			}
+		}
+		if errU != nil {
+			return errU
+		}
+
+		if len(pending) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, usage: migrate status | migrate up [-dry-run]", args[0])
+	}
+}
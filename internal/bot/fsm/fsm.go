@@ -3,54 +3,121 @@ package fsm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
+	"strings"
+	"time"
 )
 
+// expiryGrace is how long the storage keeps a state after its TTL, so the user is told the flow was interrupted
+// the next time they write instead of silently starting over.
+const expiryGrace = 24 * time.Hour
+
+// ErrExpired is returned with a state that was entered longer ago than the TTL of the state.
+var ErrExpired = errors.New("state expired")
+
+// State represents a user state: the name of the state and a typed payload of the conversation.
+type State struct {
+	Name      string          `json:"name"`              // Name is the name of the state.
+	Payload   json.RawMessage `json:"payload,omitempty"` // Payload is the JSON-encoded data of the conversation. It is optional.
+	Stack     []string        `json:"stack,omitempty"`   // Stack is the navigation stack of the conversation, the last step is the current one.
+	EnteredAt time.Time       `json:"enteredAt"`         // EnteredAt is the time the state was set. It is set by the state controller.
+}
+
+// NewState creates a state with the given name and payload.
+// The payload is encoded as JSON, so it should be a JSON-serializable value.
+func NewState(name string, payload interface{}) (State, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return State{}, err
+	}
+	return State{Name: name, Payload: data}, nil
+}
+
+// Decode decodes the payload of the state into v.
+// It leaves v untouched if the state has no payload.
+func (s State) Decode(v interface{}) error {
+	if len(s.Payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(s.Payload, v)
+}
+
 // StateController interface defines the methods for getting and setting user states.
 type StateController interface {
 	// GetState retrieves the current state of a user.
 	// It takes a key representing the user ID.
-	// It returns the current state as a string and an error if any occurred.
-	GetState(key int64) (string, error)
+	// It returns the current state and an error if any occurred. The state name is empty for new users.
+	// The state is returned together with ErrExpired if it has outlived its TTL.
+	GetState(key int64) (State, error)
 
-	// SetState sets the state of a user.
+	// SetState sets the state of a user and records when it was entered.
 	// It takes a key representing the user ID, and the state to be set.
 	// It returns an error if any occurred.
-	SetState(key int64, state string) error
+	SetState(key int64, state State) error
 }
 
 // FSM struct is a finite state machine that uses a Redis cache client for state management.
 // rdb is a Redis cache client used for state management.
 // ctx is the context in which the FSM operates.
+// ttl is the time to live of the states by their names, states without TTL never expire.
 type FSM struct {
 	rdb redis.CacheClient
 	ctx context.Context
+	ttl map[string]time.Duration
 }
 
 // New function creates a new FSM with a given Redis cache client.
-// It takes a Redis cache client and a context and returns a pointer to a new FSM.
-func New(rdb redis.CacheClient, ctx context.Context) *FSM {
-	return &FSM{rdb: rdb, ctx: ctx}
+// It takes a Redis cache client, a context and the TTLs of the states by their names and returns a pointer to a new FSM.
+func New(rdb redis.CacheClient, ctx context.Context, ttl map[string]time.Duration) *FSM {
+	return &FSM{rdb: rdb, ctx: ctx, ttl: ttl}
 }
 
 // GetState method retrieves the current state of a user.
 // It takes a key representing the user ID.
-// It returns the current state as a string and an error if any occurred.
-func (fsm *FSM) GetState(key int64) (string, error) {
-	state, err := fsm.rdb.Get(fsm.ctx, key)
+// It returns the current state and an error if any occurred, ErrExpired if the state has outlived its TTL.
+// States stored as plain strings by older versions are converted, their semicolon-joined data is dropped.
+// Such states have no entry time, so they are expired if their names have a TTL.
+func (fsm *FSM) GetState(key int64) (State, error) {
+	raw, err := fsm.rdb.Get(fsm.ctx, key)
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return state, nil
+			return State{}, nil
 		}
-		return "", err
+		return State{}, err
 	}
+
+	var state State
+
+	if err = json.Unmarshal([]byte(raw), &state); err != nil {
+		name, _, _ := strings.Cut(raw, ";")
+		state = State{Name: name}
+	}
+
+	if ttl, exists := fsm.ttl[state.Name]; exists && time.Since(state.EnteredAt) > ttl {
+		return state, ErrExpired
+	}
+
 	return state, nil
 }
 
 // SetState method sets the state of a user.
 // It takes a key representing the user ID, and the state to be set.
 // It returns an error if any occurred.
-func (fsm *FSM) SetState(key int64, state string) error {
-	return fsm.rdb.Set(fsm.ctx, key, state, 0)
+// States with a TTL are dropped from the storage expiryGrace after they expire, the others are kept until replaced.
+func (fsm *FSM) SetState(key int64, state State) error {
+	state.EnteredAt = time.Now().UTC()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	var expiration time.Duration
+	if ttl, exists := fsm.ttl[state.Name]; exists {
+		expiration = ttl + expiryGrace
+	}
+
+	return fsm.rdb.Set(fsm.ctx, key, string(data), expiration)
 }
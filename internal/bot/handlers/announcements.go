@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"strings"
+	"time"
+)
+
+// announcementLayout is the layout of the send time of an announcement entered by an admin.
+const announcementLayout = "02/01/2006 15:04"
+
+// announcementPayload is the state payload of an admin editing an announcement.
+type announcementPayload struct {
+	ID string `json:"id"` // ID is the ID of the announcement being edited.
+}
+
+// announcementPrompt explains admins the format of an announcement.
+const announcementPrompt = "Отправьте объявление в формате:\n\nДД/ММ/ГГГГ ЧЧ:ММ (время МСК)\nТекст объявления\n\nНапример:\n\n01/06/2024 13:00\nОбед подан в зале B"
+
+func (c *Client) announcementsHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: announcements}); err != nil {
+		return err
+	}
+
+	text, kb, err := c.announcementsList(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{ReplyMarkup: kb})
+
+	return err
+}
+
+func (c *Client) announcementsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	if err := c.FSM.SetState(cb.From.Id, fsm.State{Name: announcements}); err != nil {
+		return err
+	}
+
+	text, kb, err := c.announcementsList(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: kb})
+
+	return err
+}
+
+// announcementsList returns the text and the keyboard of the pending announcements list of the conference the admin picked.
+func (c *Client) announcementsList(tgID int64) (string, gotgbot.InlineKeyboardMarkup, error) {
+
+	conference, err := c.conference(tgID)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	all, err := c.Database.SelectAnnouncements(models.AnnouncementPending)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	var pending []models.Announcement
+	for _, announcement := range all {
+		if announcement.ConferenceID == conference.ID {
+			pending = append(pending, announcement)
+		}
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	text := "Запланированных объявлений нет"
+
+	if len(pending) != 0 {
+		text = "Запланированные объявления:\n\n"
+		for ind, announcement := range pending {
+			text += fmt.Sprintf("%v. 🕒 %s\n%s\n\n", ind+1, announcement.SendAt.In(location).Format("02.01.2006 15:04"), announcement.Text)
+		}
+	}
+
+	return text, announcementsKB(pending), nil
+}
+
+func (c *Client) announceHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: announceCreate}); err != nil {
+		return err
+	}
+
+	_, err := bot.SendMessage(ctx.EffectiveChat.Id, announcementPrompt, &gotgbot.SendMessageOpts{ReplyMarkup: backToAnnouncementsKB()})
+
+	return err
+}
+
+func (c *Client) announceCreateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	if err := c.FSM.SetState(cb.From.Id, fsm.State{Name: announceCreate}); err != nil {
+		return err
+	}
+
+	_, _, err := cb.Message.EditText(bot, announcementPrompt, &gotgbot.EditMessageTextOpts{ReplyMarkup: backToAnnouncementsKB()})
+
+	return err
+}
+
+func (c *Client) announceEditCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	id := strings.Split(cb.Data, ";")[1]
+
+	announcement, err := c.Database.SelectAnnouncement(id)
+	if err != nil {
+		return err
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return err
+	}
+
+	state, err := fsm.NewState(announceEdit, announcementPayload{ID: id})
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, state); err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot,
+		fmt.Sprintf("Сейчас объявление выглядит так:\n\n%s\n%s\n\nОтправьте новое время, новый текст или и то, и другое в формате:\n\nДД/ММ/ГГГГ ЧЧ:ММ\nТекст объявления",
+			announcement.SendAt.In(location).Format(announcementLayout), announcement.Text),
+		&gotgbot.EditMessageTextOpts{ReplyMarkup: backToAnnouncementsKB()})
+
+	return err
+}
+
+func (c *Client) announceCancelCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	id := strings.Split(cb.Data, ";")[1]
+
+	cancelled, err := c.Database.SetAnnouncementStatus(id, models.AnnouncementPending, models.AnnouncementCancelled)
+	if err != nil {
+		return err
+	}
+
+	answer := "Объявление отменено"
+	if !cancelled {
+		answer = "Объявление уже отправлено или отменено"
+	}
+
+	if _, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: answer}); err != nil {
+		return err
+	}
+
+	return c.announcementsCBHandler(bot, ctx)
+}
+
+// announceTextHandler creates a new announcement or edits the one from the state.
+func (c *Client) announceTextHandler(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error {
+
+	if !c.can(ctx.EffectiveUser.Id, permAnnounce) {
+		return c.revoked(bot, ctx)
+	}
+
+	sendAt, text, err := parseAnnouncement(ctx.EffectiveMessage.Text, c.now())
+	if err != nil {
+		_, errS := bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v\n\n%s", err, announcementPrompt), &gotgbot.SendMessageOpts{ReplyMarkup: backToAnnouncementsKB()})
+		return errS
+	}
+
+	if state.Name == announceCreate {
+		if sendAt.IsZero() || text == "" {
+			_, errS := bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Нужны и время, и текст.\n\n%s", announcementPrompt), &gotgbot.SendMessageOpts{ReplyMarkup: backToAnnouncementsKB()})
+			return errS
+		}
+
+		conference, errC := c.conference(ctx.EffectiveUser.Id)
+		if errC != nil {
+			return errC
+		}
+
+		_, err = c.Database.InsertAnnouncement(models.Announcement{
+			ConferenceID: conference.ID, Text: text, SendAt: sendAt, Status: models.AnnouncementPending, CreatedBy: int(ctx.EffectiveUser.Id)})
+		if err != nil {
+			return err
+		}
+	} else {
+		var payload announcementPayload
+
+		if err = state.Decode(&payload); err != nil {
+			return err
+		}
+
+		id := payload.ID
+
+		announcement, errS := c.Database.SelectAnnouncement(id)
+		if errS != nil {
+			return errS
+		}
+
+		if sendAt.IsZero() {
+			sendAt = announcement.SendAt
+		}
+		if text == "" {
+			text = announcement.Text
+		}
+
+		updated, errU := c.Database.UpdateAnnouncement(id, text, sendAt)
+		if errU != nil {
+			return errU
+		}
+
+		if !updated {
+			_, errS = bot.SendMessage(ctx.EffectiveChat.Id, "Объявление уже отправлено или отменено", &gotgbot.SendMessageOpts{ReplyMarkup: backToAnnouncementsKB()})
+			return errS
+		}
+	}
+
+	if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: announcements}); err != nil {
+		return err
+	}
+
+	list, kb, err := c.announcementsList(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Готово!\n\n%s", list), &gotgbot.SendMessageOpts{ReplyMarkup: kb})
+
+	return err
+}
+
+// parseAnnouncement parses an announcement entered by an admin.
+// The first line is treated as the send time if it matches announcementLayout, the rest is the text.
+// The returned time is zero if it is not given, the returned text is empty if it is not given.
+// The send time should be after now.
+func parseAnnouncement(message string, now time.Time) (time.Time, string, error) {
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	firstLine, rest, _ := strings.Cut(strings.TrimSpace(message), "\n")
+
+	sendAt, err := time.ParseInLocation(announcementLayout, strings.TrimSpace(firstLine), location)
+	if err != nil {
+		return time.Time{}, strings.TrimSpace(message), nil
+	}
+
+	if sendAt.Before(now) {
+		return time.Time{}, "", fmt.Errorf("время %s уже прошло", sendAt.Format(announcementLayout))
+	}
+
+	return sendAt, strings.TrimSpace(rest), nil
+}
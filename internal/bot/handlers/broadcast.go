@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kinds of broadcast content.
+const (
+	broadcastText     = "text"
+	broadcastPhoto    = "photo"
+	broadcastDocument = "document"
+)
+
+// Audiences of a broadcast.
+const (
+	audienceAll      = "all"
+	audienceFavorite = "fav"
+	audienceUnrated  = "unrated"
+	audiencePattern  = "pattern"
+)
+
+// Steps of the conversation of an admin composing a broadcast.
+const (
+	stepBroadcastContent  = "content"
+	stepBroadcastAudience = "audience"
+	stepBroadcastReport   = "report"
+	stepBroadcastPattern  = "pattern"
+	stepBroadcastConfirm  = "confirm"
+)
+
+// broadcastDraft is a broadcast composed by an admin. It is kept in the state payload of the admin.
+type broadcastDraft struct {
+	ConferenceID string `json:"conferenceID"`        // ConferenceID is the ID of the conference whose users receive the broadcast.
+	Kind         string `json:"kind"`                // Kind is the kind of the content: text, photo or document.
+	Text         string `json:"text,omitempty"`      // Text is the text of the message or the caption of the file.
+	FileID       string `json:"fileID,omitempty"`    // FileID is the Telegram ID of the photo or the document.
+	Audience     string `json:"audience,omitempty"`  // Audience is the audience the broadcast is addressed to.
+	ReportURL    string `json:"reportURL,omitempty"` // ReportURL is the URL of the report for the favorite audience.
+	Pattern      string `json:"pattern,omitempty"`   // Pattern is the regular expression for the identification audience.
+}
+
+// broadcastConversation returns the conversation of an admin composing a broadcast:
+// the content, the audience, the report or the identification pattern of the audience and the confirmation after a preview.
+func (c *Client) broadcastConversation() *conversation.Conversation[broadcastDraft] {
+	cancel := []gotgbot.InlineKeyboardButton{{Text: "⬅️ Отменить", CallbackData: back}}
+
+	return &conversation.Conversation[broadcastDraft]{
+		Name:  broadcastCompose,
+		First: stepBroadcastContent,
+		Allow: func(tgID int64) bool { return c.can(tgID, permBroadcast) },
+		Steps: map[string]conversation.Step[broadcastDraft]{
+			stepBroadcastContent: {
+				Prompt: func(*broadcastDraft) string {
+					return "Отправьте текст, фото или документ, который нужно разослать участникам"
+				},
+				Keyboard: func(*broadcastDraft) [][]gotgbot.InlineKeyboardButton {
+					return [][]gotgbot.InlineKeyboardButton{cancel}
+				},
+				Message: saveBroadcastContent,
+				Next:    func(*broadcastDraft, string) string { return stepBroadcastAudience },
+			},
+			stepBroadcastAudience: {
+				Prompt: func(*broadcastDraft) string { return "Кому отправить рассылку?" },
+				Keyboard: func(*broadcastDraft) [][]gotgbot.InlineKeyboardButton {
+					return append(broadcastAudienceKB(), cancel)
+				},
+				Validate: func(_ *broadcastDraft, input string) error {
+					switch input {
+					case audienceAll, audienceFavorite, audienceUnrated, audiencePattern:
+						return nil
+					}
+					return errors.New("Выберите аудиторию из списка")
+				},
+				Save: func(data *broadcastDraft, input string) {
+					data.Audience, data.ReportURL, data.Pattern = input, "", ""
+				},
+				Next: func(_ *broadcastDraft, input string) string {
+					switch input {
+					case audienceFavorite:
+						return stepBroadcastReport
+					case audiencePattern:
+						return stepBroadcastPattern
+					}
+					return stepBroadcastConfirm
+				},
+			},
+			stepBroadcastReport: {
+				Prompt: func(data *broadcastDraft) string {
+					reports, err := c.Database.SelectReports(data.ConferenceID)
+					if err != nil {
+						return "Не получилось загрузить расписание, попробуйте позже"
+					}
+					return fmt.Sprintf("Выберите доклад:\n\n%s", getFormatReports(reports))
+				},
+				Keyboard: func(data *broadcastDraft) [][]gotgbot.InlineKeyboardButton {
+					reports, _ := c.Database.SelectReports(data.ConferenceID)
+					return append(broadcastReportsKB(reports), cancel)
+				},
+				Validate: func(data *broadcastDraft, input string) error {
+					if _, err := c.broadcastReport(data, input); err != nil {
+						return errors.New("Доклад не найден, возможно, расписание изменилось")
+					}
+					return nil
+				},
+				Save: func(data *broadcastDraft, input string) {
+					report, _ := c.broadcastReport(data, input)
+					data.ReportURL = report.URL
+				},
+				Next: func(*broadcastDraft, string) string { return stepBroadcastConfirm },
+			},
+			stepBroadcastPattern: {
+				Prompt: func(*broadcastDraft) string {
+					return "Введите шаблон идентификации (регулярное выражение, регистр не учитывается)"
+				},
+				Keyboard: func(*broadcastDraft) [][]gotgbot.InlineKeyboardButton {
+					return [][]gotgbot.InlineKeyboardButton{cancel}
+				},
+				Text: true,
+				Validate: func(_ *broadcastDraft, input string) error {
+					if _, err := regexp.Compile("(?i)" + input); err != nil {
+						return fmt.Errorf("Некорректный шаблон: %v. Попробуйте ещё раз", err)
+					}
+					return nil
+				},
+				Save: func(data *broadcastDraft, input string) { data.Pattern = input },
+				Next: func(*broadcastDraft, string) string { return stepBroadcastConfirm },
+			},
+			stepBroadcastConfirm: {
+				Prompt: func(*broadcastDraft) string {
+					return "Выше — предпросмотр рассылки. Отправить?"
+				},
+				Keyboard: func(*broadcastDraft) [][]gotgbot.InlineKeyboardButton {
+					return [][]gotgbot.InlineKeyboardButton{{conversation.Choice("✅ Отправить", broadcastSend)}, cancel}
+				},
+				Validate: func(_ *broadcastDraft, input string) error {
+					if input != broadcastSend {
+						return errors.New("Подтвердите или отмените рассылку")
+					}
+					return nil
+				},
+				Show: c.broadcastPreview,
+			},
+		},
+		Done: c.broadcastDone,
+	}
+}
+
+// saveBroadcastContent saves the text, the photo or the document of the message to the draft.
+func saveBroadcastContent(draft *broadcastDraft, msg *gotgbot.Message) error {
+	switch {
+	case len(msg.Photo) != 0:
+		draft.Kind, draft.FileID, draft.Text = broadcastPhoto, msg.Photo[len(msg.Photo)-1].FileId, msg.Caption
+	case msg.Document != nil:
+		draft.Kind, draft.FileID, draft.Text = broadcastDocument, msg.Document.FileId, msg.Caption
+	case strings.TrimSpace(msg.Text) != "":
+		draft.Kind, draft.FileID, draft.Text = broadcastText, "", msg.Text
+	default:
+		return errors.New("Рассылка может содержать только текст, фото или документ")
+	}
+	return nil
+}
+
+// broadcastReport returns the report of the conference of the draft by its number in the schedule from the input.
+func (c *Client) broadcastReport(draft *broadcastDraft, input string) (models.Report, error) {
+	ind, err := strconv.Atoi(input)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	reports, err := c.Database.SelectReports(draft.ConferenceID)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	if ind < 0 || ind >= len(reports) {
+		return models.Report{}, storage.ErrNotFound
+	}
+
+	return reports[ind], nil
+}
+
+func (c *Client) broadcastHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	return c.broadcast.Start(bot, ctx, broadcastDraft{ConferenceID: conference.ID})
+}
+
+// broadcastPreview shows the admin the broadcast as recipients will see it followed by the confirmation with the number of recipients.
+func (c *Client) broadcastPreview(bot *gotgbot.Bot, ctx *ext.Context, draft *broadcastDraft, text string, kb gotgbot.InlineKeyboardMarkup) error {
+
+	users, err := c.broadcastRecipients(draft)
+	if err != nil {
+		return err
+	}
+
+	if cb := ctx.CallbackQuery; cb != nil {
+		if _, err = cb.Answer(bot, nil); err != nil {
+			return err
+		}
+	}
+
+	if _, err = sendBroadcast(bot, ctx.EffectiveChat.Id, draft); err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("%s\n\nПолучателей: %d", text, len(users)), &gotgbot.SendMessageOpts{ReplyMarkup: kb})
+
+	return err
+}
+
+// broadcastDone sends the broadcast to its recipients and reports the delivery to the admin when it is over.
+func (c *Client) broadcastDone(bot *gotgbot.Bot, ctx *ext.Context, draft *broadcastDraft) error {
+
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
+		return err
+	}
+
+	users, err := c.broadcastRecipients(draft)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Рассылка запущена, получателей: %d. Я пришлю отчёт о доставке, когда закончу", len(users))
+	if err = conversation.Reply(bot, ctx, text, backToMainMenuAdminKB()); err != nil {
+		return err
+	}
+
+	report := &deliveryReport{remaining: len(users)}
+	adminChat := ctx.EffectiveChat.Id
+
+	if len(users) == 0 {
+		c.Sender.SendText(adminChat, report.String(), nil)
+		return nil
+	}
+
+	sent := *draft
+
+	for _, user := range users {
+		chatID := int64(user.ChatID)
+		c.Sender.Enqueue(sender.Message{
+			ChatID: chatID,
+			Text:   sent.Text,
+			Send: func(bot *gotgbot.Bot) (*gotgbot.Message, error) {
+				return sendBroadcast(bot, chatID, &sent)
+			},
+			Done: func(_ *gotgbot.Message, err error) {
+				if report.add(err) {
+					c.Sender.SendText(adminChat, report.String(), nil)
+				}
+			},
+		})
+	}
+
+	return nil
+}
+
+// broadcastRecipients returns the users of the conference the broadcast is addressed to.
+func (c *Client) broadcastRecipients(draft *broadcastDraft) ([]models.User, error) {
+
+	all, err := c.Database.SelectUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []models.User
+	for _, user := range all {
+		if user.ActiveConference() == draft.ConferenceID {
+			users = append(users, user)
+		}
+	}
+
+	var recipients []models.User
+
+	switch draft.Audience {
+	case audienceFavorite:
+		for _, user := range users {
+			for _, report := range user.FavoriteReports {
+				if report.ConferenceID == draft.ConferenceID && report.URL == draft.ReportURL {
+					recipients = append(recipients, user)
+					break
+				}
+			}
+		}
+	case audienceUnrated:
+		for _, user := range users {
+			evaluations, errS := c.Database.SelectEvaluations(user.TgID, draft.ConferenceID)
+			if errS != nil {
+				return nil, errS
+			}
+			if len(evaluations) == 0 {
+				recipients = append(recipients, user)
+			}
+		}
+	case audiencePattern:
+		pattern, errC := regexp.Compile("(?i)" + draft.Pattern)
+		if errC != nil {
+			return nil, errC
+		}
+		for _, user := range users {
+			if pattern.MatchString(user.Identification) {
+				recipients = append(recipients, user)
+			}
+		}
+	default:
+		recipients = users
+	}
+
+	return recipients, nil
+}
+
+// sendBroadcast sends the content of the broadcast to the chat.
+func sendBroadcast(bot *gotgbot.Bot, chatID int64, draft *broadcastDraft) (*gotgbot.Message, error) {
+	switch draft.Kind {
+	case broadcastPhoto:
+		return bot.SendPhoto(chatID, draft.FileID, &gotgbot.SendPhotoOpts{Caption: draft.Text})
+	case broadcastDocument:
+		return bot.SendDocument(chatID, draft.FileID, &gotgbot.SendDocumentOpts{Caption: draft.Text})
+	default:
+		return bot.SendMessage(chatID, draft.Text, nil)
+	}
+}
+
+// deliveryReport counts the results of a broadcast delivery.
+type deliveryReport struct {
+	mu        sync.Mutex
+	remaining int
+	sent      int
+	failed    int
+	blocked   int
+}
+
+// add records the result of a single delivery and reports whether it was the last one.
+func (r *deliveryReport) add(err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case err == nil:
+		r.sent++
+	case sender.IsBlocked(err):
+		r.blocked++
+	default:
+		r.failed++
+	}
+
+	r.remaining--
+
+	return r.remaining == 0
+}
+
+// String returns a human-readable delivery report.
+func (r *deliveryReport) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return fmt.Sprintf("📬 Рассылка завершена\n\nДоставлено: %d\nНе доставлено: %d\nЗаблокировали бота: %d", r.sent, r.failed, r.blocked)
+}
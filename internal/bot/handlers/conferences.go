@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// conferenceLayout is the layout of the conference times entered by an admin.
+const conferenceLayout = "02/01/2006 15:04"
+
+// conferenceIDPattern is the pattern of the conference IDs, they are short enough to fit the callback data.
+var conferenceIDPattern = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// Steps of the conversation of an admin creating a conference.
+const (
+	stepConferenceID      = "id"
+	stepConferenceName    = "name"
+	stepConferenceURL     = "url"
+	stepConferenceFrom    = "from"
+	stepConferenceUntil   = "until"
+	stepConferenceReviews = "reviews"
+)
+
+// conferencePayload is the state payload of an admin creating a conference.
+type conferencePayload struct {
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	URL                  string    `json:"url"`
+	TimeFrom             time.Time `json:"timeFrom"`
+	TimeUntil            time.Time `json:"timeUntil"`
+	TimeReviewsAvailable time.Time `json:"timeReviewsAvailable"`
+}
+
+// conference returns the conference the user picked.
+// It returns storage.ErrNotFound if the user hasn't picked one and there is no default conference.
+func (c *Client) conference(tgID int64) (models.Conference, error) {
+	conferenceID, err := c.Database.SelectUserConference(int(tgID))
+	if err != nil {
+		return models.Conference{}, err
+	}
+
+	return c.Database.SelectConference(conferenceID)
+}
+
+// reportCallback returns the callback data of the action on the report. The data ends with the conference of the report,
+// since a URL is unique only within its conference and rating prompts name the reports of any conference.
+func reportCallback(action string, report models.Report) string {
+	return fmt.Sprintf("%s;%s;%s", action, report.URL, report.ConferenceID)
+}
+
+// parseReportCallback returns the conference and the URL of the report from the callback data made by reportCallback.
+// The conference is empty for the buttons sent before it was added to the data.
+func parseReportCallback(data string) (string, string) {
+	fields := strings.Split(data, ";")
+	if len(fields) < 2 {
+		return "", ""
+	}
+	if len(fields) < 3 {
+		return "", fields[1]
+	}
+	return fields[2], fields[1]
+}
+
+// callbackReport returns the report of the callback data made by reportCallback.
+// Buttons without the conference name a report of the conference the user picked.
+func (c *Client) callbackReport(cb *gotgbot.CallbackQuery) (models.Report, error) {
+	conferenceID, url := parseReportCallback(cb.Data)
+	if conferenceID == "" {
+		return c.conferenceReport(cb.From.Id, url)
+	}
+	return c.Database.SelectReport(conferenceID, url)
+}
+
+// conferenceReport returns the report with the URL of the conference the user picked.
+func (c *Client) conferenceReport(tgID int64, url string) (models.Report, error) {
+	conference, err := c.conference(tgID)
+	if err != nil {
+		return models.Report{}, err
+	}
+
+	return c.Database.SelectReport(conference.ID, url)
+}
+
+func (c *Client) conferencesCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: conferences}); err != nil {
+		return err
+	}
+
+	list, err := c.Database.SelectConferences()
+	if err != nil {
+		return err
+	}
+
+	active, _ := c.Database.SelectUserConference(int(ctx.EffectiveUser.Id))
+
+	text := "Выберите конференцию:"
+	if len(list) == 0 {
+		text = "Конференций пока нет"
+	}
+
+	return conversation.Reply(bot, ctx, text, conferencesKB(list, active, c.can(ctx.EffectiveUser.Id, permConferences)))
+}
+
+func (c *Client) conferencePickCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	conference, err := c.Database.SelectConference(strings.TrimPrefix(cb.Data, conferencePick+";"))
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Конференция не найдена"})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = c.Database.SetUserConference(int(cb.From.Id), conference.ID); err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, fsm.State{Name: menu}); err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Теперь вы на конференции «%s». Доклады, избранное и оценки относятся к ней", conference.Name),
+		&gotgbot.EditMessageTextOpts{ReplyMarkup: c.mainMenuKB(cb.From.Id)})
+
+	return err
+}
+
+func (c *Client) conferenceCreateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return c.conferenceCreate.Start(bot, ctx, conferencePayload{})
+}
+
+// noConference tells the user to pick a conference if they haven't picked one, other errors are returned as is.
+func (c *Client) noConference(bot *gotgbot.Bot, ctx *ext.Context, err error) error {
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return c.conferencesCBHandler(bot, ctx)
+}
+
+// conferenceCreateConversation returns the conversation of an owner creating a conference.
+func (c *Client) conferenceCreateConversation() *conversation.Conversation[conferencePayload] {
+	toMenu := func(*conferencePayload) [][]gotgbot.InlineKeyboardButton {
+		return [][]gotgbot.InlineKeyboardButton{{{Text: "⬅️ В главное меню", CallbackData: back}}}
+	}
+
+	timeStep := func(prompt string, validate func(data *conferencePayload, t time.Time) error, save func(data *conferencePayload, t time.Time), next string) conversation.Step[conferencePayload] {
+		return conversation.Step[conferencePayload]{
+			Prompt: func(*conferencePayload) string {
+				return fmt.Sprintf("%s в формате ДД/ММ/ГГГГ ЧЧ:ММ (время МСК)", prompt)
+			},
+			Text: true,
+			Validate: func(data *conferencePayload, input string) error {
+				t, err := time.Parse(conferenceLayout, strings.TrimSpace(input))
+				if err != nil {
+					return errors.New("Не получилось разобрать время, нужен формат ДД/ММ/ГГГГ ЧЧ:ММ")
+				}
+				return validate(data, t)
+			},
+			Save: func(data *conferencePayload, input string) {
+				t, _ := time.Parse(conferenceLayout, strings.TrimSpace(input))
+				save(data, t)
+			},
+			Next: func(*conferencePayload, string) string { return next },
+		}
+	}
+
+	return &conversation.Conversation[conferencePayload]{
+		Name:  conferenceCreate,
+		First: stepConferenceID,
+		Allow: func(tgID int64) bool { return c.can(tgID, permConferences) },
+		Steps: map[string]conversation.Step[conferencePayload]{
+			stepConferenceID: {
+				Prompt: func(*conferencePayload) string {
+					return "Введите короткий код новой конференции: латинские буквы, цифры и дефис, например golangconf-2025"
+				},
+				Keyboard: toMenu,
+				Text:     true,
+				Validate: func(_ *conferencePayload, input string) error {
+					id := strings.ToLower(strings.TrimSpace(input))
+					if !conferenceIDPattern.MatchString(id) {
+						return errors.New("Код может содержать только латинские буквы, цифры и дефис, не длиннее 32 символов")
+					}
+					if _, err := c.Database.SelectConference(id); err == nil {
+						return errors.New("Конференция с таким кодом уже есть, придумайте другой")
+					}
+					return nil
+				},
+				Save: func(data *conferencePayload, input string) { data.ID = strings.ToLower(strings.TrimSpace(input)) },
+				Next: func(*conferencePayload, string) string { return stepConferenceName },
+			},
+			stepConferenceName: {
+				Prompt: func(*conferencePayload) string { return "Введите название конференции" },
+				Text:   true,
+				Save:   func(data *conferencePayload, input string) { data.Name = strings.TrimSpace(input) },
+				Next:   func(*conferencePayload, string) string { return stepConferenceURL },
+			},
+			stepConferenceURL: {
+				Prompt: func(*conferencePayload) string { return "Введите адрес сайта конференции" },
+				Text:   true,
+				Validate: func(_ *conferencePayload, input string) error {
+					if !strings.HasPrefix(strings.TrimSpace(input), "http") {
+						return errors.New("Адрес сайта должен начинаться с http:// или https://")
+					}
+					return nil
+				},
+				Save: func(data *conferencePayload, input string) { data.URL = strings.TrimSpace(input) },
+				Next: func(*conferencePayload, string) string { return stepConferenceFrom },
+			},
+			stepConferenceFrom: timeStep("Введите время начала конференции",
+				func(*conferencePayload, time.Time) error { return nil },
+				func(data *conferencePayload, t time.Time) { data.TimeFrom = t },
+				stepConferenceUntil),
+			stepConferenceUntil: timeStep("Введите время окончания конференции",
+				func(data *conferencePayload, t time.Time) error {
+					if !t.After(data.TimeFrom) {
+						return errors.New("Конференция должна закончиться позже, чем начнётся")
+					}
+					return nil
+				},
+				func(data *conferencePayload, t time.Time) { data.TimeUntil = t },
+				stepConferenceReviews),
+			stepConferenceReviews: timeStep("Введите время, с которого спикерам доступны отзывы",
+				func(data *conferencePayload, t time.Time) error {
+					if t.Before(data.TimeUntil) {
+						return errors.New("Отзывы становятся доступны не раньше окончания конференции")
+					}
+					return nil
+				},
+				func(data *conferencePayload, t time.Time) { data.TimeReviewsAvailable = t },
+				""),
+		},
+		Done: c.conferenceCreateDone,
+	}
+}
+
+// conferenceCreateDone stores the new conference, makes its creator an organizer of it and moves the creator to it.
+func (c *Client) conferenceCreateDone(bot *gotgbot.Bot, ctx *ext.Context, data *conferencePayload) error {
+	tgID := int(ctx.EffectiveUser.Id)
+
+	conference := models.Conference{
+		ID:                   data.ID,
+		Name:                 data.Name,
+		URL:                  data.URL,
+		TimeFrom:             data.TimeFrom,
+		TimeUntil:            data.TimeUntil,
+		TimeReviewsAvailable: data.TimeReviewsAvailable,
+		CreatedBy:            tgID,
+	}
+
+	if err := c.Database.SaveConference(conference); err != nil {
+		return err
+	}
+
+	organizer := models.UserRole{TgID: tgID, Role: models.RoleOrganizer, ConferenceID: conference.ID, GrantedBy: tgID, GrantedAt: c.now().UTC()}
+	if _, err := c.Database.GrantRole(organizer); err != nil {
+		return err
+	}
+
+	if err := c.Database.SetUserConference(tgID, conference.ID); err != nil {
+		return err
+	}
+
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
+		return err
+	}
+
+	return conversation.Reply(bot, ctx, fmt.Sprintf("Конференция «%s» создана, вы её организатор и уже на ней. Загрузите расписание, чтобы участники увидели доклады", conference.Name),
+		c.mainMenuKB(ctx.EffectiveUser.Id))
+}
+
+// formatConference returns the description of the conference.
+func formatConference(conference models.Conference) string {
+	return fmt.Sprintf("📅 О конференции\n\n🎉 Название: %s\n🌐 Сайт: %s\n\n🕒 Время начала: %s\n🕙 Время окончания: %s\n\n",
+		conference.Name, conference.URL, conference.TimeFrom.Format("02.01.2006 15:04"), conference.TimeUntil.Format("02.01.2006 15:04"))
+}
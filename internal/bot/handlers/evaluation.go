@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stepRate is the first step of the evaluation conversation.
+const stepRate = "rate"
+
+// Inputs of the questionnaire steps besides the marks of a scale and the indexes of the options of a choice.
+// They start with "#", so they can't be confused with the marks.
+const (
+	inputSkip = "#skip" // inputSkip skips an optional item.
+	inputDone = "#done" // inputDone finishes a multiple choice.
+	inputYes  = "#yes"
+	inputNo   = "#no"
+)
+
+// optionSeparator separates the chosen options in the answer to a multiple choice.
+const optionSeparator = "; "
+
+// itemStep returns the name of the step asking the item of the questionnaire with the index.
+func itemStep(ind int) string {
+	return "item;" + strconv.Itoa(ind)
+}
+
+// optionInput returns the input of the option of a choice with the index.
+func optionInput(ind int) string {
+	return "#" + strconv.Itoa(ind)
+}
+
+// parseOptionInput returns the index of the option of the item chosen by the input.
+func parseOptionInput(item models.QuestionnaireItem, input string) (int, bool) {
+	if !strings.HasPrefix(input, "#") {
+		return 0, false
+	}
+	ind, err := strconv.Atoi(strings.TrimPrefix(input, "#"))
+	if err != nil || ind < 0 || ind >= len(item.Options) {
+		return 0, false
+	}
+	return ind, true
+}
+
+// questionnaireForm is the part of a state payload with a questionnaire and the answers of the user.
+type questionnaireForm struct {
+	Text string `json:"text,omitempty"` // Text is the header of the steps.
+	// Items are the items of the questionnaire, fixed when the conversation starts.
+	Items []models.QuestionnaireItem `json:"items,omitempty"`
+	// Answers are the answers to the items by their IDs.
+	Answers map[string]string `json:"answers,omitempty"`
+}
+
+// evaluationPayload is the state payload of a user evaluating a report or updating an evaluation.
+type evaluationPayload struct {
+	URL          string `json:"url"`          // URL is the URL of the report being evaluated.
+	ConferenceID string `json:"conferenceID"` // ConferenceID is the ID of the conference of the report.
+	questionnaireForm
+	// Declined is noEvaluate or noWishToEvaluate if the user didn't listen to the report or doesn't want to rate it.
+	Declined string `json:"declined,omitempty"`
+}
+
+// form returns the questionnaire of the report with the answers.
+func (p *evaluationPayload) form() *questionnaireForm {
+	return &p.questionnaireForm
+}
+
+// evaluation returns the evaluation of the user from the payload.
+// The answers to the items of the default questionnaire are also kept in the fields of the evaluation.
+func (p *evaluationPayload) evaluation(tgID int64) models.Evaluation {
+	if p.Declined != "" {
+		return models.Evaluation{URL: p.URL, ConferenceID: p.ConferenceID, TgID: int(tgID), Content: p.Declined}
+	}
+
+	return models.Evaluation{URL: p.URL, ConferenceID: p.ConferenceID, TgID: int(tgID), Content: p.Answers[models.ItemContent],
+		Performance: p.Answers[models.ItemPerformance], Comment: p.Answers[models.ItemComment], Answers: p.Answers}
+}
+
+// selectedOptions reports for each option of a multiple choice whether it is chosen in the answer.
+func selectedOptions(item models.QuestionnaireItem, answer string) []bool {
+	selected := make([]bool, len(item.Options))
+	for _, chosen := range strings.Split(answer, optionSeparator) {
+		for ind, option := range item.Options {
+			if option == chosen {
+				selected[ind] = true
+			}
+		}
+	}
+	return selected
+}
+
+// validateAnswer checks that the input answers the item.
+func validateAnswer(item models.QuestionnaireItem, answer string, input string) error {
+	if input == inputSkip {
+		if !item.Optional {
+			return errors.New("На этот вопрос нужно ответить")
+		}
+		return nil
+	}
+
+	switch item.Type {
+	case models.ItemScale:
+		if mark, err := strconv.Atoi(input); err != nil || mark < item.Min || mark > item.Max {
+			return fmt.Errorf("Оценка должна быть от %d до %d", item.Min, item.Max)
+		}
+	case models.ItemSingle:
+		if _, ok := parseOptionInput(item, input); !ok {
+			return errors.New("Выберите один из вариантов")
+		}
+	case models.ItemMulti:
+		if input == inputDone {
+			if answer == "" && !item.Optional {
+				return errors.New("Выберите хотя бы один вариант")
+			}
+			return nil
+		}
+		if _, ok := parseOptionInput(item, input); !ok {
+			return errors.New("Выберите варианты и нажмите «Готово»")
+		}
+	case models.ItemYesNo:
+		if input != inputYes && input != inputNo {
+			return errors.New("Ответьте «Да» или «Нет»")
+		}
+	case models.ItemText:
+		if strings.TrimSpace(input) == "" {
+			return errors.New("Напишите ответ текстом")
+		}
+	}
+
+	return nil
+}
+
+// saveAnswer stores the answer to the item given by the input. Options of a multiple choice are toggled.
+func (p *questionnaireForm) saveAnswer(item models.QuestionnaireItem, input string) {
+	if p.Answers == nil {
+		p.Answers = make(map[string]string)
+	}
+
+	var answer string
+
+	switch {
+	case input == inputSkip:
+	case item.Type == models.ItemSingle:
+		ind, _ := parseOptionInput(item, input)
+		answer = item.Options[ind]
+	case item.Type == models.ItemMulti:
+		if input == inputDone {
+			return
+		}
+		selected := selectedOptions(item, p.Answers[item.ID])
+		ind, _ := parseOptionInput(item, input)
+		selected[ind] = !selected[ind]
+
+		var chosen []string
+		for i, option := range item.Options {
+			if selected[i] {
+				chosen = append(chosen, option)
+			}
+		}
+		answer = strings.Join(chosen, optionSeparator)
+	case item.Type == models.ItemYesNo:
+		answer = "Нет"
+		if input == inputYes {
+			answer = "Да"
+		}
+	default:
+		answer = strings.TrimSpace(input)
+	}
+
+	if answer == "" {
+		delete(p.Answers, item.ID)
+		return
+	}
+
+	p.Answers[item.ID] = answer
+}
+
+// questionnaireStep returns the step asking the item of the questionnaire with the index, form returns the questionnaire of the payload.
+// The exit row is added to the keyboard, so the user can leave the conversation.
+func questionnaireStep[T any](ind int, form func(*T) *questionnaireForm, exit []gotgbot.InlineKeyboardButton) conversation.Step[T] {
+	return conversation.Step[T]{
+		Prompt: func(payload *T) string {
+			data := form(payload)
+			item := data.Items[ind]
+			text := fmt.Sprintf("%s\n\nВопрос %d из %d. %s", data.Text, ind+1, len(data.Items), item.Text)
+			if item.Type == models.ItemMulti {
+				text += "\n\nВыберите один или несколько вариантов и нажмите «Готово»"
+			}
+			return text
+		},
+		Keyboard: func(payload *T) [][]gotgbot.InlineKeyboardButton {
+			data := form(payload)
+			item := data.Items[ind]
+			return append(questionnaireItemKB(item, data.Answers[item.ID]), exit)
+		},
+		Text: true,
+		Validate: func(payload *T, input string) error {
+			data := form(payload)
+			item := data.Items[ind]
+			return validateAnswer(item, data.Answers[item.ID], input)
+		},
+		Save: func(payload *T, input string) {
+			data := form(payload)
+			data.saveAnswer(data.Items[ind], input)
+		},
+		Next: func(payload *T, input string) string {
+			data := form(payload)
+			if data.Items[ind].Type == models.ItemMulti && input != inputDone && input != inputSkip {
+				return itemStep(ind)
+			}
+			if ind+1 < len(data.Items) {
+				return itemStep(ind + 1)
+			}
+			return ""
+		},
+	}
+}
+
+// questionnaireSteps returns the steps for every item a questionnaire may have.
+// The steps are generated from the items in the payload, so each report may have its own questionnaire.
+func questionnaireSteps[T any](form func(*T) *questionnaireForm, exit []gotgbot.InlineKeyboardButton) map[string]conversation.Step[T] {
+	steps := make(map[string]conversation.Step[T], questionnaireMaxItems)
+
+	for ind := 0; ind < questionnaireMaxItems; ind++ {
+		steps[itemStep(ind)] = questionnaireStep(ind, form, exit)
+	}
+
+	return steps
+}
+
+// evaluationConversation returns the conversation of a user evaluating a report.
+// The user either answers the questionnaire or tells that they didn't listen to the report or don't want to rate it.
+func (c *Client) evaluationConversation() *conversation.Conversation[evaluationPayload] {
+	steps := questionnaireSteps((*evaluationPayload).form, []gotgbot.InlineKeyboardButton{{Text: "Вернуться к докладам", CallbackData: viewReports}})
+
+	steps[stepRate] = conversation.Step[evaluationPayload]{
+		Prompt:   func(data *evaluationPayload) string { return data.Text },
+		Keyboard: func(*evaluationPayload) [][]gotgbot.InlineKeyboardButton { return evaluateKB() },
+		Save: func(data *evaluationPayload, input string) {
+			data.Declined = ""
+			if input != evaluationBegin {
+				data.Declined = input
+			}
+		},
+		Next: func(_ *evaluationPayload, input string) string {
+			if input == evaluationBegin {
+				return itemStep(0)
+			}
+			return ""
+		},
+	}
+
+	return &conversation.Conversation[evaluationPayload]{
+		Name:  evaluateReport,
+		First: stepRate,
+		Steps: steps,
+		Done:  c.evaluationDone,
+	}
+}
+
+// evaluationDone saves the evaluation of the report.
+func (c *Client) evaluationDone(bot *gotgbot.Bot, ctx *ext.Context, data *evaluationPayload) error {
+
+	text := "Ваш отзыв успешно добавлен!"
+
+	switch data.Declined {
+	case noEvaluate:
+		text = "Спасибо за ваш отзыв, вдруг что, вы всегда можете его изменить"
+	case noWishToEvaluate:
+		text = "Спасибо за вашу обратную связь! Помните: вы всегда можете изменить свой отзыв"
+	}
+
+	if err := c.Database.InsertEvaluation(data.evaluation(ctx.EffectiveUser.Id)); err != nil {
+		return err
+	}
+
+	return conversation.Reply(bot, ctx, text, evaluationEndKB())
+}
+
+// evaluationUpdateConversation returns the conversation of a user updating their evaluation of a report.
+func (c *Client) evaluationUpdateConversation() *conversation.Conversation[evaluationPayload] {
+	steps := questionnaireSteps((*evaluationPayload).form, []gotgbot.InlineKeyboardButton{{Text: "К отзывам", CallbackData: userEvaluations}})
+
+	return &conversation.Conversation[evaluationPayload]{
+		Name:  updateEvaluation,
+		First: itemStep(0),
+		Steps: steps,
+		Done:  c.evaluationUpdateDone,
+	}
+}
+
+// evaluationUpdateDone saves the updated evaluation of the report.
+func (c *Client) evaluationUpdateDone(bot *gotgbot.Bot, ctx *ext.Context, data *evaluationPayload) error {
+
+	upd, err := c.Database.UpdateEvaluation(int(ctx.EffectiveUser.Id), data.ConferenceID, data.URL, data.evaluation(ctx.EffectiveUser.Id))
+	if err != nil {
+		return err
+	}
+
+	text := "Ваш отзыв успешно обновлён!"
+	if !upd {
+		text = "Ваш отзыв ни чем не отличается от прошлого! Поэтому я его не обновил"
+	}
+
+	return conversation.Reply(bot, ctx, text, evaluationEndKB())
+}
+
+// formatAnswers returns the answers of the evaluation labelled with the items of the questionnaire.
+// Evaluations made before the questionnaires were introduced have only the marks and the comment.
+func formatAnswers(items []models.QuestionnaireItem, evaluation models.Evaluation) string {
+	if len(evaluation.Answers) == 0 {
+		return fmt.Sprintf("Содержание: \"%s\"\nВыступление: \"%s\"\nКомментарий: \"%s\"\n", evaluation.Content, evaluation.Performance, evaluation.Comment)
+	}
+
+	var text string
+
+	asked := make(map[string]bool, len(items))
+	for _, item := range items {
+		asked[item.ID] = true
+		if answer, exists := evaluation.Answers[item.ID]; exists {
+			text += fmt.Sprintf("%s \"%s\"\n", item.Text, answer)
+		}
+	}
+
+	var removed []string
+	for id := range evaluation.Answers {
+		if !asked[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		text += fmt.Sprintf("%s: \"%s\"\n", id, evaluation.Answers[id])
+	}
+
+	return text
+}
+
+func (c *Client) evaluateReportCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	report, err := c.callbackReport(ctx.Update.CallbackQuery)
+	if err != nil {
+		return err
+	}
+
+	items, err := c.questionnaire(report)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Вы оцениваете следующий доклад:\n\n%s - %s", report.Speakers, report.Title)
+
+	return c.evaluation.Start(bot, ctx, evaluationPayload{URL: report.URL, ConferenceID: report.ConferenceID,
+		questionnaireForm: questionnaireForm{Text: text, Items: items}})
+}
+
+func (c *Client) updateEvaluationCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	report, err := c.callbackReport(ctx.Update.CallbackQuery)
+	if err != nil {
+		return err
+	}
+
+	items, err := c.questionnaire(report)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Вы меняете отзыв о докладе:\n\n%s - %s", report.Speakers, report.Title)
+
+	return c.evaluationUpdate.Start(bot, ctx, evaluationPayload{URL: report.URL, ConferenceID: report.ConferenceID,
+		questionnaireForm: questionnaireForm{Text: text, Items: items}})
+}
+
+func (c *Client) notEvaluateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Вы пока не можете оценить этот доклад"}); err != nil {
+
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) userEvaluationsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	err := c.FSM.SetState(cb.From.Id, fsm.State{Name: userEvaluations})
+
+	if err != nil {
+		return err
+	}
+
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	evaluations, err := c.Database.SelectEvaluations(int(cb.From.Id), conference.ID)
+
+	var text string
+
+	reports, err := c.Database.SelectReports(conference.ID)
+
+	evaluationsMap := make(map[string]models.Evaluation, len(evaluations))
+
+	for _, evaluation := range evaluations {
+		if _, exists := evaluationsMap[evaluation.URL]; !exists {
+			evaluationsMap[evaluation.URL] = evaluation
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	questionnaires, err := c.Database.SelectQuestionnaires(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	for ind, report := range reports {
+		if evaluation, exists := evaluationsMap[report.URL]; exists {
+			text += fmt.Sprintf("%v. %s - %s\n\n%s\n", ind+1, report.Speakers, report.Title,
+				formatAnswers(questionnaireItems(questionnaires, report), evaluation))
+		}
+	}
+
+	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Ваши отзывы:\n\n%s", text), &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: userEvaluationsKB(reports, evaluationsMap),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) deleteEvaluationCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	err := c.FSM.SetState(cb.From.Id, fsm.State{Name: deleteEvaluation})
+
+	if err != nil {
+		return err
+	}
+
+	conferenceID, url := parseReportCallback(cb.Data)
+	if conferenceID == "" {
+		conference, errC := c.conference(cb.From.Id)
+		if errC != nil {
+			return errC
+		}
+		conferenceID = conference.ID
+	}
+
+	deleted, err := c.Database.DeleteEvaluation(int(cb.From.Id), conferenceID, url)
+
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		_, _, err = cb.Message.EditText(bot, "Ваш отзыв удалён! Если передумайте, то всегда можете написать новый", &gotgbot.EditMessageTextOpts{
+			ReplyMarkup: evaluationEndKB(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
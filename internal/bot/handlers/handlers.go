@@ -2,24 +2,24 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
 const (
-	html     = "html"
-	dataJSON = "data.json"
+	html = "html"
 )
 
 func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
@@ -30,11 +30,11 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return err
 	}
 
-	switch state {
+	switch state.Name {
 
 	case "":
 
-		if err = c.FSM.SetState(ctx.EffectiveUser.Id, start); err != nil {
+		if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: start}); err != nil {
 			return err
 		}
 
@@ -42,7 +42,7 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	case uploadSchedule:
 
-		if err = c.FSM.SetState(ctx.EffectiveUser.Id, menu); err != nil {
+		if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
 			return err
 		}
 
@@ -50,7 +50,7 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 			"Спасибо, что вы загрузили расписание. Так держать, скушайте печеньку 🍪",
 			&gotgbot.SendMessageOpts{
 				ParseMode:   html,
-				ReplyMarkup: mainMenuAdminKB(),
+				ReplyMarkup: c.mainMenuKB(ctx.EffectiveUser.Id),
 			})
 
 		if err != nil {
@@ -59,38 +59,21 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	case updateIdentification:
 
-		err = c.FSM.SetState(ctx.EffectiveUser.Id, menu)
+		err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu})
 
 		if err != nil {
 			return err
 		}
 
-		if _, exists := c.Cfg.Administrators.IDsInMap[int(ctx.Message.From.Id)]; exists {
-
-			_, err = bot.SendMessage(ctx.Message.Chat.Id,
-				"Вижу, что вы недавно изменили свою идентификацию. Не забывайте оставлять отзывы о просмотренных докладах. Обратная связь крайне важна",
-				&gotgbot.SendMessageOpts{
-					ParseMode:   html,
-					ReplyMarkup: mainMenuAdminKB(),
-				})
-
-			if err != nil {
-				return err
-			}
-
-		} else {
-
-			_, err = bot.SendMessage(ctx.Message.Chat.Id,
-				"Вижу, что вы недавно изменили свою идентификацию. Не забывайте оставлять отзывы о просмотренных докладах. Обратная связь крайне важна",
-				&gotgbot.SendMessageOpts{
-					ParseMode:   html,
-					ReplyMarkup: mainMenuUserKB(),
-				})
-
-			if err != nil {
-				return err
-			}
+		_, err = bot.SendMessage(ctx.Message.Chat.Id,
+			"Вижу, что вы недавно изменили свою идентификацию. Не забывайте оставлять отзывы о просмотренных докладах. Обратная связь крайне важна",
+			&gotgbot.SendMessageOpts{
+				ParseMode:   html,
+				ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
+			})
 
+		if err != nil {
+			return err
 		}
 	case start:
 		if strings.HasPrefix(ctx.EffectiveMessage.Text, "/") {
@@ -104,24 +87,24 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 			return nil
 		}
 	default:
-		err = c.FSM.SetState(ctx.Message.From.Id, menu)
+		err = c.FSM.SetState(ctx.Message.From.Id, fsm.State{Name: menu})
 
 		if err != nil {
 			return err
 		}
 
-		user, errS := c.Database.SelectUser(c.Database.Collection("user"), int(ctx.EffectiveUser.Id))
+		user, errS := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 
 		if errS != nil {
 			return errS
 		}
 
-		if _, exists := c.Cfg.Administrators.IDsInMap[int(ctx.Message.From.Id)]; exists {
+		if c.can(ctx.Message.From.Id, permSchedule) {
 			_, err = bot.SendMessage(ctx.Message.Chat.Id,
 				fmt.Sprintf("Приветствую %s. Вы уже успели ознакомится со списком докладов ? Если нет, то крайне рекомендую, сегодня выступают отличные спикеры!", user.Identification),
 				&gotgbot.SendMessageOpts{
 					ParseMode:   html,
-					ReplyMarkup: mainMenuAdminKB(),
+					ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
 				})
 
 			if err != nil {
@@ -133,7 +116,7 @@ func (c *Client) startHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				fmt.Sprintf("Приветствую %s. Вы уже успели ознакомится со списком докладов ? Если нет, то крайне рекомендую! В нашей программе выступают только отличные спикеры!", user.Identification),
 				&gotgbot.SendMessageOpts{
 					ParseMode:   html,
-					ReplyMarkup: mainMenuUserKB(),
+					ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
 				})
 
 			if err != nil {
@@ -154,7 +137,7 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return err
 	}
 
-	switch state {
+	switch state.Name {
 
 	case start:
 		if strings.HasPrefix(ctx.EffectiveMessage.Text, "/") {
@@ -169,31 +152,29 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 			return nil
 		}
 
-		coll := c.Database.Collection("user")
-
-		err = c.Database.InsertOne(coll, models.User{
-			TgID: int(ctx.EffectiveUser.Id), Identification: ctx.EffectiveMessage.Text, FavoriteReports: []models.Report{}, ChatID: int(ctx.EffectiveChat.Id)})
+		err = c.Database.InsertUser(models.User{
+			TgID: int(ctx.EffectiveUser.Id), Identification: ctx.EffectiveMessage.Text, ChatID: int(ctx.EffectiveChat.Id)})
 
 		if err != nil {
 			return err
 		}
 
-		if err = c.FSM.SetState(ctx.EffectiveUser.Id, menu); err != nil {
+		if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
 			return err
 		}
 
-		user, errS := c.Database.SelectUser(coll, int(ctx.EffectiveUser.Id))
+		user, errS := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 
 		if errS != nil {
 			return errS
 		}
 
-		if _, exists := c.Cfg.Administrators.IDsInMap[int(ctx.Message.From.Id)]; exists {
+		if c.can(ctx.Message.From.Id, permSchedule) {
 			_, err = bot.SendMessage(ctx.Message.Chat.Id,
 				fmt.Sprintf("Добро пожаловать %s, я @%s. Сперва, загрузите, пожалуйста, расписание. Затем рекомендую поскорее ознакомиться с предстоящими докладами и добавить интересные из них в избранное. Я точно уверен, что ты найдёшь что-то для себя", user.Identification, bot.User.Username),
 				&gotgbot.SendMessageOpts{
 					ParseMode:   html,
-					ReplyMarkup: mainMenuAdminKB(),
+					ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
 				})
 
 			if err != nil {
@@ -205,7 +186,7 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				fmt.Sprintf("Добро пожаловать %s, я @%s. Рекомендую поскорее ознакомиться с предстоящими докладами и добавить интересные из них в избранное. Я точно уверен, что ты найдёшь что-то для себя", user.Identification, bot.User.Username),
 				&gotgbot.SendMessageOpts{
 					ParseMode:   html,
-					ReplyMarkup: mainMenuUserKB(),
+					ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
 				})
 
 			if err != nil {
@@ -214,36 +195,21 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 		}
 	case menu:
-		user, errS := c.Database.SelectUser(c.Database.Collection("user"), int(ctx.EffectiveUser.Id))
+		user, errS := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 
 		if errS != nil {
 			return errS
 		}
 
-		if _, exists := c.Cfg.Administrators.IDsInMap[int(ctx.Message.From.Id)]; exists {
-			_, err = bot.SendMessage(ctx.Message.Chat.Id,
-				fmt.Sprintf("%s, что привело вас вновь в главное меню? Вы уже успели посмотреть наши предстоящие доклады? Администраторы не успели загрузить расписание? ", user.Identification),
-				&gotgbot.SendMessageOpts{
-					ParseMode:   html,
-					ReplyMarkup: mainMenuAdminKB(),
-				})
-
-			if err != nil {
-				return err
-			}
-
-		} else {
-			_, err = bot.SendMessage(ctx.Message.Chat.Id,
-				fmt.Sprintf("%s, что привело вас вновь в главное меню? Вы уже успели посмотреть наши предстоящие доклады? Администраторы не успели загрузить расписание? ", user.Identification),
-				&gotgbot.SendMessageOpts{
-					ParseMode:   html,
-					ReplyMarkup: mainMenuUserKB(),
-				})
-
-			if err != nil {
-				return err
-			}
+		_, err = bot.SendMessage(ctx.Message.Chat.Id,
+			fmt.Sprintf("%s, что привело вас вновь в главное меню? Вы уже успели посмотреть наши предстоящие доклады? Администраторы не успели загрузить расписание? ", user.Identification),
+			&gotgbot.SendMessageOpts{
+				ParseMode:   html,
+				ReplyMarkup: c.mainMenuKB(ctx.Message.From.Id),
+			})
 
+		if err != nil {
+			return err
 		}
 	case updateIdentification:
 
@@ -259,16 +225,14 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 			return nil
 		}
 
-		coll := c.Database.Collection("user")
-
-		ok, errU := c.Database.UpdateUserID(coll, int(ctx.EffectiveUser.Id), ctx.EffectiveMessage.Text)
+		ok, errU := c.Database.UpdateUserID(int(ctx.EffectiveUser.Id), ctx.EffectiveMessage.Text)
 
 		if errU != nil {
 			return errU
 		}
 
 		if ok {
-			user, errS := c.Database.SelectUser(coll, int(ctx.EffectiveUser.Id))
+			user, errS := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 			if errS != nil {
 				return errS
 			}
@@ -279,74 +243,21 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				return err
 			}
 		}
-	case uploadSchedule, viewReports, userEvaluations:
+	case announceCreate, announceEdit:
+		return c.announceTextHandler(bot, ctx, state)
+	case askQuestion:
+		return c.questionTextHandler(bot, ctx, state)
+	case pollCreate:
+		return c.pollTextHandler(bot, ctx, state)
+	case uploadSchedule, uploadQuestionnaire, viewReports, userEvaluations, announcements, questions, questionBoard:
 		_, errD := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
 		if errD != nil {
 			return errD
 		}
 	default:
-		if len(strings.Split(state, ";")) == 5 && strings.Split(state, ";")[0] == evaluateReport {
-
-			stateSeparated := strings.Split(state, ";")
-			text := ctx.EffectiveMessage.Text
-			evaluation := models.Evaluation{URL: stateSeparated[1], TgID: int(ctx.Message.From.Id),
-				Content: stateSeparated[len(stateSeparated)-2], Performance: stateSeparated[len(stateSeparated)-1],
-				Comment: text}
-
-			if err = c.Database.InsertOne(c.Database.Collection("evaluation"), evaluation); err != nil {
-				return err
-			}
-
-			_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Ваш отзыв успешно добавлен!", &gotgbot.SendMessageOpts{
-				ReplyMarkup: evaluationEndKB(),
-				ParseMode:   html,
-			})
-
-			if err != nil {
-				return err
-			}
-		}
-
-		if len(strings.Split(state, ";")) == 4 && strings.Split(state, ";")[0] == updateEvaluation {
-
-			stateSeparated := strings.Split(state, ";")
-
-			text := ctx.EffectiveMessage.Text
-
-			evaluation := models.Evaluation{URL: stateSeparated[1], TgID: int(ctx.Message.From.Id),
-				Content: stateSeparated[2], Performance: stateSeparated[3],
-				Comment: text}
-
-			upd, errU := c.Database.UpdateEvaluation(c.Database.Collection("evaluation"), int(ctx.Message.From.Id), stateSeparated[1], evaluation)
-
-			if errU != nil {
-				return errU
-			}
-
-			err = c.FSM.SetState(ctx.Message.From.Id, updateComment)
-
-			if err != nil {
-				return err
-			}
-
-			if upd {
-				_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Ваш отзыв успешно обновлён!", &gotgbot.SendMessageOpts{
-					ReplyMarkup: evaluationEndKB(),
-					ParseMode:   html,
-				})
-				if err != nil {
-					return err
-				}
-			} else {
-				_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Ваш отзыв ни чем не отличается от прошлого! Поэтому я его не обновил", &gotgbot.SendMessageOpts{
-					ReplyMarkup: evaluationEndKB(),
-					ParseMode:   html,
-				})
-				if err != nil {
-					return err
-				}
-			}
+		if c.conversations.Active(state) {
+			return c.conversations.MessageHandler(bot, ctx, state)
 		}
 	}
 
@@ -355,16 +266,19 @@ func (c *Client) textHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 func (c *Client) confInfoCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	err := c.FSM.SetState(ctx.EffectiveUser.Id, confInfo)
+	err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: confInfo})
 	if err != nil {
 		return err
 	}
 
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
 	cb := ctx.Update.CallbackQuery
 
-	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("📅 О конференции\n\n🎉 Название: %s\n🌐 Сайт: %s\n\n🕒 Время начала: %s\n🕙 Время окончания: %s\n\n",
-		c.Cfg.Conference.Name, c.Cfg.Conference.URL, time.Time(c.Cfg.Conference.TimeFrom).Format("02.01.2006 15:04"),
-		time.Time(c.Cfg.Conference.TimeUntil).Format("02.01.2006 15:04")),
+	_, _, err = cb.Message.EditText(bot, formatConference(conference),
 		&gotgbot.EditMessageTextOpts{ParseMode: html, ReplyMarkup: backToMainMenuKB()})
 
 	if err != nil {
@@ -376,7 +290,7 @@ func (c *Client) confInfoCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 func (c *Client) backCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	err := c.FSM.SetState(ctx.EffectiveUser.Id, menu)
+	err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu})
 
 	if err != nil {
 		return err
@@ -384,24 +298,12 @@ func (c *Client) backCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	cb := ctx.Update.CallbackQuery
 
-	if _, exists := c.Cfg.Administrators.IDsInMap[int(cb.From.Id)]; exists {
-		_, _, err = cb.Message.EditText(bot,
-			"Вы вернулись в главное меню. Как удобно, что я обрабатываю все ваши сценрии использования этого бота. Если вам нужна помощь по использованию бота - /help",
-			&gotgbot.EditMessageTextOpts{ParseMode: html, ReplyMarkup: mainMenuAdminKB()})
-
-		if err != nil {
-			return err
-		}
-
-	} else {
-		_, _, err = cb.Message.EditText(bot,
-			"Вы вернулись в главное меню. Как удобно, что я обрабатываю все ваши сценрии использования этого бота. Если вам нужна помощь по использованию бота - /help",
-			&gotgbot.EditMessageTextOpts{ParseMode: html, ReplyMarkup: mainMenuUserKB()})
-
-		if err != nil {
-			return err
-		}
+	_, _, err = cb.Message.EditText(bot,
+		"Вы вернулись в главное меню. Как удобно, что я обрабатываю все ваши сценрии использования этого бота. Если вам нужна помощь по использованию бота - /help",
+		&gotgbot.EditMessageTextOpts{ParseMode: html, ReplyMarkup: c.mainMenuKB(cb.From.Id)})
 
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -409,7 +311,7 @@ func (c *Client) backCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 func (c *Client) uploadScheduleCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	err := c.FSM.SetState(ctx.EffectiveUser.Id, uploadSchedule)
+	err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: uploadSchedule})
 
 	if err != nil {
 		return err
@@ -434,7 +336,11 @@ func getFormatReports(data []models.Report) string {
 	var reports string
 
 	for ind, report := range data {
-		reports += fmt.Sprintf("%v. %v время начала: %v\n\n%s - %s\n\n", ind+1, report.StartTime.Format("02.01.2006"), report.StartTime.Format("15:04"), report.Speakers, report.Title)
+		room := ""
+		if report.Room != "" {
+			room = fmt.Sprintf(", зал: %s", report.Room)
+		}
+		reports += fmt.Sprintf("%v. %v время начала: %v%s\n\n%s - %s\n\n", ind+1, report.StartTime.Format("02.01.2006"), report.StartTime.Format("15:04"), room, report.Speakers, report.Title)
 	}
 
 	return reports
@@ -456,8 +362,26 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return err
 	}
 
-	switch state {
+	if c.conversations.Active(state) {
+		return c.conversations.MessageHandler(bot, ctx, state)
+	}
+
+	switch state.Name {
+	case uploadQuestionnaire:
+		if !c.can(ctx.EffectiveUser.Id, permReviews) {
+			return c.revoked(bot, ctx)
+		}
+		return c.questionnaireFileHandler(bot, ctx)
 	case uploadSchedule:
+		if !c.can(ctx.EffectiveUser.Id, permSchedule) {
+			return c.revoked(bot, ctx)
+		}
+
+		conference, errC := c.conference(ctx.EffectiveUser.Id)
+		if errC != nil {
+			return errC
+		}
+
 		fileExtension := strings.ToLower(filepath.Ext(ctx.EffectiveMessage.Document.FileName))
 		if fileExtension != ".csv" {
 			_, errSF := bot.SendMessage(ctx.EffectiveChat.Id, "Простите, но я работают исключительно с файлами в формате .csv", nil)
@@ -479,7 +403,7 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 		defer response.Body.Close()
 
 		scanner := bufio.NewScanner(response.Body)
-		var reports []interface{}
+		var reports []models.Report
 
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -495,12 +419,12 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				return errR
 			}
 
-			if len(record) != 5 {
-				_, errSL := bot.SendMessage(ctx.EffectiveChat.Id, "Длина каждой строки в файле должна быть равна 5!\n```\nStart (MSK Time Zone),Duration (min),Title,Speakers,URL\n```", nil)
+			if len(record) != 5 && len(record) != 6 {
+				_, errSL := bot.SendMessage(ctx.EffectiveChat.Id, "Длина каждой строки в файле должна быть равна 5 или 6!\n```\nStart (MSK Time Zone),Duration (min),Title,Speakers,URL[,Room]\n```", nil)
 				if errSL != nil {
 					return errSL
 				}
-				return fmt.Errorf("invalid line length: expected 5, got %v", len(record))
+				return fmt.Errorf("invalid line length: expected 5 or 6, got %v", len(record))
 			}
 
 			t, errT := time.Parse("02/01/2006 15:04:05", record[0])
@@ -512,8 +436,8 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				return errT
 			}
 
-			if t.Before(time.Time(c.Cfg.Conference.TimeFrom)) || time.Time(c.Cfg.Conference.TimeUntil).Before(t) {
-				_, errST := bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Время доклада \"%s\" не попадает в интервал с %s по %s", record[2], time.Time(c.Cfg.Conference.TimeFrom).Format("02.01.2006 15:04:05"), time.Time(c.Cfg.Conference.TimeUntil).Format("02.01.2006 15:04:05")), nil)
+			if t.Before(conference.TimeFrom) || conference.TimeUntil.Before(t) {
+				_, errST := bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Время доклада \"%s\" не попадает в интервал с %s по %s", record[2], conference.TimeFrom.Format("02.01.2006 15:04:05"), conference.TimeUntil.Format("02.01.2006 15:04:05")), nil)
 				if errST != nil {
 					return errST
 				}
@@ -532,41 +456,19 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 				Speakers:  record[3],
 				URL:       record[4],
 			}
+			if len(record) == 6 {
+				report.Room = record[5]
+			}
 			reports = append(reports, report)
 		}
 
-		isUpdated, isDeleted, errM := c.Database.InsertMany(c.Database.Collection("report"), reports)
+		changes, errM := c.Database.UpdateReports(conference.ID, reports)
 		if errM != nil {
 			return errM
 		}
 
-		if isUpdated || isDeleted {
-			var wg sync.WaitGroup
-			users, errS := c.Database.SelectUsers(c.Database.Collection("user"))
-			if errS != nil {
-				return errS
-			}
-
-			messageText := "Доклады были обновлены. Пожалуйста, ознакомьтесь с изменениями в \"👀 Посмотреть доклады\"\n\n*Скоро я удалю это сообшение*"
-			if isDeleted {
-				messageText = "Некоторые доклады были удалены. Пожалуйста, ознакомьтесь с изменённым списком докладов в \"👀 Посмотреть доклады\"\n\n*Скоро я удалю это сообшение*"
-			}
-
-			for _, user := range users {
-				if user.TgID != int(ctx.EffectiveUser.Id) {
-					msg, errSM := bot.SendMessage(ctx.EffectiveChat.Id, messageText, nil)
-					if errSM != nil {
-						return errSM
-					}
-					wg.Add(1)
-					go func(msg *gotgbot.Message) {
-						defer wg.Done()
-						time.Sleep(time.Second * 3)
-						bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-					}(msg)
-				}
-			}
-			wg.Wait()
+		if err = c.notifyScheduleChanges(changes); err != nil {
+			return err
 		}
 
 		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Ваше расписание успешно загружено!", &gotgbot.SendMessageOpts{
@@ -587,15 +489,80 @@ func (c *Client) fileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
+// notifyScheduleChanges alerts the users who favorited the changed reports about what exactly changed.
+// Cancelled reports are removed from the favorites.
+func (c *Client) notifyScheduleChanges(changes []models.ReportChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	users, err := c.Database.SelectUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		// Cancelled reports are already missing from the resolved favorite reports, so the references are checked.
+		favReports := make(map[models.ReportRef]bool, len(user.Favorites))
+		for _, ref := range user.Favorites {
+			favReports[ref] = true
+		}
+
+		var text string
+
+		for _, change := range changes {
+			if favReports[change.Previous.Ref()] {
+				text += formatReportChange(change)
+			}
+		}
+
+		if text != "" {
+			c.Sender.SendText(int64(user.ChatID), fmt.Sprintf("В расписании изменились доклады из вашего избранного:\n\n%s", text), nil)
+		}
+	}
+
+	for _, change := range changes {
+		if change.Cancelled {
+			if err = c.Database.RemoveFavReportFromAll(change.Previous.ConferenceID, change.Previous.URL); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatReportChange returns a human-readable description of a report change.
+func formatReportChange(change models.ReportChange) string {
+	old := change.Previous
+
+	if change.Cancelled {
+		return fmt.Sprintf("❌ \"%s\" (%s) отменён, я убрал его из избранного\n\n", old.Title, old.Speakers)
+	}
+
+	text := fmt.Sprintf("✏️ \"%s\" (%s)\n", old.Title, old.Speakers)
+
+	if change.TitleChanged {
+		text += fmt.Sprintf("Новое название: \"%s\"\n", change.Current.Title)
+	}
+
+	if change.TimeMoved {
+		text += fmt.Sprintf("Время: %s, %v м → %s, %v м\n", old.StartTime.Format("02.01 15:04"), old.Duration,
+			change.Current.StartTime.Format("02.01 15:04"), change.Current.Duration)
+	}
+
+	return text + "\n"
+}
+
 func (c *Client) changeIdentificationCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	err := c.FSM.SetState(ctx.EffectiveUser.Id, updateIdentification)
+	err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: updateIdentification})
 
 	if err != nil {
 		return err
 	}
 
-	user, err := c.Database.SelectUser(c.Database.Collection("user"), int(ctx.EffectiveUser.Id))
+	user, err := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 
 	if err != nil {
 		return err
@@ -624,15 +591,48 @@ func (c *Client) indexHandlerCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 	return nil
 }
 
+// reportCardCBHandler shows the card of a report of the schedule and records that the user viewed the report.
+func (c *Client) reportCardCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+
+	report, err := c.callbackReport(cb)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Этого доклада уже нет в расписании"})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = c.Database.AddReportView(int(cb.From.Id), report.ConferenceID, report.URL); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("%s - %s\n\n%s в %s, %d минут", report.Speakers, report.Title,
+		report.StartTime.Format("02.01.2006"), report.StartTime.Format("15:04"), report.Duration)
+	if report.Room != "" {
+		text += fmt.Sprintf(", зал: %s", report.Room)
+	}
+
+	_, _, err = cb.Message.EditText(bot, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: reportCardKB(report)})
+
+	return ignoreNotModified(err)
+}
+
 func (c *Client) viewReportsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	err := c.FSM.SetState(ctx.EffectiveUser.Id, viewReports)
+	err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: viewReports})
 
 	if err != nil {
 		return err
 	}
 
-	data, err := c.Database.SelectReports(c.Database.Collection("report"))
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	data, err := c.Database.SelectReports(conference.ID)
 
 	if err != nil {
 		return err
@@ -642,27 +642,27 @@ func (c *Client) viewReportsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 
 	reportsFormat := getFormatReports(data)
 
-	reports, err := c.Database.SelectReports(c.Database.Collection("report"))
+	reports, err := c.Database.SelectReports(conference.ID)
 
 	if err != nil {
 
 		return err
 	}
 
-	user, err := c.Database.SelectUser(c.Database.Collection("user"), int(ctx.EffectiveUser.Id))
+	user, err := c.Database.SelectUser(int(ctx.EffectiveUser.Id))
 
 	if err != nil {
 		return err
 	}
 
-	evaluations, err := c.Database.SelectEvaluations(c.Database.Collection("evaluation"), int(cb.From.Id))
+	evaluations, err := c.Database.SelectEvaluations(int(cb.From.Id), conference.ID)
 
 	if err != nil {
 		return err
 	}
 
 	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Доступные доклады:\n\n%s", reportsFormat), &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations),
+		ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations, c.now()),
 	})
 
 	if err != nil {
@@ -677,7 +677,12 @@ func (c *Client) addToFavoriteCBHandler(bot *gotgbot.Bot, ctx *ext.Context) erro
 
 	cb := ctx.Update.CallbackQuery
 
-	reports, err := c.Database.SelectReports(c.Database.Collection("report"))
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return err
+	}
+
+	reports, err := c.Database.SelectReports(conference.ID)
 
 	if err != nil {
 		return err
@@ -685,26 +690,26 @@ func (c *Client) addToFavoriteCBHandler(bot *gotgbot.Bot, ctx *ext.Context) erro
 
 	for _, report := range reports {
 		if report.URL == strings.Split(cb.Data, ";")[1] {
-			err = c.Database.AddUserFavReports(c.Database.Collection("user"), int(cb.From.Id), report)
+			err = c.Database.AddUserFavReport(int(cb.From.Id), conference.ID, report.URL)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	user, err := c.Database.SelectUser(c.Database.Collection("user"), int(cb.From.Id))
+	user, err := c.Database.SelectUser(int(cb.From.Id))
 
 	if err != nil {
 		return err
 	}
 
-	evaluations, err := c.Database.SelectEvaluations(c.Database.Collection("evaluation"), int(cb.From.Id))
+	evaluations, err := c.Database.SelectEvaluations(int(cb.From.Id), conference.ID)
 
 	if err != nil {
 		return err
 	}
 
-	if _, _, err = cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations)}); err != nil {
+	if _, _, err = cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations, c.now())}); err != nil {
 		return err
 	}
 
@@ -719,7 +724,12 @@ func (c *Client) removeFromFavoriteCBHandler(bot *gotgbot.Bot, ctx *ext.Context)
 
 	cb := ctx.Update.CallbackQuery
 
-	reports, err := c.Database.SelectReports(c.Database.Collection("report"))
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return err
+	}
+
+	reports, err := c.Database.SelectReports(conference.ID)
 
 	if err != nil {
 
@@ -728,26 +738,26 @@ func (c *Client) removeFromFavoriteCBHandler(bot *gotgbot.Bot, ctx *ext.Context)
 
 	for _, report := range reports {
 		if report.URL == strings.Split(cb.Data, ";")[1] {
-			err = c.Database.RemoveUserFavReport(c.Database.Collection("user"), int(cb.From.Id), report.URL)
+			err = c.Database.RemoveUserFavReport(int(cb.From.Id), conference.ID, report.URL)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	user, err := c.Database.SelectUser(c.Database.Collection("user"), int(cb.From.Id))
+	user, err := c.Database.SelectUser(int(cb.From.Id))
 
 	if err != nil {
 		return err
 	}
 
-	evaluations, err := c.Database.SelectEvaluations(c.Database.Collection("evaluation"), int(cb.From.Id))
+	evaluations, err := c.Database.SelectEvaluations(int(cb.From.Id), conference.ID)
 
 	if err != nil {
 		return err
 	}
 
-	if _, _, err = cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations)}); err != nil {
+	if _, _, err = cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{ReplyMarkup: reportsWithFavoriteKB(reports, user, evaluations, c.now())}); err != nil {
 		return err
 	}
 
@@ -780,19 +790,17 @@ func (c *Client) threePointsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 
 func (c *Client) photoHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+	state, err := c.FSM.GetState(ctx.EffectiveUser.Id)
 
 	if err != nil {
-
 		return err
 	}
 
-	return nil
-}
-
-func (c *Client) audioHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if c.conversations.Active(state) {
+		return c.conversations.MessageHandler(bot, ctx, state)
+	}
 
-	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+	_, err = bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
 	if err != nil {
 
@@ -802,19 +810,27 @@ func (c *Client) audioHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func (c *Client) videoHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+// unsupportedMessage passes a message of a kind no flow takes, e.g. a sticker, to the active conversation of the user,
+// so a step expecting a message tells the user what it takes. It reports whether the user is in a conversation.
+func (c *Client) unsupportedMessage(bot *gotgbot.Bot, ctx *ext.Context) (bool, error) {
 
+	state, err := c.FSM.GetState(ctx.EffectiveUser.Id)
 	if err != nil {
+		return false, err
+	}
 
-		return err
+	if !c.conversations.Active(state) {
+		return false, nil
 	}
 
-	return nil
+	return true, c.conversations.MessageHandler(bot, ctx, state)
 }
 
-func (c *Client) mediaGroupHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (c *Client) audioHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if active, err := c.unsupportedMessage(bot, ctx); active || err != nil {
+		return err
+	}
 
 	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
@@ -826,7 +842,11 @@ func (c *Client) mediaGroupHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func (c *Client) storyHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (c *Client) videoHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if active, err := c.unsupportedMessage(bot, ctx); active || err != nil {
+		return err
+	}
 
 	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
@@ -838,7 +858,11 @@ func (c *Client) storyHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func (c *Client) videoNoteHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (c *Client) mediaGroupHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if active, err := c.unsupportedMessage(bot, ctx); active || err != nil {
+		return err
+	}
 
 	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
@@ -850,11 +874,11 @@ func (c *Client) videoNoteHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func (c *Client) notEvaluateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (c *Client) storyHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	cb := ctx.Update.CallbackQuery
+	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
-	if _, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Вы пока не можете оценить этот доклад"}); err != nil {
+	if err != nil {
 
 		return err
 	}
@@ -862,526 +886,80 @@ func (c *Client) notEvaluateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error
 	return nil
 }
 
-func (c *Client) evaluateReportCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	url := strings.Split(cb.Data, ";")[1]
+func (c *Client) videoNoteHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
-	report, err := c.Database.SelectReport(c.Database.Collection("report"), url)
-	if err != nil {
+	if active, err := c.unsupportedMessage(bot, ctx); active || err != nil {
 		return err
 	}
 
-	text := fmt.Sprintf("Вы оцениваете следующий доклад:\n\n%s - %s\n\nКакую оценку вы бы поставили за содержание доклада:", report.Speakers, report.Title)
-	_, _, err = cb.Message.EditText(bot, text,
-		&gotgbot.EditMessageTextOpts{
-			ReplyMarkup: evaluateKB(),
-		})
+	_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
 
 	if err != nil {
-		return err
-	}
 
-	if err = c.FSM.SetState(cb.From.Id, fmt.Sprintf("evaluateReport;%s;%s", url, text)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *Client) evaluationBeginCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+func (c *Client) downloadReviewsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	cb := ctx.Update.CallbackQuery
 
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	stateSeparated := strings.Split(state, ";")
+	_, _, err := cb.Message.EditText(bot, "В каком формате выгрузить отзывы? CSV и XLSX открываются в таблицах. CSV содержит только отзывы, XLSX — также сводку по каждому докладу, вопросы и опросы, JSON — всё вместе",
+		&gotgbot.EditMessageTextOpts{ReplyMarkup: reviewsFormatKB()})
 
-	_, _, err = cb.Message.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{
-		ReplyMarkup: contentKB(stateSeparated[1]),
-	})
+	return err
+}
 
-	if err != nil {
-		return err
+// reviewsCaption returns the caption of the reviews file describing what it holds.
+func reviewsCaption(name string) string {
+	if filepath.Ext(name) == "."+formatCSV {
+		return "Все отзывы на доклады конференции. Сводка, вопросы и опросы есть в XLSX и JSON"
 	}
-
-	return nil
+	return "Все отзывы на доклады конференции со сводкой по каждому докладу, вопросы слушателей и опросы"
 }
 
-func (c *Client) contentCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+// downloadReviewsFileCBHandler sends the reviews of the conference in the chosen format, the file is deleted after a minute.
+func (c *Client) downloadReviewsFileCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
 
 	cb := ctx.Update.CallbackQuery
 
-	markForContent := strings.Split(cb.Data, ";")[1]
-
-	_, _, err := cb.Message.EditText(bot, "Какую бы оценку вы поставили за выступление:", &gotgbot.EditMessageTextOpts{
-		ParseMode:   html,
-		ReplyMarkup: performanceKB(),
-	})
-
+	conference, err := c.conference(cb.From.Id)
 	if err != nil {
 		return err
 	}
 
-	state, err := c.FSM.GetState(cb.From.Id)
-
+	export, err := c.reviews(conference)
 	if err != nil {
 		return err
 	}
 
-	if err = c.FSM.SetState(cb.From.Id, fmt.Sprintf("%s;%s", state, markForContent)); err != nil {
+	location, err := time.LoadLocation(c.Cfg.Export.TimeZone)
+	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func (c *Client) backToContentCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
+	data, name, err := export.encode(strings.TrimPrefix(cb.Data, downloadReviews+";"), location)
 	if err != nil {
-
+		return err
 	}
 
-	stateSeparated := strings.Split(state, ";")
+	if _, err = cb.Answer(bot, nil); err != nil {
+		return err
+	}
 
-	if stateSeparated[0] == evaluateReport {
+	msg, err := bot.SendDocument(cb.From.Id, gotgbot.NamedFile{File: bytes.NewReader(data), FileName: name},
+		&gotgbot.SendDocumentOpts{Caption: reviewsCaption(name)})
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
+	time.AfterFunc(time.Minute, func() {
+		if _, errD := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil); errD != nil {
+			fmt.Println(errD)
 		}
-
-		_, _, err = cb.Message.EditText(bot, stateSeparated[2], &gotgbot.EditMessageTextOpts{
-			ChatId:      ctx.EffectiveChat.Id,
-			MessageId:   ctx.EffectiveMessage.MessageId,
-			ReplyMarkup: evaluateKB(),
-		})
-
-		if err != nil {
-			return err
-		}
-
-		err = c.FSM.SetState(cb.From.Id, strings.Join(stateSeparated[:3], ";")+";")
-
-		if err != nil {
-			return err
-		}
-
-	}
-
-	return nil
-}
-
-func (c *Client) performanceCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	markPerformance := strings.Split(cb.Data, ";")[1]
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	errS := c.FSM.SetState(cb.From.Id, fmt.Sprintf("%s;%s", state, markPerformance))
-
-	if errS != nil {
-		return errS
-	}
-
-	_, _, err = cb.Message.EditText(bot, "Введите дополнительный комментарий или нажмите на кнопку \"Далее\"", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: commentKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) evaluateEndNoCommentCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-	cb := ctx.Update.CallbackQuery
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	stateSeparated := strings.Split(state, ";")
-
-	evaluation := models.Evaluation{URL: stateSeparated[1], TgID: int(cb.From.Id),
-		Content: stateSeparated[len(stateSeparated)-2], Performance: stateSeparated[len(stateSeparated)-1]}
-	if err = c.Database.InsertOne(c.Database.Collection("evaluation"), evaluation); err != nil {
-		return err
-	}
-	_, _, err = cb.Message.EditText(bot, "Ваш отзыв успешно добавлен!", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: evaluationEndKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) noWishToEvaluateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	stateSeparated := strings.Split(state, ";")
-
-	evaluation := models.Evaluation{URL: stateSeparated[1], TgID: int(cb.From.Id),
-		Content: cb.Data}
-
-	if err = c.Database.InsertOne(c.Database.Collection("evaluation"), evaluation); err != nil {
-		return err
-	}
-
-	_, _, err = cb.Message.EditText(bot, "Спасибо за вашу обратную связь! Помните: вы всегда можете изменить свой отзыв", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: evaluationEndKB(),
 	})
 
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) noEvaluateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	stateSeparated := strings.Split(state, ";")
-
-	evaluation := models.Evaluation{URL: stateSeparated[1], TgID: int(cb.From.Id),
-		Content: cb.Data}
-
-	if err = c.Database.InsertOne(c.Database.Collection("evaluation"), evaluation); err != nil {
-		return err
-	}
-
-	_, _, err = cb.Message.EditText(bot, "Спасибо за ваш отзыв, вдруг что, вы всегда можете его изменить", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: evaluationEndKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) userEvaluationsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	err := c.FSM.SetState(cb.From.Id, userEvaluations)
-
-	if err != nil {
-		return err
-	}
-
-	evaluations, err := c.Database.SelectEvaluations(c.Database.Collection("evaluation"), int(cb.From.Id))
-
-	var text string
-
-	reports, err := c.Database.SelectReports(c.Database.Collection("report"))
-
-	evaluationsMap := make(map[string]models.Evaluation, len(evaluations))
-
-	for _, evaluation := range evaluations {
-		if _, exists := evaluationsMap[evaluation.URL]; !exists {
-			evaluationsMap[evaluation.URL] = evaluation
-		}
-	}
-
-	if err != nil {
-		return err
-	}
-
-	for ind, report := range reports {
-		if _, exists := evaluationsMap[report.URL]; exists {
-			text += fmt.Sprintf("%v. %s - %s\n\nСодержание: \"%s\"\nВыступление: \"%s\"\nКомментарий: \"%s\"\n\n", ind+1,
-				report.Speakers, report.Title, evaluationsMap[report.URL].Content, evaluationsMap[report.URL].Performance, evaluationsMap[report.URL].Comment)
-		}
-	}
-
-	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Ваши отзывы:\n\n%s", text), &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: userEvaluationsKB(reports, evaluationsMap),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) updateEvaluationCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	cbSeparated := strings.Split(cb.Data, ";")
-
-	url := cbSeparated[1]
-
-	report, err := c.Database.SelectReport(c.Database.Collection("report"), url)
-
-	if err != nil {
-		return err
-	}
-
-	err = c.FSM.SetState(cb.From.Id, fmt.Sprintf("%s;%s", cbSeparated[0], url))
-
-	if err != nil {
-		return err
-	}
-
-	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Выберите оценку:\n\n%s - %s", report.Speakers, report.Title), &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: contentUpdateKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) deleteEvaluationCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	cbSeparated := strings.Split(cb.Data, ";")
-
-	err := c.FSM.SetState(cb.From.Id, cbSeparated[0])
-
-	if err != nil {
-		return err
-	}
-
-	url := cbSeparated[1]
-
-	deleted, err := c.Database.DeleteEvaluation(c.Database.Collection("evaluation"), int(cb.From.Id), url)
-
-	if err != nil {
-		return err
-	}
-
-	if deleted {
-		_, _, err = cb.Message.EditText(bot, "Ваш отзыв удалён! Если передумайте, то всегда можете написать новый", &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: evaluationEndKB(),
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (c *Client) updateContentCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	cbSeparated := strings.Split(cb.Data, ";")
-
-	content := cbSeparated[1]
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	err = c.FSM.SetState(cb.From.Id, fmt.Sprintf("%s;%s", state, content))
-
-	_, _, err = cb.Message.EditText(bot, "Введи вашу оценку за выступление: ", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: performanceUpdateKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) updatePerformanceCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	cbSeparated := strings.Split(cb.Data, ";")
-
-	content := cbSeparated[1]
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	err = c.FSM.SetState(cb.From.Id, fmt.Sprintf("%s;%s", state, content))
-
-	_, _, err = cb.Message.EditText(bot, "Введите дополнительный комментарий или нажмите на кнопку \"Далее\"", &gotgbot.EditMessageTextOpts{
-		ReplyMarkup: commentUpdateKB(),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (c *Client) updateWithNoCommentCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	state, err := c.FSM.GetState(cb.From.Id)
-
-	if err != nil {
-		return err
-	}
-
-	stateSeparated := strings.Split(state, ";")
-
-	evaluation := models.Evaluation{
-		Content: stateSeparated[2], Performance: stateSeparated[3],
-	}
-
-	upd, err := c.Database.UpdateEvaluation(c.Database.Collection("evaluation"), int(cb.From.Id), stateSeparated[1], evaluation)
-
-	if upd {
-		_, _, err = cb.Message.EditText(bot, "Ваш отзыв успешно обновлён!", &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: evaluationEndKB(),
-		})
-
-		if err != nil {
-			return err
-		}
-	} else {
-		_, _, err = cb.Message.EditText(bot, "Обновление не случилось. Скорее всего вы ввели такие же оценки", &gotgbot.EditMessageTextOpts{
-			ReplyMarkup: evaluationEndKB(),
-		})
-
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (c *Client) downloadReviewsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
-
-	cb := ctx.Update.CallbackQuery
-
-	reports, err := c.Database.SelectReports(c.Database.Collection("report"))
-
-	if err != nil {
-		return err
-	}
-
-	evaluations, err := c.Database.SelectAllEvaluations(c.Database.Collection("evaluation"))
-
-	if err != nil {
-		return err
-	}
-
-	evaluationsMap := make(map[string]models.Evaluation, len(evaluations))
-
-	for _, evaluation := range evaluations {
-		if _, exists := evaluationsMap[evaluation.URL]; !exists {
-			evaluationsMap[evaluation.URL] = evaluation
-		}
-	}
-
-	var actualEvaluations []models.Evaluation
-
-	for _, report := range reports {
-		if evaluation, exists := evaluationsMap[report.URL]; exists {
-			actualEvaluations = append(actualEvaluations, evaluation)
-		}
-	}
-
-	jsonData, err := json.Marshal(actualEvaluations)
-
-	if err != nil {
-		return err
-	}
-
-	file, err := os.Create(dataJSON)
-
-	if err != nil {
-		return err
-	}
-
-	_, err = file.Write(jsonData)
-
-	if err != nil {
-		return err
-	}
-
-	err = file.Close()
-
-	if err != nil {
-		return err
-	}
-
-	file, err = os.Open(dataJSON)
-
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		err = os.Remove(file.Name())
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
-	var wg sync.WaitGroup
-	msg, err := bot.SendDocument(cb.From.Id, file, &gotgbot.SendDocumentOpts{Caption: "Отзывы для текущих докладов"})
-
-	if err != nil {
-		return err
-	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		time.Sleep(60 * time.Second)
-		_, err = bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-		if err != nil {
-			fmt.Println(err)
-		}
-	}()
-
-	wg.Wait()
 	return nil
 }
@@ -2,14 +2,15 @@ package handlers
 
 import (
 	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"strconv"
 	"time"
 )
 
-// mainMenuAdminKB returns the main menu keyboard for admin users.
-func mainMenuAdminKB() gotgbot.InlineKeyboardMarkup {
+// mainMenuKB returns the main menu keyboard, the buttons of the staff are shown only if allowed reports their permissions.
+func mainMenuKB(allowed func(permission string) bool) gotgbot.InlineKeyboardMarkup {
 	kb := [][]gotgbot.InlineKeyboardButton{
 		{
 			{Text: "📋 Информация о конференции", CallbackData: confInfo},
@@ -20,27 +21,180 @@ func mainMenuAdminKB() gotgbot.InlineKeyboardMarkup {
 		{
 			{Text: "📝 Редактировать идентификацию", CallbackData: updateIdentification},
 		},
+	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "❓ Вопросы спикерам", CallbackData: questions}})
+	kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "🏁 Оценить конференцию", CallbackData: conferenceSurvey}})
+
+	if allowed(permTalks) {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "🎤 Мои доклады", CallbackData: myTalks}})
+	}
+
+	staff := []struct {
+		permission string
+		button     gotgbot.InlineKeyboardButton
+	}{
+		{permSchedule, gotgbot.InlineKeyboardButton{Text: "📥 Загрузить расписание", CallbackData: uploadSchedule}},
+		{permReviews, gotgbot.InlineKeyboardButton{Text: "📂 Выгрузить файл с оценками", CallbackData: downloadReviews}},
+		{permReviews, gotgbot.InlineKeyboardButton{Text: "📝 Анкета отзыва", CallbackData: uploadQuestionnaire}},
+		{permReviews, gotgbot.InlineKeyboardButton{Text: "🏁 Выгрузить опрос о конференции", CallbackData: downloadSurveys}},
+		{permBroadcast, gotgbot.InlineKeyboardButton{Text: "📣 Сделать рассылку", CallbackData: broadcast}},
+		{permAnnounce, gotgbot.InlineKeyboardButton{Text: "🗓 Запланированные объявления", CallbackData: announcements}},
+	}
+
+	for _, item := range staff {
+		if allowed(item.permission) {
+			kb = append(kb, []gotgbot.InlineKeyboardButton{item.button})
+		}
+	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{
+		{Text: "🎪 Конференции", CallbackData: conferences},
+	})
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// myTalksKB returns a keyboard with a button for the feedback of each report of a speaker.
+func myTalksKB(reports []models.Report) gotgbot.InlineKeyboardMarkup {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	for _, report := range reports {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: report.Title, CallbackData: fmt.Sprintf("%s;%s", myTalk, report.URL)},
+		})
+	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "⬅️ Назад", CallbackData: back}})
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// backToMyTalksKB returns a keyboard with a button to go back to the reports of a speaker.
+func backToMyTalksKB() gotgbot.InlineKeyboardMarkup {
+	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "📥 Загрузить расписание", CallbackData: uploadSchedule},
+			{Text: "⬅️ К моим докладам", CallbackData: myTalks},
 		},
+	}
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// questionReportsKB returns a keyboard with a button for the question list of each report, running reports are marked.
+func questionReportsKB(reports []models.Report, running map[string]bool) gotgbot.InlineKeyboardMarkup {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	for _, report := range reports {
+		text := report.Title
+		if running[report.URL] {
+			text = fmt.Sprintf("🔴 %s", report.Title)
+		}
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: text, CallbackData: fmt.Sprintf("%s;%s", questionReport, report.URL)},
+		})
+	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "⬅️ Назад", CallbackData: back}})
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// questionButtons returns the rows of numbered buttons for the unanswered questions, five in a row.
+func questionButtons(questionList []models.Question, label, action string) [][]gotgbot.InlineKeyboardButton {
+	var kb [][]gotgbot.InlineKeyboardButton
+	var row []gotgbot.InlineKeyboardButton
+
+	for ind, question := range questionList {
+		if question.Answered {
+			continue
+		}
+		row = append(row, gotgbot.InlineKeyboardButton{Text: fmt.Sprintf("%s %v", label, ind+1), CallbackData: fmt.Sprintf("%s;%s", action, question.ID)})
+		if len(row) == 5 {
+			kb, row = append(kb, row), nil
+		}
+	}
+
+	if len(row) != 0 {
+		kb = append(kb, row)
+	}
+
+	return kb
+}
+
+// questionListKB returns the keyboard of the question list of a report for the audience: upvotes and, while the report is running, asking.
+func questionListKB(report models.Report, questionList []models.Question, running bool) gotgbot.InlineKeyboardMarkup {
+	kb := questionButtons(questionList, "👍", upvoteQuestion)
+
+	if running {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{{Text: "✍️ Задать вопрос", CallbackData: fmt.Sprintf("%s;%s", askQuestion, report.URL)}})
+	}
+
+	kb = append(kb,
+		[]gotgbot.InlineKeyboardButton{{Text: "🔄 Обновить", CallbackData: fmt.Sprintf("%s;%s", questionReport, report.URL)}},
+		[]gotgbot.InlineKeyboardButton{{Text: "⬅️ К докладам", CallbackData: questions}},
+	)
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// questionBoardKB returns the keyboard of the question board of a report for its speakers and the moderators.
+func questionBoardKB(report models.Report, questionList []models.Question) gotgbot.InlineKeyboardMarkup {
+	kb := questionButtons(questionList, "✅", answerQuestion)
+
+	kb = append(kb,
+		[]gotgbot.InlineKeyboardButton{{Text: "📊 Запустить опрос", CallbackData: fmt.Sprintf("%s;%s", pollCreate, report.URL)}},
+		[]gotgbot.InlineKeyboardButton{{Text: "🔄 Обновить", CallbackData: fmt.Sprintf("%s;%s", questionReport, report.URL)}},
+		[]gotgbot.InlineKeyboardButton{{Text: "⬅️ К докладам", CallbackData: questions}},
+	)
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// pollVoteKB returns a keyboard with a button for each option of the poll.
+func pollVoteKB(poll models.Poll) gotgbot.InlineKeyboardMarkup {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	for ind, option := range poll.Options {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: option, CallbackData: fmt.Sprintf("%s;%s;%d", pollVote, poll.ID, ind)},
+		})
+	}
+
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// pollResultsKB returns the keyboard of the live results of the poll with a button for closing it while it is open.
+func pollResultsKB(poll models.Poll) gotgbot.InlineKeyboardMarkup {
+	if poll.Closed {
+		return gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{}}
+	}
+
+	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "📂 Выгрузить файл с оценками", CallbackData: downloadReviews},
+			{Text: "⏹ Завершить опрос", CallbackData: fmt.Sprintf("%s;%s", pollClose, poll.ID)},
 		},
 	}
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// mainMenuUserKB returns the main menu keyboard for regular users.
-func mainMenuUserKB() gotgbot.InlineKeyboardMarkup {
+// backToQuestionsKB returns a keyboard with a button to go back to the question list of a report.
+func backToQuestionsKB(report models.Report) gotgbot.InlineKeyboardMarkup {
 	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "📋 Информация о конференции", CallbackData: confInfo},
+			{Text: "⬅️ К вопросам", CallbackData: fmt.Sprintf("%s;%s", questionReport, report.URL)},
 		},
+	}
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// reportCardKB returns a keyboard with the link to the report and a button to go back to the schedule.
+func reportCardKB(report models.Report) gotgbot.InlineKeyboardMarkup {
+	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "👀 Посмотреть доклады", CallbackData: viewReports},
+			{Text: "🔗 Открыть доклад", Url: report.URL},
 		},
 		{
-			{Text: "📝 Редактировать идентификацию", CallbackData: updateIdentification},
+			{Text: "⬅️ К докладам", CallbackData: viewReports},
 		},
 	}
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
@@ -67,7 +221,8 @@ func backToMainMenuAdminKB() gotgbot.InlineKeyboardMarkup {
 }
 
 // reportsWithFavoriteKB returns a keyboard with a list of reports, each report has buttons for adding to favorites and evaluating.
-func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluations []models.Evaluation) gotgbot.InlineKeyboardMarkup {
+// Reports that started before now can be evaluated.
+func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluations []models.Evaluation, now time.Time) gotgbot.InlineKeyboardMarkup {
 
 	if len(reports) == 0 {
 		kb := [][]gotgbot.InlineKeyboardButton{
@@ -89,6 +244,8 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 		println(err)
 	}
 
+	now = now.In(location).Truncate(time.Second)
+
 	reportURLs := make(map[string]bool, len(reports))
 	for _, report := range reports {
 		reportURLs[report.URL] = true
@@ -99,8 +256,6 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 
 			startTime := report.StartTime.Truncate(time.Second)
 
-			now := time.Now().In(location).Truncate(time.Second)
-
 			reportMSKTime := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), startTime.Hour(),
 				startTime.Minute(), startTime.Second(), startTime.Nanosecond(), location)
 
@@ -109,11 +264,11 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 
 			if reportMSKTime.Before(now) || startTime.Equal(now) {
 				evl = "🏆"
-				evlCB = fmt.Sprintf("%s;%s", evaluateReport, report.URL)
+				evlCB = reportCallback(evaluateReport, report)
 			}
 
 			kb = append(kb, []gotgbot.InlineKeyboardButton{
-				{Text: fmt.Sprintf("%v.", ind+1), CallbackData: "index"},
+				{Text: fmt.Sprintf("%v.", ind+1), CallbackData: reportCallback(reportCard, report)},
 				{Text: "⏳", CallbackData: "nothing", Url: report.URL},
 				{Text: fmt.Sprintf("%v м", strconv.Itoa(report.Duration)), Url: report.URL, CallbackData: "nothing"},
 				{Text: "⭐", CallbackData: fmt.Sprintf("add;%s", report.URL)},
@@ -132,11 +287,11 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 		}
 
 	} else {
-		favReports := make(map[string]bool, len(reports))
+		favReports := make(map[models.ReportRef]bool, len(reports))
 
 		for _, report := range user.FavoriteReports {
 
-			favReports[report.URL] = true
+			favReports[report.Ref()] = true
 
 		}
 
@@ -144,8 +299,6 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 
 			startTime := report.StartTime.Truncate(time.Second)
 
-			now := time.Now().In(location).Truncate(time.Second)
-
 			if err != nil {
 				fmt.Println(err)
 			}
@@ -153,7 +306,7 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 			reportMSKTime := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), startTime.Hour(),
 				startTime.Minute(), startTime.Second(), startTime.Nanosecond(), location)
 
-			_, isFav := favReports[report.URL]
+			_, isFav := favReports[report.Ref()]
 
 			favText := "⭐"
 
@@ -169,11 +322,11 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 
 			if reportMSKTime.Before(now) || startTime.Equal(now) {
 				evl = "🏆"
-				evlCB = fmt.Sprintf("%s;%s", evaluateReport, report.URL)
+				evlCB = reportCallback(evaluateReport, report)
 			}
 
 			kb = append(kb, []gotgbot.InlineKeyboardButton{
-				{Text: fmt.Sprintf("%v.", ind+1), CallbackData: "index"},
+				{Text: fmt.Sprintf("%v.", ind+1), CallbackData: reportCallback(reportCard, report)},
 				{Text: "⏳", CallbackData: "nothing", Url: report.URL},
 				{Text: fmt.Sprintf("%v м", strconv.Itoa(report.Duration)), Url: report.URL, CallbackData: "nothing"},
 				{Text: favText, CallbackData: cb},
@@ -198,66 +351,106 @@ func reportsWithFavoriteKB(reports []models.Report, user models.User, evaluation
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// evaluateKB returns a keyboard with options for evaluating a report.
-func evaluateKB() gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
-		{
-			{Text: "Оценить от 1 до 5", CallbackData: evaluationBegin},
-		},
-		{
-			{Text: "Я не слушал этот доклад", CallbackData: noEvaluate},
-		},
-		{
-			{Text: "Я не хочу оценивать этот доклад", CallbackData: noWishToEvaluate},
-		},
-		{
-			{Text: "Вернуться к докладам", CallbackData: viewReports},
-		},
+// RateReportsKB returns a keyboard with a "rate" button for each of the given reports.
+// It is used in rating prompts to jump right into the evaluation flow of a report, offset is added to the report numbers.
+func RateReportsKB(reports []models.Report, offset int) gotgbot.InlineKeyboardMarkup {
+	kb := make([][]gotgbot.InlineKeyboardButton, 0, len(reports))
+
+	for ind, report := range reports {
+		title := []rune(report.Title)
+		if len(title) > 40 {
+			title = append(title[:39], '…')
+		}
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("🏆 %v. %s", offset+ind+1, string(title)), CallbackData: reportCallback(evaluateReport, report)},
+		})
 	}
 
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// contentKB returns a keyboard for rating the content of a report.
-func contentKB(url string) gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
+// reviewsFormatKB returns a keyboard with the formats of the reviews export.
+func reviewsFormatKB() gotgbot.InlineKeyboardMarkup {
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "1", CallbackData: "content;1"}, {Text: "2", CallbackData: "content;2"},
-			{Text: "3", CallbackData: "content;3"}, {Text: "4", CallbackData: "content;4"}, {Text: "5", CallbackData: "content;5"},
+			{Text: "JSON", CallbackData: fmt.Sprintf("%s;%s", downloadReviews, formatJSON)},
+			{Text: "CSV", CallbackData: fmt.Sprintf("%s;%s", downloadReviews, formatCSV)},
+			{Text: "XLSX", CallbackData: fmt.Sprintf("%s;%s", downloadReviews, formatXLSX)},
 		},
 		{
-			{Text: "Назад", CallbackData: fmt.Sprintf("%s;%s", evaluateReport, url)},
+			{Text: "⬅️ Назад", CallbackData: back},
 		},
-	}
+	}}
+}
 
-	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+// SurveyKB returns a keyboard with a button starting the survey of the conference.
+// It is used in the conference-end notification.
+func SurveyKB(conferenceID string) gotgbot.InlineKeyboardMarkup {
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+		{{Text: "🏁 Оценить конференцию", CallbackData: fmt.Sprintf("%s;%s", conferenceSurvey, conferenceID)}},
+	}}
 }
 
-// performanceKB returns a keyboard for rating the performance of a report.
-func performanceKB() gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
+// evaluateKB returns the rows with options for evaluating a report.
+func evaluateKB() [][]gotgbot.InlineKeyboardButton {
+	return [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "1", CallbackData: "performance;1"}, {Text: "2", CallbackData: "performance;2"},
-			{Text: "3", CallbackData: "performance;3"}, {Text: "4", CallbackData: "performance;4"}, {Text: "5", CallbackData: "performance;5"},
+			conversation.Choice("Оценить доклад", evaluationBegin),
 		},
 		{
-			{Text: "Вернуться в к выбору оценки", CallbackData: "backToContent"},
+			conversation.Choice("Я не слушал этот доклад", noEvaluate),
 		},
-	}
-	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
-}
-
-// commentKB returns a keyboard for adding a comment to a report.
-func commentKB() gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "Далее", CallbackData: evaluationEnd},
+			conversation.Choice("Я не хочу оценивать этот доклад", noWishToEvaluate),
 		},
 		{
-			{Text: "Вернуться к выбору оценки", CallbackData: backToContent},
+			{Text: "Вернуться к докладам", CallbackData: viewReports},
 		},
 	}
-	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
+}
+
+// questionnaireItemKB returns the rows of the keyboard answering the item of a questionnaire.
+// The marks of a scale are split into rows of up to 6, the chosen options of a multiple choice are checked.
+func questionnaireItemKB(item models.QuestionnaireItem, answer string) [][]gotgbot.InlineKeyboardButton {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	switch item.Type {
+	case models.ItemScale:
+		var row []gotgbot.InlineKeyboardButton
+		for mark := item.Min; mark <= item.Max; mark++ {
+			if len(row) == 6 {
+				kb = append(kb, row)
+				row = nil
+			}
+			row = append(row, conversation.Choice(strconv.Itoa(mark), strconv.Itoa(mark)))
+		}
+		kb = append(kb, row)
+	case models.ItemSingle:
+		for ind, option := range item.Options {
+			kb = append(kb, []gotgbot.InlineKeyboardButton{conversation.Choice(option, optionInput(ind))})
+		}
+	case models.ItemMulti:
+		for ind, selected := range selectedOptions(item, answer) {
+			mark := "▫️ "
+			if selected {
+				mark = "✅ "
+			}
+			kb = append(kb, []gotgbot.InlineKeyboardButton{conversation.Choice(mark+item.Options[ind], optionInput(ind))})
+		}
+		kb = append(kb, []gotgbot.InlineKeyboardButton{conversation.Choice("Готово", inputDone)})
+	case models.ItemYesNo:
+		kb = append(kb, []gotgbot.InlineKeyboardButton{conversation.Choice("Да", inputYes), conversation.Choice("Нет", inputNo)})
+	}
+
+	if item.Optional {
+		text := "Пропустить"
+		if item.Type == models.ItemText {
+			text = "Далее"
+		}
+		kb = append(kb, []gotgbot.InlineKeyboardButton{conversation.Choice(text, inputSkip)})
+	}
+
+	return kb
 }
 
 // evaluationEndKB returns a keyboard for ending the evaluation process.
@@ -279,8 +472,8 @@ func userEvaluationsKB(reports []models.Report, evaluationMap map[string]models.
 
 	for ind, report := range reports {
 		if _, exists := evaluationMap[report.URL]; exists {
-			updCB := fmt.Sprintf("%s;%s", updateEvaluation, report.URL)
-			dltCB := fmt.Sprintf("%s;%s", deleteEvaluation, report.URL)
+			updCB := reportCallback(updateEvaluation, report)
+			dltCB := reportCallback(deleteEvaluation, report)
 			kb = append(kb, []gotgbot.InlineKeyboardButton{
 				{Text: fmt.Sprintf("%v.", ind+1), CallbackData: "index"},
 				{Text: "✏️ Редактировать", CallbackData: updCB},
@@ -296,44 +489,92 @@ func userEvaluationsKB(reports []models.Report, evaluationMap map[string]models.
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// contentUpdateKB returns a keyboard for updating the content rating of a report.
-func contentUpdateKB() gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
-		{
-			{Text: "1", CallbackData: "updateContent;1"}, {Text: "2", CallbackData: "updateContent;2"},
-			{Text: "3", CallbackData: "updateContent;3"}, {Text: "4", CallbackData: "updateContent;4"}, {Text: "5", CallbackData: "updateContent;5"},
-		},
-		{
-			{Text: "К отзывам", CallbackData: userEvaluations},
-		},
+// broadcastAudienceKB returns the rows of the keyboard for choosing the audience of a broadcast.
+func broadcastAudienceKB() [][]gotgbot.InlineKeyboardButton {
+	return [][]gotgbot.InlineKeyboardButton{
+		{conversation.Choice("👥 Все пользователи", audienceAll)},
+		{conversation.Choice("⭐ Добавившие доклад в избранное", audienceFavorite)},
+		{conversation.Choice("🙈 Не оценившие ни одного доклада", audienceUnrated)},
+		{conversation.Choice("🔎 По идентификации", audiencePattern)},
 	}
+}
+
+// broadcastReportsKB returns the rows of the keyboard for choosing the report whose fans receive a broadcast.
+func broadcastReportsKB(reports []models.Report) [][]gotgbot.InlineKeyboardButton {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	var row []gotgbot.InlineKeyboardButton
+
+	for ind := range reports {
+		row = append(row, conversation.Choice(fmt.Sprintf("%v", ind+1), strconv.Itoa(ind)))
+		if len(row) == 5 {
+			kb = append(kb, row)
+			row = nil
+		}
+	}
+
+	if len(row) != 0 {
+		kb = append(kb, row)
+	}
+
+	return kb
+}
+
+// announcementsKB returns a keyboard with a list of pending announcements, each announcement has buttons for editing and cancelling.
+func announcementsKB(pending []models.Announcement) gotgbot.InlineKeyboardMarkup {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	for ind, announcement := range pending {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: fmt.Sprintf("%v.", ind+1), CallbackData: "index"},
+			{Text: "✏️ Редактировать", CallbackData: fmt.Sprintf("%s;%s", announceEdit, announcement.ID)},
+			{Text: "🗑️ Отменить", CallbackData: fmt.Sprintf("%s;%s", announceCancel, announcement.ID)},
+		})
+	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{
+		{Text: "➕ Новое объявление", CallbackData: announceCreate},
+	}, []gotgbot.InlineKeyboardButton{
+		{Text: "⬅️ Назад", CallbackData: back},
+	})
 
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// performanceUpdateKB returns a keyboard for updating the performance rating of a report.
-func performanceUpdateKB() gotgbot.InlineKeyboardMarkup {
+// backToAnnouncementsKB returns a keyboard with a button to go back to the announcements list.
+func backToAnnouncementsKB() gotgbot.InlineKeyboardMarkup {
 	kb := [][]gotgbot.InlineKeyboardButton{
 		{
-			{Text: "1", CallbackData: "updatePerformance;1"}, {Text: "2", CallbackData: "updatePerformance;2"},
-			{Text: "3", CallbackData: "updatePerformance;3"}, {Text: "4", CallbackData: "updatePerformance;4"}, {Text: "5", CallbackData: "updatePerformance;5"},
-		},
-		{
-			{Text: "К отзывам", CallbackData: userEvaluations},
+			{Text: "⬅️ К объявлениям", CallbackData: announcements},
 		},
 	}
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
 
-// commentUpdateKB returns a keyboard for updating the comment of a report.
-func commentUpdateKB() gotgbot.InlineKeyboardMarkup {
-	kb := [][]gotgbot.InlineKeyboardButton{
-		{
-			{Text: "Далее", CallbackData: updateNoComment},
-		},
-		{
-			{Text: "К отзывам", CallbackData: userEvaluations},
-		},
+// conferencesKB returns a keyboard with a list of conferences, the active one is marked.
+// Users allowed to create conferences also get a button for it.
+func conferencesKB(list []models.Conference, active string, create bool) gotgbot.InlineKeyboardMarkup {
+	var kb [][]gotgbot.InlineKeyboardButton
+
+	for _, conference := range list {
+		text := conference.Name
+		if conference.ID == active {
+			text = fmt.Sprintf("✅ %s", text)
+		}
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: text, CallbackData: fmt.Sprintf("%s;%s", conferencePick, conference.ID)},
+		})
+	}
+
+	if create {
+		kb = append(kb, []gotgbot.InlineKeyboardButton{
+			{Text: "➕ Новая конференция", CallbackData: conferenceCreate},
+		})
 	}
+
+	kb = append(kb, []gotgbot.InlineKeyboardButton{
+		{Text: "⬅️ Назад", CallbackData: back},
+	})
+
 	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: kb}
 }
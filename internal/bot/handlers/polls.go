@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a poll, so its options fit the buttons.
+const (
+	pollMinOptions      = 2
+	pollMaxOptions      = 8
+	pollMaxOptionLength = 40
+)
+
+// pollPrompt explains speakers and moderators the format of a poll.
+const pollPrompt = "Отправьте опрос: в первой строке вопрос, в следующих — от 2 до 8 вариантов ответа, каждый на своей строке.\n\nНапример:\n\nНа какой версии Go ваш прод?\n1.20 и старше\n1.21\n1.22"
+
+// parsePoll parses a poll entered by a speaker or a moderator: the question and the options, one per line.
+func parsePoll(message string) (string, []string, error) {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) < 1+pollMinOptions || len(lines) > 1+pollMaxOptions {
+		return "", nil, fmt.Errorf("нужны вопрос и от %d до %d вариантов ответа", pollMinOptions, pollMaxOptions)
+	}
+
+	for _, option := range lines[1:] {
+		if utf8.RuneCountInString(option) > pollMaxOptionLength {
+			return "", nil, fmt.Errorf("вариант «%s» длиннее %d символов", option, pollMaxOptionLength)
+		}
+	}
+
+	return lines[0], lines[1:], nil
+}
+
+// formatPoll returns the text of the poll with its results.
+func formatPoll(poll models.Poll) string {
+	total := 0
+	for _, count := range poll.Counts {
+		total += count
+	}
+
+	status := "идёт голосование"
+	if poll.Closed {
+		status = "завершён"
+	}
+
+	text := fmt.Sprintf("📊 %s\n\n", poll.Question)
+	for ind, option := range poll.Options {
+		count, percent := 0, 0
+		if ind < len(poll.Counts) {
+			count = poll.Counts[ind]
+		}
+		if total != 0 {
+			percent = count * 100 / total
+		}
+		text += fmt.Sprintf("%s\n%s %d%% (%d)\n\n", option, strings.Repeat("▇", percent/10), percent, count)
+	}
+
+	return text + fmt.Sprintf("Голосов: %d, опрос %s", total, status)
+}
+
+func (c *Client) pollCreateCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	report, err := c.conferenceReport(cb.From.Id, strings.TrimPrefix(cb.Data, pollCreate+";"))
+	if err != nil {
+		return err
+	}
+
+	host, err := c.hostsReport(cb.From.Id, report)
+	if err != nil {
+		return err
+	}
+
+	if !host {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Недостаточно прав"})
+		return err
+	}
+
+	running, err := reportRunning(report, c.now())
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Опрос можно запустить только во время доклада"})
+		return err
+	}
+
+	state, err := fsm.NewState(pollCreate, questionPayload{ConferenceID: report.ConferenceID, URL: report.URL, MessageID: cb.Message.GetMessageId()})
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, state); err != nil {
+		return err
+	}
+
+	if _, err = cb.Answer(bot, nil); err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(cb.From.Id, pollPrompt, &gotgbot.SendMessageOpts{ReplyMarkup: backToQuestionsKB(report)})
+
+	return err
+}
+
+// pollTextHandler launches the poll entered by a speaker or a moderator and returns them to the question board.
+// The creator gets the live results, the users who favorited the report or opened its card get the poll.
+func (c *Client) pollTextHandler(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error {
+
+	var payload questionPayload
+
+	if err := state.Decode(&payload); err != nil {
+		return err
+	}
+
+	report, err := c.conferenceReport(ctx.EffectiveUser.Id, payload.URL)
+	if err != nil {
+		return err
+	}
+
+	host, err := c.hostsReport(ctx.EffectiveUser.Id, report)
+	if err != nil {
+		return err
+	}
+
+	if !host {
+		return c.revoked(bot, ctx)
+	}
+
+	running, err := reportRunning(report, c.now())
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		if err = c.watchBoard(ctx.EffectiveUser.Id, payload); err != nil {
+			return err
+		}
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Доклад уже закончился, опрос не запущен", &gotgbot.SendMessageOpts{ReplyMarkup: backToQuestionsKB(report)})
+		return err
+	}
+
+	question, options, err := parsePoll(ctx.EffectiveMessage.Text)
+	if err != nil {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v\n\n%s", err, pollPrompt), &gotgbot.SendMessageOpts{ReplyMarkup: backToQuestionsKB(report)})
+		return err
+	}
+
+	results, err := bot.SendMessage(ctx.EffectiveChat.Id, "📊 Запускаю опрос…", nil)
+	if err != nil {
+		return err
+	}
+
+	poll := models.Poll{ConferenceID: report.ConferenceID, URL: report.URL, Question: question, Options: options,
+		CreatedBy: int(ctx.EffectiveUser.Id), ResultsMessageID: results.MessageId, CreatedAt: c.now().UTC()}
+
+	if poll.ID, err = c.Database.InsertPoll(poll); err != nil {
+		return err
+	}
+	poll.Counts = make([]int, len(options))
+
+	if _, _, err = results.EditText(bot, formatPoll(poll), &gotgbot.EditMessageTextOpts{ReplyMarkup: pollResultsKB(poll)}); err != nil {
+		return err
+	}
+
+	recipients, err := c.pollRecipients(report, ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, chatID := range recipients {
+		c.Sender.SendText(chatID, fmt.Sprintf("📊 Опрос на докладе «%s»\n\n%s", report.Title, poll.Question), &gotgbot.SendMessageOpts{ReplyMarkup: pollVoteKB(poll)})
+	}
+
+	if err = c.watchBoard(ctx.EffectiveUser.Id, payload); err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Опрос отправлен участникам: %d. Результаты обновляются в сообщении выше", len(recipients)), nil)
+
+	return err
+}
+
+// pollRecipients returns the chats of the users who favorited the report or opened its card, except the creator of the poll.
+func (c *Client) pollRecipients(report models.Report, creator int64) ([]int64, error) {
+	users, err := c.Database.SelectUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	viewers, err := c.Database.SelectReportViewers(report.ConferenceID, report.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []int64
+
+	for _, user := range users {
+		if int64(user.TgID) == creator {
+			continue
+		}
+		if slices.Contains(user.Favorites, report.Ref()) || slices.Contains(viewers, user.TgID) {
+			recipients = append(recipients, int64(user.ChatID))
+		}
+	}
+
+	return recipients, nil
+}
+
+func (c *Client) pollVoteCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	parts := strings.Split(cb.Data, ";")
+	if len(parts) != 3 {
+		return errors.New("invalid poll vote callback data")
+	}
+
+	option, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return err
+	}
+
+	voted, err := c.Database.VotePoll(parts[1], int(cb.From.Id), option)
+	if err != nil {
+		return err
+	}
+
+	poll, err := c.Database.SelectPoll(parts[1])
+	if err != nil {
+		return err
+	}
+
+	answer := "Голос учтён"
+
+	switch {
+	case voted:
+	case poll.Closed:
+		answer = "Опрос уже завершён"
+	default:
+		answer = "Вы уже проголосовали"
+	}
+
+	if _, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: answer}); err != nil {
+		return err
+	}
+
+	if voted {
+		c.refreshPollResults(bot, poll)
+	}
+
+	return nil
+}
+
+func (c *Client) pollCloseCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	poll, err := c.Database.SelectPoll(strings.TrimPrefix(cb.Data, pollClose+";"))
+	if err != nil {
+		return err
+	}
+
+	if poll.CreatedBy != int(cb.From.Id) && !c.can(cb.From.Id, permModerate) {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Недостаточно прав"})
+		return err
+	}
+
+	if _, err = c.Database.ClosePoll(poll.ID); err != nil {
+		return err
+	}
+
+	if _, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Опрос завершён"}); err != nil {
+		return err
+	}
+
+	poll.Closed = true
+	c.refreshPollResults(bot, poll)
+
+	return nil
+}
+
+// refreshPollResults updates the live results of the poll in the chat of its creator.
+func (c *Client) refreshPollResults(bot *gotgbot.Bot, poll models.Poll) {
+	_, _, err := bot.EditMessageText(formatPoll(poll), &gotgbot.EditMessageTextOpts{
+		ChatId: int64(poll.CreatedBy), MessageId: poll.ResultsMessageID, ReplyMarkup: pollResultsKB(poll)})
+	if err = ignoreNotModified(err); err != nil {
+		log.Printf("failed to update the results of poll %s: %v", poll.ID, err)
+	}
+}
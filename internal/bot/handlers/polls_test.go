@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePoll(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      string
+		wantQuestion string
+		wantOptions  []string
+		wantErr      bool
+	}{
+		{
+			name:         "question and options",
+			message:      "На какой версии Go ваш прод?\n1.21\n1.22",
+			wantQuestion: "На какой версии Go ваш прод?",
+			wantOptions:  []string{"1.21", "1.22"},
+		},
+		{
+			name:         "blank lines and spaces are skipped",
+			message:      "  Вопрос  \n\n Да \n\n  Нет\n",
+			wantQuestion: "Вопрос",
+			wantOptions:  []string{"Да", "Нет"},
+		},
+		{
+			name:         "max options",
+			message:      "Вопрос\n1\n2\n3\n4\n5\n6\n7\n8",
+			wantQuestion: "Вопрос",
+			wantOptions:  []string{"1", "2", "3", "4", "5", "6", "7", "8"},
+		},
+		{
+			name:         "option of max length",
+			message:      "Вопрос\nДа\n" + strings.Repeat("я", pollMaxOptionLength),
+			wantQuestion: "Вопрос",
+			wantOptions:  []string{"Да", strings.Repeat("я", pollMaxOptionLength)},
+		},
+		{
+			name:    "empty",
+			message: " \n ",
+			wantErr: true,
+		},
+		{
+			name:    "one option",
+			message: "Вопрос\nДа",
+			wantErr: true,
+		},
+		{
+			name:    "too many options",
+			message: "Вопрос\n1\n2\n3\n4\n5\n6\n7\n8\n9",
+			wantErr: true,
+		},
+		{
+			name:    "too long option",
+			message: "Вопрос\nДа\n" + strings.Repeat("я", pollMaxOptionLength+1),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			question, options, err := parsePoll(tt.message)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePoll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if question != tt.wantQuestion || !reflect.DeepEqual(options, tt.wantOptions) {
+				t.Errorf("parsePoll() = %q, %q, want %q, %q", question, options, tt.wantQuestion, tt.wantOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a questionnaire, so its items fit the steps of the evaluation and the buttons.
+const (
+	questionnaireMaxItems        = 20
+	questionnaireMaxMarks        = 11
+	questionnaireMinOptions      = 2
+	questionnaireMaxOptions      = 8
+	questionnaireMaxOptionLength = 40
+	questionnaireMaxFileSize     = 64 << 10
+)
+
+// questionnairePrompt explains admins the format of a questionnaire file.
+const questionnairePrompt = `Загрузите файл .json с анкетой отзыва. "track" — зал, для докладов которого действует анкета, пустой для всей конференции. Типы вопросов: "scale" (шкала от "min" до "max"), "single" (один вариант из "options"), "multi" (несколько вариантов), "yesno" (да/нет), "text" (свободный ответ). Ответы на вопросы с id "content", "performance" и "comment" попадают в статистику спикеров.
+
+Например:
+
+{"track": "", "items": [
+{"id": "content", "type": "scale", "text": "Оцените содержание доклада", "min": 1, "max": 5},
+{"id": "useful", "type": "yesno", "text": "Было полезно для работы?"},
+{"id": "liked", "type": "multi", "text": "Что понравилось?", "options": ["Примеры", "Слайды", "Ответы на вопросы"], "optional": true},
+{"id": "comment", "type": "text", "text": "Комментарий", "optional": true}
+]}
+
+Файл с пустым списком "items" возвращает анкету по умолчанию.`
+
+// questionnaireFile is the file with a questionnaire uploaded by an admin.
+type questionnaireFile struct {
+	Track string                     `json:"track"`
+	Items []models.QuestionnaireItem `json:"items"`
+}
+
+// validateQuestionnaire checks that the items can be asked by the evaluation conversation.
+func validateQuestionnaire(items []models.QuestionnaireItem) error {
+	if len(items) > questionnaireMaxItems {
+		return fmt.Errorf("в анкете может быть не больше %d вопросов", questionnaireMaxItems)
+	}
+
+	ids := make(map[string]bool, len(items))
+
+	for ind, item := range items {
+		if item.ID == "" || strings.TrimSpace(item.Text) == "" {
+			return fmt.Errorf("у вопроса %d нет id или текста", ind+1)
+		}
+		if ids[item.ID] {
+			return fmt.Errorf("id «%s» повторяется", item.ID)
+		}
+		ids[item.ID] = true
+
+		switch item.Type {
+		case models.ItemScale:
+			if item.Min >= item.Max || item.Max-item.Min+1 > questionnaireMaxMarks {
+				return fmt.Errorf("шкала вопроса «%s» должна быть от min до max, не больше %d оценок", item.ID, questionnaireMaxMarks)
+			}
+		case models.ItemSingle, models.ItemMulti:
+			if len(item.Options) < questionnaireMinOptions || len(item.Options) > questionnaireMaxOptions {
+				return fmt.Errorf("у вопроса «%s» должно быть от %d до %d вариантов", item.ID, questionnaireMinOptions, questionnaireMaxOptions)
+			}
+			options := make(map[string]bool, len(item.Options))
+			for _, option := range item.Options {
+				if option == "" || options[option] || strings.Contains(option, strings.TrimSpace(optionSeparator)) ||
+					utf8.RuneCountInString(option) > questionnaireMaxOptionLength {
+					return fmt.Errorf("вариант «%s» вопроса «%s» пустой, повторяется, содержит «;» или длиннее %d символов", option, item.ID, questionnaireMaxOptionLength)
+				}
+				options[option] = true
+			}
+		case models.ItemYesNo, models.ItemText:
+		default:
+			return fmt.Errorf("неизвестный тип «%s» вопроса «%s»", item.Type, item.ID)
+		}
+	}
+
+	return nil
+}
+
+// questionnaireItems returns the items asked about the report: the questionnaire of its track,
+// otherwise the questionnaire of its conference, otherwise the default one.
+func questionnaireItems(questionnaires []models.Questionnaire, report models.Report) []models.QuestionnaireItem {
+	items := models.DefaultQuestionnaire()
+
+	for _, questionnaire := range questionnaires {
+		if report.Room != "" && questionnaire.Track == report.Room {
+			return questionnaire.Items
+		}
+		if questionnaire.Track == "" {
+			items = questionnaire.Items
+		}
+	}
+
+	return items
+}
+
+// questionnaire returns the items asked about the report.
+func (c *Client) questionnaire(report models.Report) ([]models.QuestionnaireItem, error) {
+	questionnaires, err := c.Database.SelectQuestionnaires(report.ConferenceID)
+	if err != nil {
+		return nil, err
+	}
+	return questionnaireItems(questionnaires, report), nil
+}
+
+// describeItem returns the type of the item with its marks or options.
+func describeItem(item models.QuestionnaireItem) string {
+	var text string
+
+	switch item.Type {
+	case models.ItemScale:
+		text = fmt.Sprintf("шкала %d–%d", item.Min, item.Max)
+	case models.ItemSingle:
+		text = "один вариант: " + strings.Join(item.Options, " / ")
+	case models.ItemMulti:
+		text = "несколько вариантов: " + strings.Join(item.Options, " / ")
+	case models.ItemYesNo:
+		text = "да/нет"
+	case models.ItemText:
+		text = "текст"
+	}
+
+	if item.Optional {
+		text += ", необязательный"
+	}
+
+	return text
+}
+
+// formatQuestionnaire returns the items of a questionnaire one per line.
+func formatQuestionnaire(items []models.QuestionnaireItem) string {
+	var text string
+	for ind, item := range items {
+		text += fmt.Sprintf("%d. %s [%s]\n", ind+1, item.Text, describeItem(item))
+	}
+	return text
+}
+
+// formatQuestionnaires returns the questionnaires of the conference, the default one is shown if the conference has none.
+func formatQuestionnaires(questionnaires []models.Questionnaire) string {
+	if len(questionnaires) == 0 {
+		return "Анкета по умолчанию:\n\n" + formatQuestionnaire(models.DefaultQuestionnaire())
+	}
+
+	var text string
+
+	for _, questionnaire := range questionnaires {
+		track := "Вся конференция"
+		if questionnaire.Track != "" {
+			track = "Зал " + questionnaire.Track
+		}
+		text += fmt.Sprintf("%s (обновлена %s):\n\n%s\n", track, questionnaire.UpdatedAt.Format("02.01.2006 15:04"), formatQuestionnaire(questionnaire.Items))
+	}
+
+	return text
+}
+
+func (c *Client) uploadQuestionnaireCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	questionnaires, err := c.Database.SelectQuestionnaires(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, fsm.State{Name: uploadQuestionnaire}); err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("%s\n%s", formatQuestionnaires(questionnaires), questionnairePrompt),
+		&gotgbot.EditMessageTextOpts{ReplyMarkup: backToMainMenuKB()})
+
+	return err
+}
+
+// questionnaireFileHandler saves the questionnaire uploaded by an admin, a file without items deletes the questionnaire of the track.
+// The admin stays in the state, so they can upload the questionnaires of the other tracks.
+func (c *Client) questionnaireFileHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	document := ctx.EffectiveMessage.Document
+
+	if strings.ToLower(filepath.Ext(document.FileName)) != ".json" || document.FileSize > questionnaireMaxFileSize {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Пришлите анкету файлом .json размером до 64 КБ", &gotgbot.SendMessageOpts{ReplyMarkup: backToMainMenuKB()})
+		return err
+	}
+
+	file, err := bot.GetFile(document.FileId, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.Get(fmt.Sprintf("https://api.telegram.org/file/bot%s/%s", c.Cfg.Telegram.Token, file.FilePath))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, questionnaireMaxFileSize))
+	if err != nil {
+		return err
+	}
+
+	var uploaded questionnaireFile
+
+	if err = json.Unmarshal(body, &uploaded); err == nil {
+		err = validateQuestionnaire(uploaded.Items)
+	}
+
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			err = errors.New("файл не является корректным JSON")
+		}
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Анкета не загружена: %v", err), &gotgbot.SendMessageOpts{ReplyMarkup: backToMainMenuKB()})
+		return err
+	}
+
+	track := strings.TrimSpace(uploaded.Track)
+
+	text := "Анкета сохранена. Новые отзывы будут собираться по ней"
+
+	if len(uploaded.Items) == 0 {
+		if _, err = c.Database.DeleteQuestionnaire(conference.ID, track); err != nil {
+			return err
+		}
+		text = "Анкета удалена, отзывы будут собираться по анкете конференции или по анкете по умолчанию"
+	} else {
+		questionnaire := models.Questionnaire{ConferenceID: conference.ID, Track: track, Items: uploaded.Items,
+			UpdatedBy: int(ctx.EffectiveUser.Id), UpdatedAt: c.now().UTC()}
+
+		if err = c.Database.SaveQuestionnaire(questionnaire); err != nil {
+			return err
+		}
+	}
+
+	questionnaires, err := c.Database.SelectQuestionnaires(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("%s\n\n%s", text, formatQuestionnaires(questionnaires)), &gotgbot.SendMessageOpts{ReplyMarkup: backToMainMenuKB()})
+
+	return err
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestValidateQuestionnaire(t *testing.T) {
+	scale := models.QuestionnaireItem{ID: "content", Type: models.ItemScale, Text: "Содержание", Min: 1, Max: 5}
+	single := models.QuestionnaireItem{ID: "level", Type: models.ItemSingle, Text: "Уровень", Options: []string{"Junior", "Senior"}}
+	text := models.QuestionnaireItem{ID: "comment", Type: models.ItemText, Text: "Комментарий", Optional: true}
+
+	many := make([]models.QuestionnaireItem, questionnaireMaxItems+1)
+	for ind := range many {
+		many[ind] = models.QuestionnaireItem{ID: strings.Repeat("q", ind+1), Type: models.ItemYesNo, Text: "Вопрос"}
+	}
+
+	withOptions := func(options ...string) models.QuestionnaireItem {
+		item := single
+		item.Options = options
+		return item
+	}
+
+	tests := []struct {
+		name    string
+		items   []models.QuestionnaireItem
+		wantErr bool
+	}{
+		{name: "default questionnaire", items: models.DefaultQuestionnaire()},
+		{name: "every type", items: []models.QuestionnaireItem{scale, single, text,
+			{ID: "again", Type: models.ItemYesNo, Text: "Пойдёте ещё?"}, {ID: "topics", Type: models.ItemMulti, Text: "Темы", Options: []string{"Go", "Rust"}}}},
+		{name: "NPS scale", items: []models.QuestionnaireItem{{ID: "nps", Type: models.ItemScale, Text: "NPS", Min: 0, Max: 10}}},
+		{name: "too many items", items: many, wantErr: true},
+		{name: "no ID", items: []models.QuestionnaireItem{{Type: models.ItemText, Text: "Комментарий"}}, wantErr: true},
+		{name: "blank text", items: []models.QuestionnaireItem{{ID: "comment", Type: models.ItemText, Text: " "}}, wantErr: true},
+		{name: "repeated ID", items: []models.QuestionnaireItem{scale, scale}, wantErr: true},
+		{name: "unknown type", items: []models.QuestionnaireItem{{ID: "x", Type: "date", Text: "Когда?"}}, wantErr: true},
+		{name: "reversed scale", items: []models.QuestionnaireItem{{ID: "x", Type: models.ItemScale, Text: "Оценка", Min: 5, Max: 1}}, wantErr: true},
+		{name: "too wide scale", items: []models.QuestionnaireItem{{ID: "x", Type: models.ItemScale, Text: "Оценка", Min: 0, Max: questionnaireMaxMarks}}, wantErr: true},
+		{name: "one option", items: []models.QuestionnaireItem{withOptions("Да")}, wantErr: true},
+		{name: "empty option", items: []models.QuestionnaireItem{withOptions("Да", "")}, wantErr: true},
+		{name: "repeated option", items: []models.QuestionnaireItem{withOptions("Да", "Да")}, wantErr: true},
+		{name: "option with separator", items: []models.QuestionnaireItem{withOptions("Да", "Нет; не знаю")}, wantErr: true},
+		{name: "too long option", items: []models.QuestionnaireItem{withOptions("Да", strings.Repeat("я", questionnaireMaxOptionLength+1))}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateQuestionnaire(tt.items); (err != nil) != tt.wantErr {
+				t.Errorf("validateQuestionnaire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// questionMaxLength is the maximum length of a question in characters.
+const questionMaxLength = 200
+
+// questionsShown is the number of the top questions shown in a list, so the list fits a single message.
+const questionsShown = 15
+
+// questionPayload is the state payload of a user asking a question or of a speaker watching the question board of a report or launching a poll.
+type questionPayload struct {
+	ConferenceID string `json:"conferenceID,omitempty"` // ConferenceID is the ID of the conference of the report.
+	URL          string `json:"url"`                    // URL is the URL of the report.
+	MessageID    int64  `json:"messageID,omitempty"`    // MessageID is the ID of the message with the question board.
+}
+
+// reportRunning reports whether the report is running at now. Start times are Moscow wall times labelled as UTC.
+func reportRunning(report models.Report, now time.Time) (bool, error) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return false, err
+	}
+
+	t := report.StartTime
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+	end := start.Add(time.Duration(report.Duration) * time.Minute)
+
+	return !now.Before(start) && now.Before(end), nil
+}
+
+// sortQuestions orders the questions for the lists: unanswered first, then by votes, then by the time they were asked.
+func sortQuestions(questions []models.Question) {
+	sort.SliceStable(questions, func(i, j int) bool {
+		if questions[i].Answered != questions[j].Answered {
+			return !questions[i].Answered
+		}
+		return questions[i].Votes > questions[j].Votes
+	})
+}
+
+// reportQuestions returns the questions of the report sorted for the lists.
+func (c *Client) reportQuestions(report models.Report) ([]models.Question, error) {
+	all, err := c.Database.SelectQuestions(report.ConferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []models.Question
+	for _, question := range all {
+		if question.URL == report.URL {
+			questions = append(questions, question)
+		}
+	}
+
+	sortQuestions(questions)
+
+	if len(questions) > questionsShown {
+		questions = questions[:questionsShown]
+	}
+
+	return questions, nil
+}
+
+// hostsReport reports whether the user answers the questions of the report: a moderator of the conference or a speaker of the report.
+func (c *Client) hostsReport(tgID int64, report models.Report) (bool, error) {
+	if c.can(tgID, permModerate) {
+		return true, nil
+	}
+
+	links, err := c.Database.SelectSpeakerLinks(report.ConferenceID)
+	if err != nil {
+		return false, err
+	}
+
+	return speakerURLs(links, int(tgID))[report.URL], nil
+}
+
+// formatQuestions returns the text of the question list of the report.
+func formatQuestions(report models.Report, questions []models.Question) string {
+	text := fmt.Sprintf("❓ Вопросы к докладу «%s»\n\n", report.Title)
+
+	if len(questions) == 0 {
+		return text + "Вопросов пока нет"
+	}
+
+	for ind, question := range questions {
+		mark := ""
+		if question.Answered {
+			mark = "✅ "
+		}
+		text += fmt.Sprintf("%v. %s(👍 %d) %s\n\n", ind+1, mark, question.Votes, question.Text)
+	}
+
+	return text
+}
+
+func (c *Client) questionsCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	if err := c.FSM.SetState(cb.From.Id, fsm.State{Name: questions}); err != nil {
+		return err
+	}
+
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	reports, err := c.Database.SelectReports(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	links, err := c.Database.SelectSpeakerLinks(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	moderator, own := c.can(cb.From.Id, permModerate), speakerURLs(links, int(cb.From.Id))
+
+	var listed []models.Report
+	running := make(map[string]bool)
+
+	for _, report := range reports {
+		isRunning, errR := reportRunning(report, c.now())
+		if errR != nil {
+			return errR
+		}
+		if isRunning || moderator || own[report.URL] {
+			listed = append(listed, report)
+			running[report.URL] = isRunning
+		}
+	}
+
+	text := "Выберите доклад, чтобы задать вопрос спикеру или проголосовать за вопросы других. 🔴 — доклад идёт сейчас"
+	if len(listed) == 0 {
+		text = "Сейчас не идёт ни одного доклада. Вопросы спикеру можно задать во время его доклада"
+	}
+
+	_, _, err = cb.Message.EditText(bot, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: questionReportsKB(listed, running)})
+
+	return err
+}
+
+func (c *Client) questionReportCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	return c.showQuestions(bot, ctx, strings.TrimPrefix(cb.Data, questionReport+";"))
+}
+
+// showQuestions shows the question list of the report in the message of the callback, it is the card of the report.
+// Speakers and moderators get the board with the buttons for marking questions as answered and launching polls, it is updated live.
+// Other users who open the card are recorded as its viewers, they get the polls of the report.
+func (c *Client) showQuestions(bot *gotgbot.Bot, ctx *ext.Context, url string) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	report, err := c.conferenceReport(cb.From.Id, url)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Доклад не найден"})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	questionList, err := c.reportQuestions(report)
+	if err != nil {
+		return err
+	}
+
+	host, err := c.hostsReport(cb.From.Id, report)
+	if err != nil {
+		return err
+	}
+
+	if host {
+		if err = c.watchBoard(cb.From.Id, questionPayload{ConferenceID: report.ConferenceID, URL: report.URL, MessageID: cb.Message.GetMessageId()}); err != nil {
+			return err
+		}
+
+		_, _, err = cb.Message.EditText(bot, formatQuestions(report, questionList), &gotgbot.EditMessageTextOpts{ReplyMarkup: questionBoardKB(report, questionList)})
+		return ignoreNotModified(err)
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, fsm.State{Name: questions}); err != nil {
+		return err
+	}
+
+	if err = c.Database.AddReportView(int(cb.From.Id), report.ConferenceID, report.URL); err != nil {
+		return err
+	}
+
+	running, err := reportRunning(report, c.now())
+	if err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, formatQuestions(report, questionList), &gotgbot.EditMessageTextOpts{ReplyMarkup: questionListKB(report, questionList, running)})
+
+	return ignoreNotModified(err)
+}
+
+// watchBoard puts the user in the state of watching the question board in the message from the payload.
+// The board is updated live until the user leaves it.
+func (c *Client) watchBoard(tgID int64, payload questionPayload) error {
+	state, err := fsm.NewState(questionBoard, payload)
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(tgID, state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.questionBoards == nil {
+		c.questionBoards = make(map[models.ReportRef]map[int64]bool)
+	}
+	ref := models.ReportRef{ConferenceID: payload.ConferenceID, URL: payload.URL}
+	if c.questionBoards[ref] == nil {
+		c.questionBoards[ref] = make(map[int64]bool)
+	}
+	c.questionBoards[ref][tgID] = true
+
+	return nil
+}
+
+func (c *Client) askQuestionCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	report, err := c.conferenceReport(cb.From.Id, strings.TrimPrefix(cb.Data, askQuestion+";"))
+	if err != nil {
+		return err
+	}
+
+	running, err := reportRunning(report, c.now())
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Вопросы принимаются только во время доклада"})
+		return err
+	}
+
+	state, err := fsm.NewState(askQuestion, questionPayload{ConferenceID: report.ConferenceID, URL: report.URL})
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(cb.From.Id, state); err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, fmt.Sprintf("Напишите ваш вопрос к докладу «%s», не длиннее %d символов", report.Title, questionMaxLength),
+		&gotgbot.EditMessageTextOpts{ReplyMarkup: backToQuestionsKB(report)})
+
+	return err
+}
+
+// questionTextHandler stores the question of the user to the report from the state.
+func (c *Client) questionTextHandler(bot *gotgbot.Bot, ctx *ext.Context, state fsm.State) error {
+
+	var payload questionPayload
+
+	if err := state.Decode(&payload); err != nil {
+		return err
+	}
+
+	report, err := c.conferenceReport(ctx.EffectiveUser.Id, payload.URL)
+	if err != nil {
+		return err
+	}
+
+	running, err := reportRunning(report, c.now())
+	if err != nil {
+		return err
+	}
+
+	if !running {
+		if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: questions}); err != nil {
+			return err
+		}
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Доклад уже закончился, вопросы к нему больше не принимаются", &gotgbot.SendMessageOpts{ReplyMarkup: backToQuestionsKB(report)})
+		return err
+	}
+
+	text := strings.TrimSpace(ctx.EffectiveMessage.Text)
+
+	if text == "" || strings.HasPrefix(text, "/") || utf8.RuneCountInString(text) > questionMaxLength {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Вопрос должен быть текстом не длиннее %d символов и не начинаться с \"/\"", questionMaxLength),
+			&gotgbot.SendMessageOpts{ReplyMarkup: backToQuestionsKB(report)})
+		return err
+	}
+
+	_, err = c.Database.InsertQuestion(models.Question{ConferenceID: report.ConferenceID, URL: report.URL, TgID: int(ctx.EffectiveUser.Id),
+		Text: text, AskedAt: c.now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: questions}); err != nil {
+		return err
+	}
+
+	questionList, err := c.reportQuestions(report)
+	if err != nil {
+		return err
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Вопрос отправлен спикеру!\n\n%s", formatQuestions(report, questionList)),
+		&gotgbot.SendMessageOpts{ReplyMarkup: questionListKB(report, questionList, true)})
+	if err != nil {
+		return err
+	}
+
+	c.refreshBoards(bot, report)
+
+	return nil
+}
+
+func (c *Client) upvoteQuestionCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	question, err := c.Database.SelectQuestion(strings.TrimPrefix(cb.Data, upvoteQuestion+";"))
+	if err != nil {
+		return err
+	}
+
+	answer := "Голос учтён"
+
+	switch {
+	case question.TgID == int(cb.From.Id):
+		answer = "Нельзя голосовать за свой вопрос"
+	case question.Answered:
+		answer = "На этот вопрос уже ответили"
+	default:
+		upvoted, errU := c.Database.UpvoteQuestion(question.ID, int(cb.From.Id))
+		if errU != nil {
+			return errU
+		}
+		if !upvoted {
+			answer = "Вы уже голосовали за этот вопрос"
+		}
+	}
+
+	if _, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: answer}); err != nil {
+		return err
+	}
+
+	if err = c.showQuestions(bot, ctx, question.URL); err != nil {
+		return err
+	}
+
+	report, err := c.Database.SelectReport(question.ConferenceID, question.URL)
+	if err != nil {
+		return err
+	}
+
+	c.refreshBoards(bot, report)
+
+	return nil
+}
+
+func (c *Client) answerQuestionCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	question, err := c.Database.SelectQuestion(strings.TrimPrefix(cb.Data, answerQuestion+";"))
+	if err != nil {
+		return err
+	}
+
+	report, err := c.Database.SelectReport(question.ConferenceID, question.URL)
+	if err != nil {
+		return err
+	}
+
+	host, err := c.hostsReport(cb.From.Id, report)
+	if err != nil {
+		return err
+	}
+
+	if !host {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Недостаточно прав"})
+		return err
+	}
+
+	if _, err = c.Database.SetQuestionAnswered(question.ID); err != nil {
+		return err
+	}
+
+	if _, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Вопрос отмечен как отвеченный"}); err != nil {
+		return err
+	}
+
+	c.refreshBoards(bot, report)
+
+	return nil
+}
+
+// refreshBoards updates the question boards of the report opened by the speakers and the moderators.
+// Boards of the users who left them are forgotten.
+func (c *Client) refreshBoards(bot *gotgbot.Bot, report models.Report) {
+	c.mu.Lock()
+	watchers := make([]int64, 0, len(c.questionBoards[report.Ref()]))
+	for tgID := range c.questionBoards[report.Ref()] {
+		watchers = append(watchers, tgID)
+	}
+	c.mu.Unlock()
+
+	if len(watchers) == 0 {
+		return
+	}
+
+	questionList, err := c.reportQuestions(report)
+	if err != nil {
+		log.Printf("failed to select the questions of %s: %v", report.URL, err)
+		return
+	}
+
+	text, kb := formatQuestions(report, questionList), questionBoardKB(report, questionList)
+
+	for _, tgID := range watchers {
+		var payload questionPayload
+
+		state, errS := c.FSM.GetState(tgID)
+		if errS == nil && state.Name == questionBoard {
+			errS = state.Decode(&payload)
+		}
+
+		if errS != nil || state.Name != questionBoard || payload.URL != report.URL || payload.ConferenceID != report.ConferenceID {
+			c.mu.Lock()
+			delete(c.questionBoards[report.Ref()], tgID)
+			c.mu.Unlock()
+			continue
+		}
+
+		_, _, errE := bot.EditMessageText(text, &gotgbot.EditMessageTextOpts{ChatId: tgID, MessageId: payload.MessageID, ReplyMarkup: kb})
+		if errE = ignoreNotModified(errE); errE != nil {
+			log.Printf("failed to update the question board of user %d: %v", tgID, errE)
+		}
+	}
+}
+
+// ignoreNotModified drops the error Telegram returns when a message is edited to the same content.
+func ignoreNotModified(err error) error {
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
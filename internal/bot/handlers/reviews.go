@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/xuri/excelize/v2"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of the reviews export.
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// Sheets of the XLSX reviews export.
+const (
+	reviewsSheet   = "Отзывы"
+	summarySheet   = "Сводка"
+	questionsSheet = "Вопросы"
+	pollsSheet     = "Опросы"
+)
+
+// reviewsExport is the content of the reviews file of a conference.
+type reviewsExport struct {
+	Reports     []reportStats       `json:"reports"`     // Reports are the aggregated evaluations of each report.
+	Evaluations []models.Evaluation `json:"evaluations"` // Evaluations are all the evaluations of the reports.
+	Questions   []models.Question   `json:"questions"`   // Questions are the questions of the audience to the speakers.
+	Polls       []models.Poll       `json:"polls"`       // Polls are the live polls of the reports with their results.
+
+	reports        []models.Report        // reports are the reports of the conference.
+	questionnaires []models.Questionnaire // questionnaires are the questionnaires of the conference.
+	users          map[int]models.User    // users are the reviewers by their Telegram IDs.
+}
+
+// reportStats are the aggregated evaluations of a report.
+type reportStats struct {
+	URL          string           `json:"url"`          // URL is the URL of the report.
+	Title        string           `json:"title"`        // Title is the title of the report.
+	Speakers     string           `json:"speakers"`     // Speakers are the speakers of the report.
+	Evaluations  int              `json:"evaluations"`  // Evaluations is the number of evaluations, including the declined ones.
+	DidNotAttend int              `json:"didNotAttend"` // DidNotAttend is the number of users who didn't listen to the report.
+	Declined     int              `json:"declined"`     // Declined is the number of users who didn't want to rate the report.
+	Comments     int              `json:"comments"`     // Comments is the number of evaluations with a comment or a free text answer.
+	Criteria     []criterionStats `json:"criteria"`     // Criteria are the aggregated marks of the scales of the questionnaire.
+}
+
+// criterionStats are the aggregated marks of a scale of the questionnaire.
+type criterionStats struct {
+	ID           string  `json:"id"`           // ID is the ID of the questionnaire item.
+	Text         string  `json:"text"`         // Text is the question of the item.
+	Count        int     `json:"count"`        // Count is the number of marks.
+	Mean         float64 `json:"mean"`         // Mean is the average mark rounded to hundredths.
+	Median       float64 `json:"median"`       // Median is the median mark.
+	Min          int     `json:"min"`          // Min is the lowest mark of the scale.
+	Distribution []int   `json:"distribution"` // Distribution are the numbers of each mark from Min to the highest mark.
+}
+
+// evaluationAnswer returns the answer of the evaluation to the item.
+// Evaluations made before the questionnaires were introduced have only the marks and the comment.
+func evaluationAnswer(evaluation models.Evaluation, id string) string {
+	if len(evaluation.Answers) != 0 {
+		return evaluation.Answers[id]
+	}
+
+	switch id {
+	case models.ItemContent:
+		return evaluation.Content
+	case models.ItemPerformance:
+		return evaluation.Performance
+	case models.ItemComment:
+		return evaluation.Comment
+	}
+
+	return ""
+}
+
+// hasComment reports whether the evaluation has a comment or answers a free text item of the questionnaire.
+func hasComment(items []models.QuestionnaireItem, evaluation models.Evaluation) bool {
+	if strings.TrimSpace(evaluation.Comment) != "" {
+		return true
+	}
+
+	for _, item := range items {
+		if item.Type == models.ItemText && strings.TrimSpace(evaluationAnswer(evaluation, item.ID)) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// criterionStatistics aggregates the marks of the evaluations for the scale, marks out of its range are skipped.
+func criterionStatistics(item models.QuestionnaireItem, evaluations []models.Evaluation) criterionStats {
+	stats := criterionStats{ID: item.ID, Text: item.Text, Min: item.Min, Distribution: make([]int, item.Max-item.Min+1)}
+
+	var marks []int
+
+	for _, evaluation := range evaluations {
+		mark, err := strconv.Atoi(evaluationAnswer(evaluation, item.ID))
+		if err != nil || mark < item.Min || mark > item.Max {
+			continue
+		}
+		marks = append(marks, mark)
+		stats.Distribution[mark-item.Min]++
+	}
+
+	stats.Count = len(marks)
+
+	if stats.Count == 0 {
+		return stats
+	}
+
+	sort.Ints(marks)
+
+	sum := 0
+	for _, mark := range marks {
+		sum += mark
+	}
+
+	stats.Mean = math.Round(float64(sum)/float64(stats.Count)*100) / 100
+	stats.Median = float64(marks[(stats.Count-1)/2]+marks[stats.Count/2]) / 2
+
+	return stats
+}
+
+// reportStatistics aggregates the evaluations of the report by the scales of its questionnaire.
+func reportStatistics(report models.Report, items []models.QuestionnaireItem, evaluations []models.Evaluation) reportStats {
+	stats := reportStats{URL: report.URL, Title: report.Title, Speakers: report.Speakers, Evaluations: len(evaluations)}
+
+	var rated []models.Evaluation
+
+	for _, evaluation := range evaluations {
+		switch evaluation.Content {
+		case noEvaluate:
+			stats.DidNotAttend++
+			continue
+		case noWishToEvaluate:
+			stats.Declined++
+			continue
+		}
+		if hasComment(items, evaluation) {
+			stats.Comments++
+		}
+		rated = append(rated, evaluation)
+	}
+
+	for _, item := range items {
+		if item.Type == models.ItemScale {
+			stats.Criteria = append(stats.Criteria, criterionStatistics(item, rated))
+		}
+	}
+
+	return stats
+}
+
+// reviews returns every evaluation of the reports of the conference with the aggregated evaluations of each report,
+// the questions of the audience and the polls.
+func (c *Client) reviews(conference models.Conference) (reviewsExport, error) {
+	reports, err := c.Database.SelectReports(conference.ID)
+	if err != nil {
+		return reviewsExport{}, err
+	}
+
+	evaluations, err := c.Database.SelectAllEvaluations(conference.ID)
+	if err != nil {
+		return reviewsExport{}, err
+	}
+
+	questionnaires, err := c.Database.SelectQuestionnaires(conference.ID)
+	if err != nil {
+		return reviewsExport{}, err
+	}
+
+	users, err := c.Database.SelectUsers()
+	if err != nil {
+		return reviewsExport{}, err
+	}
+
+	export := reviewsExport{reports: reports, questionnaires: questionnaires, users: make(map[int]models.User, len(users))}
+
+	for _, user := range users {
+		export.users[user.TgID] = user
+	}
+
+	byURL := make(map[string][]models.Evaluation, len(reports))
+	for _, report := range reports {
+		byURL[report.URL] = nil
+	}
+
+	for _, evaluation := range evaluations {
+		if _, exists := byURL[evaluation.URL]; exists {
+			byURL[evaluation.URL] = append(byURL[evaluation.URL], evaluation)
+			export.Evaluations = append(export.Evaluations, evaluation)
+		}
+	}
+
+	for _, report := range reports {
+		export.Reports = append(export.Reports, reportStatistics(report, questionnaireItems(questionnaires, report), byURL[report.URL]))
+	}
+
+	if export.Questions, err = c.Database.SelectQuestions(conference.ID); err != nil {
+		return reviewsExport{}, err
+	}
+
+	if export.Polls, err = c.Database.SelectPolls(conference.ID); err != nil {
+		return reviewsExport{}, err
+	}
+
+	return export, nil
+}
+
+// reviewColumn is a column of the answers in the table of the reviews.
+type reviewColumn struct {
+	id    string // id is the ID of the questionnaire item.
+	title string // title is the question of the item.
+	scale bool   // scale is true if the answers are marks.
+}
+
+// reviewColumns returns the columns of the answers: the items of the questionnaires of the conference in the order they are asked,
+// then the items of the default questionnaire and the items that are no longer asked.
+func (e reviewsExport) reviewColumns() []reviewColumn {
+	var columns []reviewColumn
+
+	seen := make(map[string]bool)
+
+	add := func(items []models.QuestionnaireItem) {
+		for _, item := range items {
+			if !seen[item.ID] {
+				seen[item.ID] = true
+				columns = append(columns, reviewColumn{id: item.ID, title: item.Text, scale: item.Type == models.ItemScale})
+			}
+		}
+	}
+
+	for _, questionnaire := range e.questionnaires {
+		add(questionnaire.Items)
+	}
+	add(models.DefaultQuestionnaire())
+
+	var removed []string
+	for _, evaluation := range e.Evaluations {
+		for id := range evaluation.Answers {
+			if !seen[id] {
+				seen[id] = true
+				removed = append(removed, id)
+			}
+		}
+	}
+	sort.Strings(removed)
+
+	for _, id := range removed {
+		columns = append(columns, reviewColumn{id: id, title: id})
+	}
+
+	return columns
+}
+
+// reportTime returns the start time of the report in the location, empty if the report has none.
+// Report times are Moscow wall times.
+func reportTime(report models.Report, location *time.Location) (string, error) {
+	if report.StartTime.IsZero() {
+		return "", nil
+	}
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return "", err
+	}
+
+	t := report.StartTime
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, moscow)
+
+	return start.In(location).Format("02.01.2006 15:04"), nil
+}
+
+// evaluationStatus returns whether the user rated the report, didn't listen to it or didn't want to rate it.
+func evaluationStatus(evaluation models.Evaluation) string {
+	switch evaluation.Content {
+	case noEvaluate:
+		return "Не слушал"
+	case noWishToEvaluate:
+		return "Не захотел оценивать"
+	}
+	return "Оценил"
+}
+
+// reviewRows returns the table of the reviews: a header and a row for each evaluation joined with its report and its reviewer.
+// The marks are numbers, so a spreadsheet can aggregate them.
+func (e reviewsExport) reviewRows(location *time.Location) ([][]interface{}, error) {
+	columns := e.reviewColumns()
+
+	header := []interface{}{"Доклад", "Спикеры", "Время", "URL", "Telegram ID", "Идентификация", "Статус"}
+	for _, column := range columns {
+		header = append(header, column.title)
+	}
+
+	reports := e.reportsByURL()
+
+	rows := [][]interface{}{header}
+
+	for _, evaluation := range e.Evaluations {
+		report := reports[evaluation.URL]
+
+		start, err := reportTime(report, location)
+		if err != nil {
+			return nil, err
+		}
+
+		row := []interface{}{report.Title, report.Speakers, start, report.URL, evaluation.TgID,
+			e.users[evaluation.TgID].Identification, evaluationStatus(evaluation)}
+
+		declined := evaluation.Content == noEvaluate || evaluation.Content == noWishToEvaluate
+
+		for _, column := range columns {
+			var answer string
+			if !declined {
+				answer = evaluationAnswer(evaluation, column.id)
+			}
+			if mark, errA := strconv.Atoi(answer); errA == nil && column.scale {
+				row = append(row, mark)
+				continue
+			}
+			row = append(row, answer)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// summaryRows returns the table of the aggregated evaluations: a header and a row for each scale of each report.
+// A report without scales has a single row without the marks.
+func (e reviewsExport) summaryRows(location *time.Location) ([][]interface{}, error) {
+	rows := [][]interface{}{{"Доклад", "Спикеры", "Время", "URL", "Отзывов", "Не слушали", "Не захотели оценивать",
+		"Комментариев", "Критерий", "Оценок", "Среднее", "Медиана", "Распределение"}}
+
+	for ind, stats := range e.Reports {
+		start, err := reportTime(e.reports[ind], location)
+		if err != nil {
+			return nil, err
+		}
+
+		report := []interface{}{stats.Title, stats.Speakers, start, stats.URL, stats.Evaluations, stats.DidNotAttend, stats.Declined, stats.Comments}
+
+		if len(stats.Criteria) == 0 {
+			rows = append(rows, report)
+		}
+
+		for _, criterion := range stats.Criteria {
+			var distribution []string
+			for mark, count := range criterion.Distribution {
+				distribution = append(distribution, fmt.Sprintf("%d: %d", criterion.Min+mark, count))
+			}
+
+			row := append(append([]interface{}(nil), report...), criterion.Text, criterion.Count,
+				criterion.Mean, criterion.Median, strings.Join(distribution, ", "))
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+// reportsByURL returns the reports of the export by their URLs.
+func (e reviewsExport) reportsByURL() map[string]models.Report {
+	reports := make(map[string]models.Report, len(e.reports))
+	for _, report := range e.reports {
+		reports[report.URL] = report
+	}
+	return reports
+}
+
+// questionRows returns the table of the questions of the audience: a header and a row for each question.
+func (e reviewsExport) questionRows(location *time.Location) [][]interface{} {
+	reports := e.reportsByURL()
+
+	rows := [][]interface{}{{"Доклад", "Спикеры", "URL", "Вопрос", "Голосов", "Отвечен", "Задан", "Telegram ID"}}
+
+	for _, question := range e.Questions {
+		report := reports[question.URL]
+
+		answered := "Нет"
+		if question.Answered {
+			answered = "Да"
+		}
+
+		rows = append(rows, []interface{}{report.Title, report.Speakers, question.URL, question.Text, question.Votes, answered,
+			question.AskedAt.In(location).Format("02.01.2006 15:04"), question.TgID})
+	}
+
+	return rows
+}
+
+// pollRows returns the table of the live polls: a header and a row for each option of each poll.
+func (e reviewsExport) pollRows(location *time.Location) [][]interface{} {
+	reports := e.reportsByURL()
+
+	rows := [][]interface{}{{"Доклад", "Спикеры", "URL", "Опрос", "Запущен", "Статус", "Вариант", "Голосов"}}
+
+	for _, poll := range e.Polls {
+		report := reports[poll.URL]
+
+		status := "Открыт"
+		if poll.Closed {
+			status = "Закрыт"
+		}
+
+		for ind, option := range poll.Options {
+			count := 0
+			if ind < len(poll.Counts) {
+				count = poll.Counts[ind]
+			}
+
+			rows = append(rows, []interface{}{report.Title, report.Speakers, poll.URL, poll.Question,
+				poll.CreatedAt.In(location).Format("02.01.2006 15:04"), status, option, count})
+		}
+	}
+
+	return rows
+}
+
+// encodeCSV encodes the table as CSV separated by semicolons with a byte order mark, so spreadsheets with
+// the Russian locale open it in columns and with the right encoding.
+func encodeCSV(rows [][]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString("\uFEFF")
+
+	writer := csv.NewWriter(&buf)
+	writer.Comma = ';'
+
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = fmt.Sprint(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+// encodeXLSX encodes the tables as a workbook with a sheet for each of them, in the order of the names.
+func encodeXLSX(names []string, sheets map[string][][]interface{}) ([]byte, error) {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	for ind, name := range names {
+		var err error
+		if ind == 0 {
+			err = file.SetSheetName(file.GetSheetName(0), name)
+		} else {
+			_, err = file.NewSheet(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for row, values := range sheets[name] {
+			cell, errC := excelize.CoordinatesToCellName(1, row+1)
+			if errC != nil {
+				return nil, errC
+			}
+			if err = file.SetSheetRow(name, cell, &values); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encode returns the export in the format with the file name. The times of CSV and XLSX are shown in the location.
+// CSV holds only the reviews, XLSX also holds the summary, the questions and the polls.
+func (e reviewsExport) encode(format string, location *time.Location) ([]byte, string, error) {
+	switch format {
+	case formatCSV:
+		rows, err := e.reviewRows(location)
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := encodeCSV(rows)
+		return data, "reviews.csv", err
+	case formatXLSX:
+		reviews, err := e.reviewRows(location)
+		if err != nil {
+			return nil, "", err
+		}
+		summary, err := e.summaryRows(location)
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := encodeXLSX([]string{reviewsSheet, summarySheet, questionsSheet, pollsSheet}, map[string][][]interface{}{
+			reviewsSheet: reviews, summarySheet: summary, questionsSheet: e.questionRows(location), pollsSheet: e.pollRows(location)})
+		return data, "reviews.xlsx", err
+	default:
+		data, err := json.Marshal(e)
+		return data, "reviews.json", err
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestCriterionStatistics(t *testing.T) {
+	scale := models.QuestionnaireItem{ID: "content", Type: models.ItemScale, Text: "Содержание", Min: 1, Max: 5}
+	nps := models.QuestionnaireItem{ID: "nps", Type: models.ItemScale, Text: "NPS", Min: 0, Max: 10}
+
+	answers := func(id string, marks ...string) []models.Evaluation {
+		evaluations := make([]models.Evaluation, 0, len(marks))
+		for _, mark := range marks {
+			evaluations = append(evaluations, models.Evaluation{Answers: map[string]string{id: mark}})
+		}
+		return evaluations
+	}
+
+	tests := []struct {
+		name        string
+		item        models.QuestionnaireItem
+		evaluations []models.Evaluation
+		want        criterionStats
+	}{
+		{
+			name: "no evaluations",
+			item: scale,
+			want: criterionStats{ID: "content", Text: "Содержание", Min: 1, Distribution: []int{0, 0, 0, 0, 0}},
+		},
+		{
+			name:        "odd number of marks",
+			item:        scale,
+			evaluations: answers("content", "5", "3", "4"),
+			want:        criterionStats{ID: "content", Text: "Содержание", Count: 3, Mean: 4, Median: 4, Min: 1, Distribution: []int{0, 0, 1, 1, 1}},
+		},
+		{
+			name:        "even number of marks",
+			item:        scale,
+			evaluations: answers("content", "1", "2", "4", "5"),
+			want:        criterionStats{ID: "content", Text: "Содержание", Count: 4, Mean: 3, Median: 3, Min: 1, Distribution: []int{1, 1, 0, 1, 1}},
+		},
+		{
+			name:        "mean is rounded",
+			item:        scale,
+			evaluations: answers("content", "5", "4", "4"),
+			want:        criterionStats{ID: "content", Text: "Содержание", Count: 3, Mean: 4.33, Median: 4, Min: 1, Distribution: []int{0, 0, 0, 2, 1}},
+		},
+		{
+			name:        "invalid marks are skipped",
+			item:        scale,
+			evaluations: append(answers("content", "0", "6", "отлично", "", "2"), answers("other", "5")...),
+			want:        criterionStats{ID: "content", Text: "Содержание", Count: 1, Mean: 2, Median: 2, Min: 1, Distribution: []int{0, 1, 0, 0, 0}},
+		},
+		{
+			name:        "scale from zero",
+			item:        nps,
+			evaluations: answers("nps", "0", "10"),
+			want:        criterionStats{ID: "nps", Text: "NPS", Count: 2, Mean: 5, Median: 5, Min: 0, Distribution: []int{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		},
+		{
+			name:        "evaluation of the default questionnaire",
+			item:        models.QuestionnaireItem{ID: models.ItemContent, Type: models.ItemScale, Text: "Содержание", Min: 1, Max: 5},
+			evaluations: []models.Evaluation{{Content: "4"}, {Content: noEvaluate}},
+			want:        criterionStats{ID: models.ItemContent, Text: "Содержание", Count: 1, Mean: 4, Median: 4, Min: 1, Distribution: []int{0, 0, 0, 1, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := criterionStatistics(tt.item, tt.evaluations); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("criterionStatistics() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Permissions checked by the handlers.
+const (
+	permRoles       = "roles"       // permRoles allows granting and revoking roles.
+	permConferences = "conferences" // permConferences allows creating conferences.
+	permSchedule    = "schedule"    // permSchedule allows uploading the schedule of the conference.
+	permReviews     = "reviews"     // permReviews allows downloading the reviews of the conference.
+	permBroadcast   = "broadcast"   // permBroadcast allows sending broadcasts to the users of the conference.
+	permAnnounce    = "announce"    // permAnnounce allows scheduling announcements for the users of the conference.
+	permModerate    = "moderate"    // permModerate allows moderating the audience of the conference.
+	permSimulate    = "simulate"    // permSimulate allows running the time simulation.
+	permSpeakers    = "speakers"    // permSpeakers allows linking the speakers to the reports of the conference.
+	permTalks       = "talks"       // permTalks allows viewing the feedback of the own reports.
+)
+
+// rolePermissions are the permissions of the roles granted for a conference. Owners have every permission everywhere.
+var rolePermissions = map[string][]string{
+	models.RoleOrganizer: {permSchedule, permReviews, permBroadcast, permAnnounce, permModerate, permSimulate, permSpeakers},
+	models.RoleModerator: {permAnnounce, permModerate},
+	models.RoleSpeaker:   {permTalks},
+}
+
+// roleNames are the human-readable names of the roles.
+var roleNames = map[string]string{
+	models.RoleOwner:     "владелец",
+	models.RoleOrganizer: "организатор",
+	models.RoleModerator: "модератор",
+	models.RoleSpeaker:   "спикер",
+}
+
+// roleAuditSize is the number of the latest audit trail entries shown to owners.
+const roleAuditSize = 20
+
+// permissions returns the permissions of the user in the conference they picked.
+// Errors are treated as the absence of permissions, so a broken database never grants anything.
+func (c *Client) permissions(tgID int64) map[string]bool {
+	userRoles, err := c.Database.SelectUserRoles(int(tgID))
+	if err != nil || len(userRoles) == 0 {
+		return nil
+	}
+
+	conferenceID, err := c.Database.SelectUserConference(int(tgID))
+	if err != nil {
+		conferenceID = models.DefaultConferenceID
+	}
+
+	permissions := make(map[string]bool)
+
+	for _, role := range userRoles {
+		if role.Role == models.RoleOwner {
+			for _, granted := range rolePermissions[models.RoleOrganizer] {
+				permissions[granted] = true
+			}
+			permissions[permRoles], permissions[permConferences] = true, true
+			continue
+		}
+
+		if role.ConferenceID != conferenceID {
+			continue
+		}
+
+		for _, granted := range rolePermissions[role.Role] {
+			permissions[granted] = true
+		}
+	}
+
+	return permissions
+}
+
+// can reports whether the user has the permission in the conference they picked.
+func (c *Client) can(tgID int64, permission string) bool {
+	return c.permissions(tgID)[permission]
+}
+
+// allow is the permission middleware: the handler runs only for the users with the permission.
+// Commands of the other users are deleted, their button presses are answered with a notice.
+func (c *Client) allow(permission string, handler handlers.Response) handlers.Response {
+	return func(bot *gotgbot.Bot, ctx *ext.Context) error {
+		if c.can(ctx.EffectiveUser.Id, permission) {
+			return handler(bot, ctx)
+		}
+
+		if cb := ctx.CallbackQuery; cb != nil {
+			_, err := cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Недостаточно прав"})
+			return err
+		}
+
+		_, err := bot.DeleteMessage(ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, nil)
+
+		return err
+	}
+}
+
+// revoked returns a user who lost the permission of their flow, e.g. by a revoked role, to the main menu.
+func (c *Client) revoked(bot *gotgbot.Bot, ctx *ext.Context) error {
+	if err := c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
+		return err
+	}
+
+	_, err := bot.SendMessage(ctx.EffectiveChat.Id, "Недостаточно прав, я вернул вас в главное меню", &gotgbot.SendMessageOpts{ReplyMarkup: c.mainMenuKB(ctx.EffectiveUser.Id)})
+
+	return err
+}
+
+// mainMenuKB returns the main menu keyboard of the user with the buttons allowed by their permissions.
+func (c *Client) mainMenuKB(tgID int64) gotgbot.InlineKeyboardMarkup {
+	permissions := c.permissions(tgID)
+	return mainMenuKB(func(permission string) bool { return permissions[permission] })
+}
+
+// roleCommand parses the arguments of the grant and revoke commands: the Telegram ID of the user and the role.
+func roleCommand(text, command string) (int, string, error) {
+	args := strings.Fields(strings.TrimPrefix(text, fmt.Sprintf("/%s", command)))
+	if len(args) != 2 {
+		return 0, "", fmt.Errorf("нужны Telegram ID пользователя и роль, например /%s 123456789 %s", command, models.RoleModerator)
+	}
+
+	tgID, err := strconv.Atoi(args[0])
+	if err != nil || tgID <= 0 {
+		return 0, "", fmt.Errorf("%q не похож на Telegram ID", args[0])
+	}
+
+	role := strings.ToLower(args[1])
+	if !slices.Contains(models.Roles, role) {
+		return 0, "", fmt.Errorf("роли %q нет, доступны: %s", args[1], strings.Join(models.Roles, ", "))
+	}
+
+	return tgID, role, nil
+}
+
+// roleConference returns the conference the role is granted for: none for owners, the conference the owner picked for the others.
+func (c *Client) roleConference(tgID int64, role string) (string, error) {
+	if role == models.RoleOwner {
+		return "", nil
+	}
+
+	conference, err := c.conference(tgID)
+	if err != nil {
+		return "", err
+	}
+
+	return conference.ID, nil
+}
+
+func (c *Client) grantHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	tgID, role, err := roleCommand(ctx.EffectiveMessage.Text, grant)
+	if err != nil {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v", err), nil)
+		return err
+	}
+
+	conferenceID, err := c.roleConference(ctx.EffectiveUser.Id, role)
+	if err != nil {
+		return err
+	}
+
+	granted, err := c.Database.GrantRole(models.UserRole{TgID: tgID, Role: role, ConferenceID: conferenceID,
+		GrantedBy: int(ctx.EffectiveUser.Id), GrantedAt: c.now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Пользователь %d теперь %s%s", tgID, roleNames[role], conferenceSuffix(conferenceID))
+	if !granted {
+		text = fmt.Sprintf("Пользователь %d уже %s%s", tgID, roleNames[role], conferenceSuffix(conferenceID))
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+func (c *Client) revokeHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	tgID, role, err := roleCommand(ctx.EffectiveMessage.Text, revoke)
+	if err != nil {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v", err), nil)
+		return err
+	}
+
+	if role == models.RoleOwner && tgID == int(ctx.EffectiveUser.Id) {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Нельзя отозвать роль владельца у самого себя, попросите другого владельца", nil)
+		return err
+	}
+
+	conferenceID, err := c.roleConference(ctx.EffectiveUser.Id, role)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := c.Database.RevokeRole(tgID, role, conferenceID, int(ctx.EffectiveUser.Id))
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Пользователь %d больше не %s%s", tgID, roleNames[role], conferenceSuffix(conferenceID))
+	if !revoked {
+		text = fmt.Sprintf("Пользователь %d и так не %s%s", tgID, roleNames[role], conferenceSuffix(conferenceID))
+	}
+	if role == models.RoleOwner && slices.Contains(c.Cfg.Administrators.IDs, tgID) {
+		text += ". Он указан в ADMIN_IDS_LIST, поэтому снова станет владельцем после перезапуска бота"
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+func (c *Client) rolesHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	list, err := c.Database.SelectRoles(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Роли на конференции «%s»:\n\n", conference.Name)
+	for _, role := range list {
+		text += fmt.Sprintf("• %d — %s\n", role.TgID, roleNames[role.Role])
+	}
+
+	text += fmt.Sprintf("\nВыдать роль: /%s <Telegram ID> <роль>\nОтозвать: /%s <Telegram ID> <роль>\nРоли: %s\nИстория изменений: /%s",
+		grant, revoke, strings.Join(models.Roles, ", "), audit)
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+func (c *Client) auditHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	entries, err := c.Database.SelectRoleAudit(roleAuditSize)
+	if err != nil {
+		return err
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return err
+	}
+
+	text := "Роли ещё не менялись"
+
+	if len(entries) != 0 {
+		text = "Последние изменения ролей:\n\n"
+		for _, entry := range entries {
+			action := "выдал"
+			if entry.Action == models.RoleRevoked {
+				action = "отозвал"
+			}
+
+			by := strconv.Itoa(entry.By)
+			if entry.By == 0 {
+				by = "ADMIN_IDS_LIST"
+			}
+
+			text += fmt.Sprintf("%s %s %s роль «%s» пользователю %d%s\n", entry.At.In(location).Format("02.01.2006 15:04"),
+				by, action, roleNames[entry.Role], entry.TgID, conferenceSuffix(entry.ConferenceID))
+		}
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+// conferenceSuffix returns the mention of the conference of a role, owners are not bound to a conference.
+func conferenceSuffix(conferenceID string) string {
+	if conferenceID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" на конференции %s", conferenceID)
+}
@@ -3,9 +3,13 @@ package handlers
 
 import (
 	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/config"
-	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/mongodb"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
@@ -24,33 +28,83 @@ const (
 	back                 = "back"
 	downloadReviews      = "downloadReviews"
 	index                = "index"
+	reportCard           = "reportCard"
 	evaluateReport       = "evaluateReport"
 	notEvaluateReport    = "notEvaluateReport"
 	evaluationBegin      = "evaluationBegin"
 	noWishToEvaluate     = "noWishToEvaluate"
 	noEvaluate           = "noEvaluate"
-	evaluationEnd        = "evaluationEnd"
-	backToContent        = "backToContent"
 	threePoints          = "..."
 	userEvaluations      = "userEvaluations"
 	updateEvaluation     = "updateEvaluation"
 	deleteEvaluation     = "deleteEvaluation"
-	updateContent        = "updateContent"
-	updatePerformance    = "updatePerformance"
-	updateComment        = "updateComment"
-	updateNoComment      = "updateNoComment"
 	help                 = "help"
+	broadcast            = "broadcast"
+	broadcastCompose     = "broadcastCompose"
+	broadcastSend        = "broadcastSend"
+	announcements        = "announcements"
+	announce             = "announce"
+	announceCreate       = "announceCreate"
+	announceEdit         = "announceEdit"
+	announceCancel       = "announceCancel"
+	simulate             = "simulate"
+	conferences          = "conferences"
+	conferencePick       = "conferencePick"
+	conferenceCreate     = "conferenceCreate"
+	grant                = "grant"
+	revoke               = "revoke"
+	roles                = "roles"
+	audit                = "audit"
+	linkSpeaker          = "speaker"
+	unlinkSpeaker        = "unspeaker"
+	speakers             = "speakers"
+	myTalks              = "myTalks"
+	myTalk               = "myTalk"
+	questions            = "questions"
+	questionReport       = "questionReport"
+	questionBoard        = "questionBoard"
+	askQuestion          = "askQuestion"
+	upvoteQuestion       = "upvoteQuestion"
+	answerQuestion       = "answerQuestion"
+	pollCreate           = "pollCreate"
+	pollVote             = "pollVote"
+	pollClose            = "pollClose"
+	uploadQuestionnaire  = "uploadQuestionnaire"
+	conferenceSurvey     = "conferenceSurvey"
+	downloadSurveys      = "downloadSurveys"
 )
 
 // Set adds handlers for different types of user interactions to the dispatcher.
 // Each handler is responsible for a specific type of interaction, such as a command or a callback.
+// Handlers of the staff are wrapped with the permission middleware.
 func Set(dispatcher *ext.Dispatcher, c *Client) {
+	c.conversations = conversation.New(c.FSM)
+	c.evaluation = conversation.Register(c.conversations, c.evaluationConversation())
+	c.evaluationUpdate = conversation.Register(c.conversations, c.evaluationUpdateConversation())
+	c.survey = conversation.Register(c.conversations, c.surveyConversation())
+	c.conferenceCreate = conversation.Register(c.conversations, c.conferenceCreateConversation())
+	c.broadcast = conversation.Register(c.conversations, c.broadcastConversation())
+
+	dispatcher.AddHandlerToGroup(handlers.NewMessage(message.All, c.staleStateHandler), -1)
+	dispatcher.AddHandlerToGroup(handlers.NewCallback(callbackquery.All, c.staleStateHandler), -1)
+
 	dispatcher.AddHandler(handlers.NewCommand(start, c.startHandler))
 	dispatcher.AddHandler(handlers.NewCommand(help, c.helpHandler))
+	dispatcher.AddHandler(handlers.NewCommand(broadcast, c.allow(permBroadcast, c.broadcastHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(announcements, c.allow(permAnnounce, c.announcementsHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(announce, c.allow(permAnnounce, c.announceHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(simulate, c.allow(permSimulate, c.simulateHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(grant, c.allow(permRoles, c.grantHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(revoke, c.allow(permRoles, c.revokeHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(roles, c.allow(permRoles, c.rolesHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(audit, c.allow(permRoles, c.auditHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(linkSpeaker, c.allow(permSpeakers, c.speakerHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(unlinkSpeaker, c.allow(permSpeakers, c.unspeakerHandler)))
+	dispatcher.AddHandler(handlers.NewCommand(speakers, c.allow(permSpeakers, c.speakersHandler)))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(confInfo), c.confInfoCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(viewReports), c.viewReportsCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(updateIdentification), c.changeIdentificationCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(uploadSchedule), c.uploadScheduleCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(uploadSchedule), c.allow(permSchedule, c.uploadScheduleCBHandler)))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(back), c.backCBHandler))
 	dispatcher.AddHandler(handlers.NewMessage(message.Text, c.textHandler))
 	dispatcher.AddHandler(handlers.NewMessage(message.Document, c.fileHandler))
@@ -62,33 +116,58 @@ func Set(dispatcher *ext.Dispatcher, c *Client) {
 	dispatcher.AddHandler(handlers.NewMessage(message.Story, c.storyHandler))
 	dispatcher.AddHandler(handlers.NewMessage(message.VideoNote, c.videoNoteHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(index), c.indexHandlerCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", reportCard)), c.reportCardCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("add;"), c.addToFavoriteCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("remove;"), c.removeFromFavoriteCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(threePoints), c.threePointsCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(notEvaluateReport), c.notEvaluateCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(evaluateReport), c.evaluateReportCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(evaluationBegin), c.evaluationBeginCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("content;"), c.contentCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(backToContent), c.backToContentCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("performance;"), c.performanceCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(evaluationEnd), c.evaluateEndNoCommentCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(noWishToEvaluate), c.noWishToEvaluateCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(noEvaluate), c.noEvaluateCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(conversation.ChoicePrefix), c.conversations.ChoiceCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(conversation.Back), c.conversations.BackCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(userEvaluations), c.userEvaluationsCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", updateEvaluation)), c.updateEvaluationCBHandler))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", deleteEvaluation)), c.deleteEvaluationCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", updateContent)), c.updateContentCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", updatePerformance)), c.updatePerformanceCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(updateNoComment), c.updateWithNoCommentCBHandler))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(downloadReviews), c.downloadReviewsCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(downloadReviews), c.allow(permReviews, c.downloadReviewsCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", downloadReviews)), c.allow(permReviews, c.downloadReviewsFileCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(uploadQuestionnaire), c.allow(permReviews, c.uploadQuestionnaireCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(downloadSurveys), c.allow(permReviews, c.downloadSurveysCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(conferenceSurvey), c.surveyCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(broadcast), c.allow(permBroadcast, c.broadcastHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(announcements), c.allow(permAnnounce, c.announcementsCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(announceCreate), c.allow(permAnnounce, c.announceCreateCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", announceEdit)), c.allow(permAnnounce, c.announceEditCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", announceCancel)), c.allow(permAnnounce, c.announceCancelCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(conferences), c.conferencesCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", conferencePick)), c.conferencePickCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(conferenceCreate), c.allow(permConferences, c.conferenceCreateCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(myTalks), c.allow(permTalks, c.myTalksCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", myTalk)), c.allow(permTalks, c.myTalkCBHandler)))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(questions), c.questionsCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", questionReport)), c.questionReportCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", askQuestion)), c.askQuestionCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", upvoteQuestion)), c.upvoteQuestionCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", answerQuestion)), c.answerQuestionCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", pollCreate)), c.pollCreateCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", pollVote)), c.pollVoteCBHandler))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(fmt.Sprintf("%s;", pollClose)), c.pollCloseCBHandler))
 }
 
 // Client represents a client that can handle different types of user interactions.
-// It contains configuration information, a state controller, a database manipulator, and a map of notified users.
+// It contains configuration information, a state controller, a database manipulator, an outbound queue, a clock and a map of notified users.
 type Client struct {
-	Cfg           *config.Config          // Configuration information.
-	FSM           fsm.StateController     // State controller for managing user states.
-	Database      mongodb.DataManipulator // Database manipulator for interacting with the database.
-	NotifiedUsers map[string]bool         // Map of users who have been notified.
-	mu            sync.Mutex              // Mutex for synchronizing access to the NotifiedUsers map.
+	Cfg           *config.Config      // Configuration information.
+	FSM           fsm.StateController // State controller for managing user states.
+	Database      storage.Repository  // Repository of the bot data.
+	Sender        *sender.Queue       // Sender is the rate-limited queue for outbound messages.
+	Clock         clock.Clock         // Clock is the source of the current time.
+	NotifiedUsers map[string]bool     // Map of users who have been notified.
+
+	conversations    *conversation.Engine                          // Engine of the step-by-step conversations.
+	evaluation       *conversation.Conversation[evaluationPayload] // Conversation of a user evaluating a report.
+	evaluationUpdate *conversation.Conversation[evaluationPayload] // Conversation of a user updating an evaluation.
+	survey           *conversation.Conversation[surveyPayload]     // Conversation of a user answering the conference survey.
+	conferenceCreate *conversation.Conversation[conferencePayload] // Conversation of an owner creating a conference.
+	broadcast        *conversation.Conversation[broadcastDraft]    // Conversation of an admin composing a broadcast.
+	questionBoards   map[models.ReportRef]map[int64]bool           // Users watching the question boards by report.
+	mu               sync.Mutex                                    // Mutex for synchronizing access to the NotifiedUsers and questionBoards maps.
 }
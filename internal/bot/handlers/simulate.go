@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"strings"
+	"time"
+)
+
+// simulateUsage explains admins how to control the time simulation.
+const simulateUsage = "Симуляция времени позволяет прорепетировать конференцию: уведомления не уходят участникам, вы видите свои и сводку по остальным.\n\n" +
+	"/simulate ДД/ММ/ГГГГ ЧЧ:ММ — перенестись в указанное время (МСК)\n" +
+	"/simulate +30m — сдвинуть время вперёд\n" +
+	"/simulate off — вернуться к реальному времени"
+
+// now returns the current time of the client clock.
+func (c *Client) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+func (c *Client) simulateHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	sim, ok := c.Clock.(*clock.Simulated)
+	if !ok {
+		_, err := bot.SendMessage(ctx.EffectiveChat.Id, "Симуляция времени выключена. Включите её переменной TIME_SIMULATION_ENABLED на тестовом стенде", nil)
+		return err
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return err
+	}
+
+	arg := strings.TrimSpace(strings.TrimPrefix(ctx.EffectiveMessage.Text, fmt.Sprintf("/%s", simulate)))
+
+	switch {
+	case arg == "":
+		status := "Сейчас используется реальное время."
+		if _, active := sim.Observer(); active {
+			status = fmt.Sprintf("Идёт симуляция, сейчас %s.", sim.Now().In(location).Format("02.01.2006 15:04"))
+		}
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("%s\n\n%s", status, simulateUsage), nil)
+		return err
+	case arg == "off":
+		sim.Reset()
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Симуляция остановлена, вернулись к реальному времени", nil)
+		return err
+	case strings.HasPrefix(arg, "+"):
+		d, errP := time.ParseDuration(strings.TrimPrefix(arg, "+"))
+		if errP != nil {
+			_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не понял сдвиг \"%s\".\n\n%s", arg, simulateUsage), nil)
+			return err
+		}
+		if _, active := sim.Observer(); !active {
+			sim.Set(time.Now(), ctx.EffectiveChat.Id)
+		}
+		sim.Advance(d)
+	default:
+		t, errP := time.ParseInLocation(announcementLayout, arg, location)
+		if errP != nil {
+			_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не понял время \"%s\".\n\n%s", arg, simulateUsage), nil)
+			return err
+		}
+		sim.Set(t, ctx.EffectiveChat.Id)
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id,
+		fmt.Sprintf("🧪 Симуляция запущена, сейчас %s. Уведомления появятся здесь в течение 15 секунд", sim.Now().In(location).Format("02.01.2006 15:04")), nil)
+
+	return err
+}
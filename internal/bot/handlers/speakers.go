@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	talkCommentsLimit = 30   // talkCommentsLimit is the number of comments shown to a speaker.
+	talkCommentLength = 500  // talkCommentLength is the number of characters of a comment shown to a speaker, longer ones are shortened.
+	messageMaxLength  = 4096 // messageMaxLength is the maximal length of a Telegram message in UTF-16 code units.
+)
+
+// speakerCommand parses the arguments of the speaker and unspeaker commands: the Telegram ID of the user and the URL of the report.
+func speakerCommand(text, command string) (int, string, error) {
+	args := strings.Fields(strings.TrimPrefix(text, fmt.Sprintf("/%s", command)))
+	if len(args) != 2 {
+		return 0, "", fmt.Errorf("нужны Telegram ID спикера и ссылка на доклад, например /%s 123456789 https://golangconf.ru/2024/abstracts/1", command)
+	}
+
+	tgID, err := strconv.Atoi(args[0])
+	if err != nil || tgID <= 0 {
+		return 0, "", fmt.Errorf("%q не похож на Telegram ID", args[0])
+	}
+
+	return tgID, args[1], nil
+}
+
+// speakerHandler links a user to a report of the conference and makes them a speaker of it.
+func (c *Client) speakerHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	tgID, url, err := speakerCommand(ctx.EffectiveMessage.Text, linkSpeaker)
+	if err != nil {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v", err), nil)
+		return err
+	}
+
+	report, err := c.conferenceReport(ctx.EffectiveUser.Id, url)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Доклада с такой ссылкой нет в расписании вашей конференции", nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	now := c.now().UTC()
+
+	linked, err := c.Database.LinkSpeaker(models.SpeakerLink{TgID: tgID, URL: report.URL, ConferenceID: report.ConferenceID,
+		LinkedBy: int(ctx.EffectiveUser.Id), LinkedAt: now})
+	if err != nil {
+		return err
+	}
+
+	speaker := models.UserRole{TgID: tgID, Role: models.RoleSpeaker, ConferenceID: report.ConferenceID, GrantedBy: int(ctx.EffectiveUser.Id), GrantedAt: now}
+	if _, err = c.Database.GrantRole(speaker); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Пользователь %d теперь спикер доклада «%s» и увидит отзывы на него в разделе «Мои доклады»", tgID, report.Title)
+	if !linked {
+		text = fmt.Sprintf("Пользователь %d уже спикер доклада «%s»", tgID, report.Title)
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+// unspeakerHandler unlinks a user from a report. The speaker role is revoked when the user has no more reports at the conference.
+func (c *Client) unspeakerHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	tgID, url, err := speakerCommand(ctx.EffectiveMessage.Text, unlinkSpeaker)
+	if err != nil {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Не получилось: %v", err), nil)
+		return err
+	}
+
+	report, err := c.conferenceReport(ctx.EffectiveUser.Id, url)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Доклада с такой ссылкой нет в расписании вашей конференции", nil)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	unlinked, err := c.Database.UnlinkSpeaker(tgID, report.ConferenceID, report.URL)
+	if err != nil {
+		return err
+	}
+
+	if !unlinked {
+		_, err = bot.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf("Пользователь %d и так не спикер этого доклада", tgID), nil)
+		return err
+	}
+
+	links, err := c.Database.SelectSpeakerLinks(report.ConferenceID)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("Пользователь %d больше не спикер этого доклада", tgID)
+
+	if len(speakerURLs(links, tgID)) == 0 {
+		if _, err = c.Database.RevokeRole(tgID, models.RoleSpeaker, report.ConferenceID, int(ctx.EffectiveUser.Id)); err != nil {
+			return err
+		}
+		text += ". Других докладов на конференции у него нет, роль спикера отозвана"
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+// speakersHandler lists the reports of the conference with their linked speakers.
+func (c *Client) speakersHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	conference, err := c.conference(ctx.EffectiveUser.Id)
+	if err != nil {
+		return err
+	}
+
+	reports, err := c.Database.SelectReports(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	links, err := c.Database.SelectSpeakerLinks(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	linked := make(map[string][]string, len(links))
+	for _, link := range links {
+		linked[link.URL] = append(linked[link.URL], strconv.Itoa(link.TgID))
+	}
+
+	text := fmt.Sprintf("Спикеры конференции «%s»:\n\n", conference.Name)
+	for ind, report := range reports {
+		ids := "не привязаны"
+		if len(linked[report.URL]) != 0 {
+			ids = strings.Join(linked[report.URL], ", ")
+		}
+		text += fmt.Sprintf("%v. %s - %s\n%s\nTelegram ID: %s\n\n", ind+1, report.Speakers, report.Title, report.URL, ids)
+	}
+
+	text += fmt.Sprintf("Привязать спикера: /%s <Telegram ID> <ссылка на доклад>\nОтвязать: /%s <Telegram ID> <ссылка на доклад>", linkSpeaker, unlinkSpeaker)
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+
+	return err
+}
+
+// speakerURLs returns the URLs of the reports the user is linked to.
+func speakerURLs(links []models.SpeakerLink, tgID int) map[string]bool {
+	urls := make(map[string]bool)
+	for _, link := range links {
+		if link.TgID == tgID {
+			urls[link.URL] = true
+		}
+	}
+	return urls
+}
+
+// speakerReports returns the reports of the conference the user picked which the user speaks at.
+func (c *Client) speakerReports(tgID int64) (models.Conference, []models.Report, error) {
+	conference, err := c.conference(tgID)
+	if err != nil {
+		return models.Conference{}, nil, err
+	}
+
+	links, err := c.Database.SelectSpeakerLinks(conference.ID)
+	if err != nil {
+		return models.Conference{}, nil, err
+	}
+
+	reports, err := c.Database.SelectReports(conference.ID)
+	if err != nil {
+		return models.Conference{}, nil, err
+	}
+
+	urls := speakerURLs(links, int(tgID))
+
+	var own []models.Report
+	for _, report := range reports {
+		if urls[report.URL] {
+			own = append(own, report)
+		}
+	}
+
+	return conference, own, nil
+}
+
+// reviewsAvailable reports whether the reviews of the conference are available to the speakers at now.
+// It also returns the time they become available at in Moscow.
+func reviewsAvailable(conference models.Conference, now time.Time) (bool, time.Time, error) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	t := conference.TimeReviewsAvailable
+	availableAt := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+
+	return !now.Before(availableAt), availableAt, nil
+}
+
+func (c *Client) myTalksCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	if err := c.FSM.SetState(cb.From.Id, fsm.State{Name: myTalks}); err != nil {
+		return err
+	}
+
+	conference, reports, err := c.speakerReports(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	available, availableAt, err := reviewsAvailable(conference, c.now())
+	if err != nil {
+		return err
+	}
+
+	text := "Выберите доклад, чтобы посмотреть отзывы на него:"
+
+	switch {
+	case len(reports) == 0:
+		text = "Вы пока не привязаны ни к одному докладу этой конференции. Попросите организаторов привязать вас"
+	case !available:
+		text = fmt.Sprintf("Отзывы на ваши доклады будут доступны с %s (МСК)", availableAt.Format("02.01.2006 15:04"))
+		reports = nil
+	}
+
+	_, _, err = cb.Message.EditText(bot, text, &gotgbot.EditMessageTextOpts{ReplyMarkup: myTalksKB(reports)})
+
+	return err
+}
+
+func (c *Client) myTalkCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	url := strings.TrimPrefix(cb.Data, myTalk+";")
+
+	conference, reports, err := c.speakerReports(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	var report models.Report
+	for _, own := range reports {
+		if own.URL == url {
+			report = own
+		}
+	}
+
+	available, _, err := reviewsAvailable(conference, c.now())
+	if err != nil {
+		return err
+	}
+
+	if report.URL == "" || !available {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Отзывы на этот доклад вам недоступны"})
+		return err
+	}
+
+	all, err := c.Database.SelectAllEvaluations(report.ConferenceID)
+	if err != nil {
+		return err
+	}
+
+	var evaluations []models.Evaluation
+	for _, evaluation := range all {
+		if evaluation.URL == report.URL {
+			evaluations = append(evaluations, evaluation)
+		}
+	}
+
+	items, err := c.questionnaire(report)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(bot, formatTalkFeedback(report, items, evaluations), &gotgbot.EditMessageTextOpts{ReplyMarkup: backToMyTalksKB()})
+
+	return err
+}
+
+// formatCriterion returns the average and the distribution of the marks of the scale.
+func formatCriterion(stats criterionStats) string {
+	if stats.Count == 0 {
+		return "оценок пока нет\n"
+	}
+
+	maxMark := stats.Min + len(stats.Distribution) - 1
+
+	text := fmt.Sprintf("%.2f из %d (%d оценок)\n", stats.Mean, maxMark, stats.Count)
+	for mark := maxMark; mark >= stats.Min; mark-- {
+		amount := stats.Distribution[mark-stats.Min]
+		text += fmt.Sprintf("%d: %s %d\n", mark, strings.Repeat("▇", amount*10/stats.Count), amount)
+	}
+
+	return text
+}
+
+// talkComments returns the comments and the answers to the free text items of the rated evaluations.
+func talkComments(items []models.QuestionnaireItem, evaluations []models.Evaluation) []string {
+	var comments []string
+
+	for _, evaluation := range evaluations {
+		if evaluation.Content == noEvaluate || evaluation.Content == noWishToEvaluate {
+			continue
+		}
+
+		answers := []string{strings.TrimSpace(evaluation.Comment)}
+		for _, item := range items {
+			if item.Type == models.ItemText {
+				answers = append(answers, strings.TrimSpace(evaluationAnswer(evaluation, item.ID)))
+			}
+		}
+
+		slices.Sort(answers)
+		for _, answer := range slices.Compact(answers) {
+			if answer != "" {
+				comments = append(comments, answer)
+			}
+		}
+	}
+
+	return comments
+}
+
+// formatTalkFeedback returns the ratings of the report aggregated by the scales of its questionnaire and the comments.
+// Comments are sorted alphabetically, so their order doesn't tell who left them.
+func formatTalkFeedback(report models.Report, items []models.QuestionnaireItem, evaluations []models.Evaluation) string {
+	stats := reportStatistics(report, items, evaluations)
+	skipped := stats.DidNotAttend + stats.Declined
+
+	text := fmt.Sprintf("🎤 %s - %s\n\nОтзывов: %d, не оценили: %d\n\n", report.Speakers, report.Title, stats.Evaluations-skipped, skipped)
+
+	for _, criterion := range stats.Criteria {
+		text += fmt.Sprintf("📊 %s: %s", strings.TrimRight(criterion.Text, ": "), formatCriterion(criterion))
+	}
+
+	comments := talkComments(items, evaluations)
+	sort.Strings(comments)
+
+	text += "\n"
+
+	if len(comments) == 0 {
+		return text + "💬 Комментариев нет"
+	}
+
+	text += "💬 Комментарии:\n\n"
+	for ind, comment := range comments {
+		line := fmt.Sprintf("— %s\n", shorten(comment, talkCommentLength))
+		rest := fmt.Sprintf("…и ещё %d", len(comments)-ind)
+		if ind == talkCommentsLimit || messageLength(text+line+rest) > messageMaxLength {
+			text += rest
+			break
+		}
+		text += line
+	}
+
+	return shorten(text, messageMaxLength)
+}
+
+// shorten cuts the text to the length in UTF-16 code units, as Telegram counts them, marking the cut with an ellipsis.
+func shorten(text string, length int) string {
+	if messageLength(text) <= length {
+		return text
+	}
+
+	units := utf16.Encode([]rune(text))[:length-1]
+	if last := units[len(units)-1]; last >= 0xd800 && last < 0xdc00 {
+		// The cut splits a surrogate pair, its first half is dropped too.
+		units = units[:len(units)-1]
+	}
+
+	return string(utf16.Decode(units)) + "…"
+}
+
+// messageLength returns the length of the text in UTF-16 code units.
+func messageLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/fsm"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"strings"
+	"time"
+)
+
+// knownStates are the names of the states set by the handlers.
+var knownStates = map[string]bool{
+	start: true, menu: true, confInfo: true, viewReports: true, updateIdentification: true, uploadSchedule: true,
+	userEvaluations: true, deleteEvaluation: true, evaluateReport: true, updateEvaluation: true,
+	broadcastCompose: true,
+	announcements:    true, announceCreate: true, announceEdit: true,
+	conferences: true, conferenceCreate: true, myTalks: true,
+	questions: true, questionBoard: true, askQuestion: true, pollCreate: true, uploadQuestionnaire: true,
+	conferenceSurvey: true,
+}
+
+// StateTTLs returns the TTLs of the states which wait for the input of a user.
+// A user who doesn't finish such a flow in time is returned to the menu, so their next message isn't taken as the input.
+// The flows which need preparing a file or looking up the details of a conference get the longer longTTL.
+func StateTTLs(ttl, longTTL time.Duration) map[string]time.Duration {
+	return map[string]time.Duration{
+		updateIdentification: ttl,
+		uploadSchedule:       longTTL,
+		evaluateReport:       ttl,
+		updateEvaluation:     ttl,
+		broadcastCompose:     ttl,
+		announceCreate:       ttl,
+		announceEdit:         ttl,
+		conferenceCreate:     longTTL,
+		askQuestion:          ttl,
+		pollCreate:           ttl,
+		uploadQuestionnaire:  longTTL,
+		conferenceSurvey:     ttl,
+	}
+}
+
+// staleStateHandler runs before the other handlers and returns users with an expired or unknown state to the menu.
+// Abandoned flows are recorded for analytics. Commands are still handled after that, other updates are dropped.
+func (c *Client) staleStateHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	if ctx.EffectiveUser == nil {
+		return nil
+	}
+
+	state, err := c.FSM.GetState(ctx.EffectiveUser.Id)
+
+	switch {
+	case errors.Is(err, fsm.ErrExpired):
+	case err != nil:
+		return err
+	case state.Name == "" || state.Name == start || knownStates[state.Name]:
+		return nil
+	}
+
+	if err = c.FSM.SetState(ctx.EffectiveUser.Id, fsm.State{Name: menu}); err != nil {
+		return err
+	}
+
+	// A finished conversation keeps its name until the user goes elsewhere, there is nothing to recover.
+	if c.conversations.Owns(state.Name) && !c.conversations.Active(state) {
+		return nil
+	}
+
+	abandoned := models.AbandonedFlow{TgID: int(ctx.EffectiveUser.Id), State: state.Name, EnteredAt: state.EnteredAt, AbandonedAt: time.Now().UTC()}
+	if len(state.Stack) != 0 {
+		abandoned.Step = state.Stack[len(state.Stack)-1]
+	}
+
+	if err = c.Database.InsertAbandonedFlow(abandoned); err != nil {
+		return err
+	}
+
+	kb := c.mainMenuKB(ctx.EffectiveUser.Id)
+
+	if cb := ctx.CallbackQuery; cb != nil {
+		if _, err = cb.Answer(bot, nil); err != nil {
+			return err
+		}
+	}
+
+	_, err = bot.SendMessage(ctx.EffectiveChat.Id, "Вы долго не отвечали, поэтому я прервал предыдущее действие и вернул вас в главное меню. Начните его заново, если нужно",
+		&gotgbot.SendMessageOpts{ReplyMarkup: kb})
+	if err != nil {
+		return err
+	}
+
+	if msg := ctx.EffectiveMessage; msg != nil && ctx.CallbackQuery == nil && strings.HasPrefix(msg.Text, "/") {
+		return nil
+	}
+
+	return ext.EndGroups
+}
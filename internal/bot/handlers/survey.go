@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/conversation"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IDs of the items of the conference survey.
+const (
+	surveyNPS          = "nps"
+	surveyVenue        = "venue"
+	surveyCatering     = "catering"
+	surveyOrganization = "organization"
+	surveyComment      = "comment"
+)
+
+// surveyFileLifetime is the time after which the survey export is deleted from the chat.
+const surveyFileLifetime = time.Minute
+
+// surveyItems returns the items of the conference survey.
+func surveyItems() []models.QuestionnaireItem {
+	return []models.QuestionnaireItem{
+		{ID: surveyNPS, Type: models.ItemScale, Text: "Насколько вероятно, что вы порекомендуете конференцию друзьям или коллегам? 0 — точно нет, 10 — обязательно", Min: 0, Max: 10},
+		{ID: surveyVenue, Type: models.ItemScale, Text: "Оцените площадку:", Min: 1, Max: 5},
+		{ID: surveyCatering, Type: models.ItemScale, Text: "Оцените питание:", Min: 1, Max: 5},
+		{ID: surveyOrganization, Type: models.ItemScale, Text: "Оцените организацию конференции:", Min: 1, Max: 5},
+		{ID: surveyComment, Type: models.ItemText, Text: "Что нам стоит улучшить? Напишите или нажмите на кнопку \"Далее\"", Optional: true},
+	}
+}
+
+// surveyPayload is the state payload of a user answering the conference survey.
+type surveyPayload struct {
+	ConferenceID string `json:"conferenceID"` // ConferenceID is the ID of the conference the survey is about.
+	questionnaireForm
+}
+
+// form returns the survey with the answers.
+func (p *surveyPayload) form() *questionnaireForm {
+	return &p.questionnaireForm
+}
+
+// survey returns the answers of the user from the payload. The marks are validated by the steps.
+func (p *surveyPayload) survey(tgID int64, answeredAt time.Time) models.Survey {
+	mark := func(id string) int {
+		value, _ := strconv.Atoi(p.Answers[id])
+		return value
+	}
+
+	return models.Survey{ConferenceID: p.ConferenceID, TgID: int(tgID), NPS: mark(surveyNPS), Venue: mark(surveyVenue),
+		Catering: mark(surveyCatering), Organization: mark(surveyOrganization), Comment: p.Answers[surveyComment], AnsweredAt: answeredAt}
+}
+
+// surveyOpen reports whether the survey of the conference is open at now: it opens when the conference ends.
+// It also returns the time it opens at in Moscow.
+func surveyOpen(conference models.Conference, now time.Time) (bool, time.Time, error) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	t := conference.TimeUntil
+	openAt := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+
+	return !now.Before(openAt), openAt, nil
+}
+
+// surveyConversation returns the conversation of a user answering the conference survey.
+func (c *Client) surveyConversation() *conversation.Conversation[surveyPayload] {
+	return &conversation.Conversation[surveyPayload]{
+		Name:  conferenceSurvey,
+		First: itemStep(0),
+		Steps: questionnaireSteps((*surveyPayload).form, []gotgbot.InlineKeyboardButton{{Text: "Вернуться в меню", CallbackData: back}}),
+		Done:  c.surveyDone,
+	}
+}
+
+// surveyDone saves the answers to the conference survey.
+func (c *Client) surveyDone(bot *gotgbot.Bot, ctx *ext.Context, data *surveyPayload) error {
+
+	inserted, err := c.Database.InsertSurvey(data.survey(ctx.EffectiveUser.Id, c.now().UTC()))
+	if err != nil {
+		return err
+	}
+
+	text := "Спасибо! Ваши ответы помогут сделать следующую конференцию лучше"
+	if !inserted {
+		text = "Вы уже ответили на опрос о конференции, спасибо!"
+	}
+
+	return conversation.Reply(bot, ctx, text, backToMainMenuKB())
+}
+
+// surveyCBHandler starts the conference survey. The button of the conference-end notification names the conference,
+// the button of the menu opens the survey of the conference the user picked.
+func (c *Client) surveyCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	var (
+		conference models.Conference
+		err        error
+	)
+
+	if id := strings.TrimPrefix(strings.TrimPrefix(cb.Data, conferenceSurvey), ";"); id != "" {
+		conference, err = c.Database.SelectConference(id)
+	} else {
+		conference, err = c.conference(cb.From.Id)
+	}
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	open, openAt, err := surveyOpen(conference, c.now())
+	if err != nil {
+		return err
+	}
+
+	if !open {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{
+			Text: fmt.Sprintf("Опрос откроется после окончания конференции, %s", openAt.Format("02.01.2006 15:04")), ShowAlert: true})
+		return err
+	}
+
+	answered, _, err := c.Database.SelectSurvey(int(cb.From.Id), conference.ID)
+	if err != nil {
+		return err
+	}
+
+	if answered {
+		_, err = cb.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "Вы уже ответили на опрос о конференции, спасибо!"})
+		return err
+	}
+
+	text := fmt.Sprintf("Опрос о конференции «%s»", conference.Name)
+
+	return c.survey.Start(bot, ctx, surveyPayload{ConferenceID: conference.ID, questionnaireForm: questionnaireForm{Text: text, Items: surveyItems()}})
+}
+
+// surveySummary is the summary of the answers to a conference survey.
+type surveySummary struct {
+	Responses    int     `json:"responses"`    // Responses is the number of users who answered the survey.
+	NPS          int     `json:"nps"`          // NPS is the share of promoters minus the share of detractors, from -100 to 100.
+	Promoters    int     `json:"promoters"`    // Promoters is the number of users who answered 9 or 10.
+	Passives     int     `json:"passives"`     // Passives is the number of users who answered 7 or 8.
+	Detractors   int     `json:"detractors"`   // Detractors is the number of users who answered from 0 to 6.
+	Venue        float64 `json:"venue"`        // Venue is the average mark for the venue.
+	Catering     float64 `json:"catering"`     // Catering is the average mark for the catering.
+	Organization float64 `json:"organization"` // Organization is the average mark for the organization.
+	Comments     int     `json:"comments"`     // Comments is the number of the answers with a comment.
+}
+
+// summarizeSurveys returns the summary of the answers to a conference survey.
+func summarizeSurveys(surveys []models.Survey) surveySummary {
+	summary := surveySummary{Responses: len(surveys)}
+
+	if len(surveys) == 0 {
+		return summary
+	}
+
+	var venue, catering, organization int
+
+	for _, survey := range surveys {
+		switch {
+		case survey.NPS >= 9:
+			summary.Promoters++
+		case survey.NPS >= 7:
+			summary.Passives++
+		default:
+			summary.Detractors++
+		}
+		venue += survey.Venue
+		catering += survey.Catering
+		organization += survey.Organization
+		if survey.Comment != "" {
+			summary.Comments++
+		}
+	}
+
+	responses := float64(len(surveys))
+
+	summary.NPS = (summary.Promoters - summary.Detractors) * 100 / len(surveys)
+	summary.Venue = float64(venue) / responses
+	summary.Catering = float64(catering) / responses
+	summary.Organization = float64(organization) / responses
+
+	return summary
+}
+
+// surveyExport is the content of the survey file of a conference.
+type surveyExport struct {
+	Summary surveySummary   `json:"summary"` // Summary is the summary of the answers.
+	Surveys []models.Survey `json:"surveys"` // Surveys are the answers of the users.
+}
+
+func (c *Client) downloadSurveysCBHandler(bot *gotgbot.Bot, ctx *ext.Context) error {
+
+	cb := ctx.Update.CallbackQuery
+
+	conference, err := c.conference(cb.From.Id)
+	if err != nil {
+		return c.noConference(bot, ctx, err)
+	}
+
+	surveys, err := c.Database.SelectSurveys(conference.ID)
+	if err != nil {
+		return err
+	}
+
+	summary := summarizeSurveys(surveys)
+
+	data, err := json.Marshal(surveyExport{Summary: summary, Surveys: surveys})
+	if err != nil {
+		return err
+	}
+
+	if _, err = cb.Answer(bot, nil); err != nil {
+		return err
+	}
+
+	caption := fmt.Sprintf("Опрос о конференции «%s»: ответов %d, NPS %d", conference.Name, summary.Responses, summary.NPS)
+
+	msg, err := bot.SendDocument(cb.From.Id, gotgbot.NamedFile{File: bytes.NewReader(data), FileName: "survey.json"},
+		&gotgbot.SendDocumentOpts{Caption: caption})
+	if err != nil {
+		return err
+	}
+
+	time.AfterFunc(surveyFileLifetime, func() {
+		if _, errD := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil); errD != nil {
+			log.Printf("failed to delete the survey export: %v", errD)
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"testing"
+)
+
+func TestSummarizeSurveys(t *testing.T) {
+	tests := []struct {
+		name    string
+		surveys []models.Survey
+		want    surveySummary
+	}{
+		{
+			name: "no answers",
+		},
+		{
+			name:    "promoter",
+			surveys: []models.Survey{{NPS: 9, Venue: 5, Catering: 4, Organization: 3, Comment: "Спасибо"}},
+			want:    surveySummary{Responses: 1, NPS: 100, Promoters: 1, Venue: 5, Catering: 4, Organization: 3, Comments: 1},
+		},
+		{
+			name:    "boundaries of the groups",
+			surveys: []models.Survey{{NPS: 10}, {NPS: 9}, {NPS: 8}, {NPS: 7}, {NPS: 6}, {NPS: 0}},
+			want:    surveySummary{Responses: 6, NPS: 0, Promoters: 2, Passives: 2, Detractors: 2},
+		},
+		{
+			name:    "detractors outweigh",
+			surveys: []models.Survey{{NPS: 3, Venue: 2}, {NPS: 5, Venue: 3}, {NPS: 10, Venue: 5}},
+			want:    surveySummary{Responses: 3, NPS: -33, Promoters: 1, Detractors: 2, Venue: 10.0 / 3},
+		},
+		{
+			name:    "averages",
+			surveys: []models.Survey{{NPS: 8, Venue: 4, Catering: 5, Organization: 2}, {NPS: 7, Venue: 5, Catering: 2, Organization: 3, Comment: "Мало розеток"}},
+			want:    surveySummary{Responses: 2, NPS: 0, Passives: 2, Venue: 4.5, Catering: 3.5, Organization: 2.5, Comments: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarizeSurveys(tt.surveys); got != tt.want {
+				t.Errorf("summarizeSurveys() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Package leader provides leader election between bot replicas, so singleton jobs run on exactly one of them.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// leaseTTL is the time after which the lease of a dead leader expires and another replica takes over.
+const leaseTTL = 30 * time.Second
+
+// Elector elects a single leader among the replicas sharing the same lock.
+// The leader holds a lease and keeps refreshing it, the others keep trying to acquire it.
+type Elector struct {
+	locker redis.Locker
+	key    string
+	id     string
+	leader atomic.Bool
+}
+
+// New creates a new Elector competing for the lock with the given key.
+func New(locker redis.Locker, key string) *Elector {
+	host, _ := os.Hostname()
+	return &Elector{locker: locker, key: key, id: fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())}
+}
+
+// IsLeader reports whether the replica is the current leader.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run takes part in the election until the context is done, then releases the lease if it is held.
+func (e *Elector) Run(ctx context.Context) {
+	e.campaign(ctx)
+
+	ticker := time.NewTicker(leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if e.leader.Load() {
+				if err := e.locker.Release(context.Background(), e.key, e.id); err != nil {
+					log.Printf("failed to release leadership of %s: %v", e.key, err)
+				}
+			}
+			return
+		case <-ticker.C:
+			e.campaign(ctx)
+		}
+	}
+}
+
+// campaign refreshes the lease if it is held by the replica or tries to acquire it otherwise.
+// The lease is refreshed even if the replica doesn't consider itself the leader, e.g. after a network failure.
+func (e *Elector) campaign(ctx context.Context) {
+	held, err := e.locker.Refresh(ctx, e.key, e.id, leaseTTL)
+
+	if err == nil && !held {
+		held, err = e.locker.Acquire(ctx, e.key, e.id, leaseTTL)
+	}
+
+	if err != nil {
+		log.Printf("failed to campaign for leadership of %s: %v", e.key, err)
+		held = false
+	}
+
+	if held != e.leader.Swap(held) {
+		if held {
+			log.Printf("became the leader of %s", e.key)
+		} else {
+			log.Printf("lost the leadership of %s", e.key)
+		}
+	}
+}
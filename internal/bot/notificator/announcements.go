@@ -0,0 +1,70 @@
+package notificator
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+)
+
+// deliverAnnouncements sends the scheduled announcements whose time has come to the users of their conferences.
+// An announcement is marked as sent before the delivery, so it is never sent twice.
+// During a simulation announcements are only shown to the observer and stay pending.
+// It holds n.mu, so a simulation can't start or stop in the middle of the delivery.
+func (n *Notificator) deliverAnnouncements() error {
+	pending, err := n.Database.SelectAnnouncements(models.AnnouncementPending)
+	if err != nil {
+		return err
+	}
+
+	now := n.now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var users []models.User
+
+	for _, announcement := range pending {
+		if announcement.SendAt.After(now) {
+			break
+		}
+
+		if users == nil {
+			if users, err = n.Database.SelectUsers(); err != nil {
+				return err
+			}
+		}
+
+		var recipients []models.User
+		for _, user := range users {
+			if user.ActiveConference() == announcement.ConferenceID {
+				recipients = append(recipients, user)
+			}
+		}
+
+		if n.simulation != nil {
+			key := fmt.Sprintf("announcement_%s", announcement.ID)
+			if !n.NotifiedUsers[key] {
+				n.NotifiedUsers[key] = true
+				for _, user := range recipients {
+					n.deliver(sender.Message{ChatID: int64(user.ChatID), Text: "📢 " + announcement.Text})
+				}
+			}
+			continue
+		}
+
+		claimed, errS := n.Database.SetAnnouncementStatus(announcement.ID, models.AnnouncementPending, models.AnnouncementSent)
+		if errS != nil {
+			return errS
+		}
+
+		if !claimed {
+			continue
+		}
+
+		for _, user := range recipients {
+			n.deliver(sender.Message{ChatID: int64(user.ChatID), Text: "📢 " + announcement.Text})
+		}
+	}
+
+	return nil
+}
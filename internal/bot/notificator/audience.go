@@ -0,0 +1,115 @@
+package notificator
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"slices"
+	"time"
+)
+
+// postEventWindow is how long after its last day a conference still gets notifications.
+const postEventWindow = 7 * 24 * time.Hour
+
+// audience is a conference with its reports and the users who take part in it.
+type audience struct {
+	conference models.Conference
+	reports    []models.Report
+	users      []models.User
+}
+
+// audiences returns the audience of every conference whose post-event window is still open.
+// A user takes part in a conference when they picked it, favorited, evaluated or viewed one of its reports,
+// so switching to another conference doesn't cancel the reminders and rating prompts of the previous one.
+// Users who haven't picked a conference belong to the default one.
+func (n *Notificator) audiences() ([]audience, error) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, err
+	}
+
+	now := n.now().In(location)
+
+	conferences, err := n.Database.SelectConferences()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := n.Database.SelectUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	audiences := make([]audience, 0, len(conferences))
+
+	for _, conference := range conferences {
+		if postEventClosed(conference, now) {
+			continue
+		}
+
+		reports, errS := n.Database.SelectReports(conference.ID)
+		if errS != nil {
+			return nil, errS
+		}
+
+		participants, errP := n.participants(conference.ID)
+		if errP != nil {
+			return nil, errP
+		}
+
+		var members []models.User
+		for _, user := range users {
+			if user.ActiveConference() == conference.ID || participants[user.TgID] || hasFavorites(user, conference.ID) {
+				members = append(members, user)
+			}
+		}
+
+		audiences = append(audiences, audience{conference: conference, reports: reports, users: members})
+	}
+
+	return audiences, nil
+}
+
+// participants returns the IDs of the users who evaluated or viewed the reports of the conference.
+func (n *Notificator) participants(conferenceID string) (map[int]bool, error) {
+	participants := make(map[int]bool)
+
+	evaluations, err := n.Database.SelectAllEvaluations(conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, evaluation := range evaluations {
+		participants[evaluation.TgID] = true
+	}
+
+	viewers, err := n.Database.SelectConferenceViewers(conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tgID := range viewers {
+		participants[tgID] = true
+	}
+
+	return participants, nil
+}
+
+// postEventClosed reports whether the post-event window of the conference has closed at now.
+// Conferences without an end time are never closed.
+func postEventClosed(conference models.Conference, now time.Time) bool {
+	if conference.TimeUntil.IsZero() {
+		return false
+	}
+
+	return now.After(conferenceEndTime(conference, now.Location()).Add(postEventWindow))
+}
+
+// conferenceEndTime returns the end of the last day of the conference in the given location.
+func conferenceEndTime(conference models.Conference, location *time.Location) time.Time {
+	t := conference.TimeUntil
+	return time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, location)
+}
+
+// hasFavorites reports whether the user favorited any report of the conference.
+func hasFavorites(user models.User, conferenceID string) bool {
+	return slices.ContainsFunc(user.Favorites, func(ref models.ReportRef) bool { return ref.ConferenceID == conferenceID })
+}
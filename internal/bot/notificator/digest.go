@@ -0,0 +1,130 @@
+package notificator
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/handlers"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"sort"
+	"time"
+)
+
+// highlightsAmount is the number of the day's highlights shown to users without favorite reports.
+const highlightsAmount = 3
+
+// notifyMorningDigest sends the users of the conference a digest of the day's talks at the configured hour of every conference day.
+// Users with favorite reports get their favorites of the day, others get the day's highlights.
+// The digest also lists yesterday's talks the user hasn't rated yet.
+func (n *Notificator) notifyMorningDigest(bot *gotgbot.Bot, audience audience) error {
+	if !n.Cfg.Digest.Enabled {
+		return nil
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return err
+	}
+
+	now := n.now().In(location).Truncate(time.Second)
+
+	if now.Hour() != n.Cfg.Digest.Hour {
+		return nil
+	}
+
+	days := groupReportsByDay(audience.reports)
+
+	today := now.Format(dayLayout)
+
+	reportsOfDay, exists := days[today]
+	if !exists {
+		return nil
+	}
+
+	users := audience.users
+
+	highlights := dayHighlights(reportsOfDay, users)
+	yesterdayReports := days[now.AddDate(0, 0, -1).Format(dayLayout)]
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, user := range users {
+		userKey := fmt.Sprintf("digest_%d_%s_%s", user.TgID, audience.conference.ID, today)
+		if !n.markNotified(userKey) {
+			continue
+		}
+
+		message := "Доброе утро! Сегодня на конференции:\n\n"
+
+		var favorites []models.Report
+		for _, report := range reportsOfDay {
+			if n.isFavoriteReport(user, report) {
+				favorites = append(favorites, report)
+			}
+		}
+
+		if len(favorites) != 0 {
+			message = fmt.Sprintf("%sВаши избранные доклады:\n\n%s", message, formatDigestReports(favorites))
+		} else {
+			message = fmt.Sprintf("%sНе пропустите:\n\n%s", message, formatDigestReports(highlights))
+		}
+
+		opts := &gotgbot.SendMessageOpts{}
+
+		if unevaluated := n.unevaluatedReports(user, yesterdayReports); len(unevaluated) != 0 {
+			if len(unevaluated) > ratingPromptSize {
+				unevaluated = unevaluated[:ratingPromptSize]
+			}
+			message = fmt.Sprintf("%sВы ещё не оценили вчерашние доклады:\n\n%s", message, formatReports(unevaluated, 0))
+			opts.ReplyMarkup = handlers.RateReportsKB(unevaluated, 0)
+		}
+
+		n.deliver(sender.Message{ChatID: int64(user.TgID), Text: message, Opts: opts})
+	}
+
+	return nil
+}
+
+// dayHighlights returns the most favorited reports of the day in the order they start.
+func dayHighlights(reportsOfDay []models.Report, users []models.User) []models.Report {
+	favorites := make(map[models.ReportRef]int, len(reportsOfDay))
+
+	for _, user := range users {
+		for _, ref := range user.Favorites {
+			favorites[ref]++
+		}
+	}
+
+	highlights := make([]models.Report, len(reportsOfDay))
+	copy(highlights, reportsOfDay)
+
+	sort.SliceStable(highlights, func(i, j int) bool {
+		return favorites[highlights[i].Ref()] > favorites[highlights[j].Ref()]
+	})
+
+	if len(highlights) > highlightsAmount {
+		highlights = highlights[:highlightsAmount]
+	}
+
+	sort.SliceStable(highlights, func(i, j int) bool {
+		return highlights[i].StartTime.Before(highlights[j].StartTime)
+	})
+
+	return highlights
+}
+
+// formatDigestReports returns a list of reports with their start times and rooms.
+func formatDigestReports(reports []models.Report) string {
+	var text string
+
+	for _, report := range reports {
+		room := ""
+		if report.Room != "" {
+			room = fmt.Sprintf(", зал %s", report.Room)
+		}
+		text += fmt.Sprintf("🕒 %s%s\n%s - %s\n\n", report.StartTime.Format("15:04"), room, report.Speakers, report.Title)
+	}
+
+	return text
+}
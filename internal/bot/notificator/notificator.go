@@ -1,22 +1,49 @@
 package notificator
 
 import (
+	"context"
 	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/handlers"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/config"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
-	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/mongodb"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"log"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 )
 
-// Notificator is a struct that contains the configuration, database, and a map of notified users.
+const (
+	notificationLifetime = 7 * time.Second     // notificationLifetime is the time after which a notification is deleted from the chat.
+	ratingPromptSize     = 10                  // ratingPromptSize is the maximal number of reports in a single rating prompt.
+	dayLayout            = "02-01-2006"        // dayLayout is the layout of the day keys.
+	notifiedTTL          = 60 * 24 * time.Hour // notifiedTTL is the lifetime of the notification marks, it outlives the post-event window.
+)
+
+// Leader is an interface that reports whether the current replica should run the scheduler.
+type Leader interface {
+	IsLeader() bool
+}
+
+// Notificator is a struct that contains the configuration, database, outbound queue, leader elector, clock, notification marks and a map of notified users.
+// When Leader is set, notifications are sent only while the replica is the leader.
+// When Marks is set, the sent notifications are marked in it, so they are not repeated after a failover or a restart.
+// When Clock is a running clock.Simulated, notifications are not sent to users but shown to the admin running the simulation.
 type Notificator struct {
 	Cfg           *config.Config
-	Database      mongodb.DataManipulator
+	Database      storage.Repository
+	Sender        *sender.Queue
+	Leader        Leader
+	Clock         clock.Clock
+	Marks         redis.Marker
 	NotifiedUsers map[string]bool
 	mu            sync.Mutex
+	simulation    *simulation
 }
 
 // StartNotificationScheduler starts a goroutine that periodically checks for notifications to send.
@@ -25,45 +52,56 @@ func (n *Notificator) StartNotificationScheduler(bot *gotgbot.Bot) {
 		for {
 			select {
 			case <-time.After(15 * time.Second):
-				err := n.notifyUpcomingReports(bot)
-				if err != nil {
-					fmt.Println("failed to send notification start before 10 min:", err)
+				if n.Leader != nil && !n.Leader.IsLeader() {
+					continue
 				}
-				err = n.notifyReportEnd(bot)
+				n.syncSimulation()
+				audiences, err := n.audiences()
 				if err != nil {
-					fmt.Println("failed to send notification end of report:", err)
+					fmt.Println("failed to load conferences:", err)
 				}
-				err = n.notifyDayEnd(bot)
-				if err != nil {
-					fmt.Println("failed to send notification end of day:", err)
+				for _, audience := range audiences {
+					err = n.notifyUpcomingReports(bot, audience)
+					if err != nil {
+						fmt.Println("failed to send notification start before 10 min:", err)
+					}
+					err = n.notifyReportEnd(bot, audience)
+					if err != nil {
+						fmt.Println("failed to send notification end of report:", err)
+					}
+					err = n.notifyDayEnd(bot, audience)
+					if err != nil {
+						fmt.Println("failed to send notification end of day:", err)
+					}
+					err = n.notifyConferenceEnd(bot, audience)
+					if err != nil {
+						fmt.Println("failed to send notification end of conference:", err)
+					}
+					err = n.notifyMorningDigest(bot, audience)
+					if err != nil {
+						fmt.Println("failed to send morning digest:", err)
+					}
 				}
-				err = n.notifyConferenceEnd(bot)
+				err = n.deliverAnnouncements()
 				if err != nil {
-					fmt.Println("failed to send notification end of conference:", err)
+					fmt.Println("failed to deliver scheduled announcements:", err)
 				}
+				n.flushSimulation()
 			}
 		}
 	}()
 }
 
-// notifyUpcomingReports sends a notification to users about upcoming reports.
-func (n *Notificator) notifyUpcomingReports(bot *gotgbot.Bot) error {
-	reports, err := n.Database.SelectReports(n.Database.Collection("report"))
-	if err != nil {
-		return err
-	}
-
-	users, err := n.Database.SelectUsers(n.Database.Collection("user"))
-	if err != nil {
-		return err
-	}
+// notifyUpcomingReports sends a notification to the users of the conference about upcoming reports.
+func (n *Notificator) notifyUpcomingReports(bot *gotgbot.Bot, audience audience) error {
+	reports, users := audience.reports, audience.users
 
 	location, err := time.LoadLocation("Europe/Moscow")
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().In(location).Truncate(time.Second)
+	now := n.now().In(location).Truncate(time.Second)
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -77,22 +115,9 @@ func (n *Notificator) notifyUpcomingReports(bot *gotgbot.Bot) error {
 			message := fmt.Sprintf("Доклад \"%s\" начнется меньше, чем через 10 минут в %s", report.Title, reportMSKTime.Format("15:04"))
 
 			for _, user := range users {
-				userKey := fmt.Sprintf("%d_%s", user.TgID, report.URL)
-				if !n.NotifiedUsers[userKey] && (len(user.FavoriteReports) == 0 || n.isFavoriteReport(user, report.URL)) {
-					n.NotifiedUsers[userKey] = true
-
-					go func(userID int, message string) {
-						msg, err := bot.SendMessage(int64(userID), message, nil)
-						if err != nil {
-							log.Printf("failed to send message to user %d: %v", userID, err)
-							return
-						}
-						time.Sleep(7 * time.Second)
-						_, err = bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-						if err != nil {
-							log.Printf("failed to delete message: %v", err)
-						}
-					}(user.TgID, message)
+				userKey := fmt.Sprintf("%d_%s_%s", user.TgID, report.ConferenceID, report.URL)
+				if !n.NotifiedUsers[userKey] && (!hasFavorites(user, report.ConferenceID) || n.isFavoriteReport(user, report)) && n.markNotified(userKey) {
+					n.sendTemporary(bot, user.TgID, message)
 				}
 			}
 		}
@@ -100,24 +125,16 @@ func (n *Notificator) notifyUpcomingReports(bot *gotgbot.Bot) error {
 	return nil
 }
 
-// notifyReportEnd sends a notification to users when a report ends.
-func (n *Notificator) notifyReportEnd(bot *gotgbot.Bot) error {
-	reports, err := n.Database.SelectReports(n.Database.Collection("report"))
-	if err != nil {
-		return err
-	}
-
-	users, err := n.Database.SelectUsers(n.Database.Collection("user"))
-	if err != nil {
-		return err
-	}
+// notifyReportEnd sends a notification to the users of the conference when a report ends.
+func (n *Notificator) notifyReportEnd(bot *gotgbot.Bot, audience audience) error {
+	reports, users := audience.reports, audience.users
 
 	location, err := time.LoadLocation("Europe/Moscow")
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().In(location).Truncate(time.Second)
+	now := n.now().In(location).Truncate(time.Second)
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -129,28 +146,16 @@ func (n *Notificator) notifyReportEnd(bot *gotgbot.Bot) error {
 
 		if now.After(reportEndTime) {
 			for _, user := range users {
-				userKey := fmt.Sprintf("end_%d_%s", user.TgID, report.URL)
-				if !n.NotifiedUsers[userKey] && (len(user.FavoriteReports) == 0 || n.isFavoriteReport(user, report.URL)) {
-					evaluationExists, _, err := n.Database.SelectEvaluation(n.Database.Collection("evaluation"), user.TgID, report.URL)
+				userKey := fmt.Sprintf("end_%d_%s_%s", user.TgID, report.ConferenceID, report.URL)
+				if !n.NotifiedUsers[userKey] && (!hasFavorites(user, report.ConferenceID) || n.isFavoriteReport(user, report)) {
+					evaluationExists, _, err := n.Database.SelectEvaluation(user.TgID, report.ConferenceID, report.URL)
 					if err != nil {
 						log.Printf("failed to check evaluation for user %d: %v", user.TgID, err)
 						continue
 					}
-					if !evaluationExists {
+					if !evaluationExists && n.markNotified(userKey) {
 						message := fmt.Sprintf("Доклад \"%s\" закончился. Пожалуйста, оцените его.", report.Title)
-						msg, err := bot.SendMessage(int64(user.TgID), message, nil)
-						if err != nil {
-							log.Printf("failed to send message to user %d: %v", user.TgID, err)
-							continue
-						}
-						n.NotifiedUsers[userKey] = true
-						go func(msg *gotgbot.Message) {
-							time.Sleep(7 * time.Second)
-							_, err := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-							if err != nil {
-								log.Printf("failed to delete message: %v", err)
-							}
-						}(msg)
+						n.sendTemporary(bot, user.TgID, message)
 					}
 				}
 			}
@@ -159,143 +164,267 @@ func (n *Notificator) notifyReportEnd(bot *gotgbot.Bot) error {
 	return nil
 }
 
-// notifyDayEnd sends a notification to users at the end of the day.
-func (n *Notificator) notifyDayEnd(bot *gotgbot.Bot) error {
-	reports, err := n.Database.SelectReports(n.Database.Collection("report"))
+// notifyDayEnd sends a notification to the users of the conference at the end of the day.
+func (n *Notificator) notifyDayEnd(bot *gotgbot.Bot, audience audience) error {
+	reports, users := audience.reports, audience.users
+
+	location, err := time.LoadLocation("Europe/Moscow")
 	if err != nil {
 		return err
 	}
 
-	users, err := n.Database.SelectUsers(n.Database.Collection("user"))
-	if err != nil {
-		return err
+	now := n.now().In(location).Truncate(time.Second)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for day, reportsOfDay := range groupReportsByDay(reports) {
+		lastReportEndTime := dayEndTime(reportsOfDay, location)
+
+		if !now.After(lastReportEndTime.Add(1*time.Hour)) || now.After(lastReportEndTime.Add(24*time.Hour)) {
+			continue
+		}
+
+		for _, user := range users {
+			userKey := fmt.Sprintf("day_end_%d_%s_%s", user.TgID, audience.conference.ID, day)
+			if n.NotifiedUsers[userKey] {
+				continue
+			}
+
+			unevaluatedReports := n.unevaluatedReports(user, reportsOfDay)
+
+			if len(unevaluatedReports) > 0 && n.markNotified(userKey) {
+				n.sendRatingPrompt(user.TgID, "День закончился. Пожалуйста, оцените следующие доклады:", unevaluatedReports)
+			}
+		}
 	}
+	return nil
+}
+
+// notifyConferenceEnd sends a notification to the users of the conference two days after it ends, until its post-event window closes.
+// It asks for the ratings of the unrated reports and invites the users who haven't answered the conference survey to it.
+// Survey invites are marked in the database, so a user is invited only once even after a restart.
+func (n *Notificator) notifyConferenceEnd(bot *gotgbot.Bot, audience audience) error {
+	reports, users := audience.reports, audience.users
 
 	location, err := time.LoadLocation("Europe/Moscow")
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().In(location).Truncate(time.Second)
+	now := n.now().In(location).Truncate(time.Second)
 
-	var lastReportEndTime time.Time
-	for _, report := range reports {
-		endTime := report.StartTime.Add(time.Duration(report.Duration) * time.Minute).Truncate(time.Second)
-		reportEndTime := time.Date(endTime.Year(), endTime.Month(), endTime.Day(), endTime.Hour(),
-			endTime.Minute(), endTime.Second(), endTime.Nanosecond(), location)
-		if reportEndTime.After(lastReportEndTime) {
-			lastReportEndTime = reportEndTime
-		}
+	conferenceEndTime := conferenceEndTime(audience.conference, location)
+
+	if !now.After(conferenceEndTime.Add(2*24*time.Hour)) || now.After(conferenceEndTime.Add(postEventWindow)) {
+		return nil
 	}
 
-	if now.After(lastReportEndTime.Add(1 * time.Hour)) {
-		for _, user := range users {
-			userKey := fmt.Sprintf("day_end_%d_%s", user.TgID, lastReportEndTime.Format("02-01-2006"))
-			if !n.NotifiedUsers[userKey] {
-				var reportsOfDay []models.Report
-				for _, report := range reports {
-					if report.StartTime.Year() == lastReportEndTime.Year() && report.StartTime.YearDay() == lastReportEndTime.YearDay() {
-						reportsOfDay = append(reportsOfDay, report)
-					}
-				}
+	surveyed, err := n.surveyed(audience.conference.ID)
+	if err != nil {
+		return err
+	}
 
-				var unevaluatedReports []models.Report
-				for _, report := range reportsOfDay {
-					evaluationExists, _, err := n.Database.SelectEvaluation(n.Database.Collection("evaluation"), user.TgID, report.URL)
-					if err != nil {
-						log.Printf("failed to check evaluation for user %d: %v", user.TgID, err)
-						continue
-					}
-					if !evaluationExists {
-						unevaluatedReports = append(unevaluatedReports, report)
-					}
-				}
-				if len(unevaluatedReports) > 0 {
-					message := fmt.Sprintf("День закончился. Пожалуйста, оцените следующие доклады: %v", unevaluatedReports)
-					msg, err := bot.SendMessage(int64(user.TgID), message, nil)
-					if err != nil {
-						log.Printf("failed to send message to user %d: %v", user.TgID, err)
-						continue
-					}
-					n.NotifiedUsers[userKey] = true
-					go func(msg *gotgbot.Message) {
-						time.Sleep(7 * time.Second)
-						_, err := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-						if err != nil {
-							log.Printf("failed to delete message: %v", err)
-						}
-					}(msg)
-				}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, user := range users {
+		userKey := fmt.Sprintf("conf_end_%d_%s_%s", user.TgID, audience.conference.ID, conferenceEndTime.Format("02-01-2006"))
+		if !n.NotifiedUsers[userKey] {
+			unevaluatedReports := n.unevaluatedReports(user, reports)
+			if len(unevaluatedReports) > 0 && n.markNotified(userKey) {
+				n.sendRatingPrompt(user.TgID, "Конференция завершилась. Пожалуйста, оцените следующие доклады:", unevaluatedReports)
 			}
 		}
+
+		if surveyed[user.TgID] {
+			continue
+		}
+
+		invited, errM := n.markSurveyInvited(user.TgID, audience.conference.ID, now)
+		if errM != nil {
+			log.Printf("failed to invite user %d to the survey of conference %s: %v", user.TgID, audience.conference.ID, errM)
+			continue
+		}
+		if invited {
+			n.deliver(sender.Message{ChatID: int64(user.TgID), Text: "Как вам конференция в целом? Ответьте на несколько вопросов о площадке, питании и организации — это займёт минуту",
+				Opts: &gotgbot.SendMessageOpts{ReplyMarkup: handlers.SurveyKB(audience.conference.ID)}})
+		}
 	}
 	return nil
 }
 
-// notifyConferenceEnd sends a notification to users two days after the conference ends.
-func (n *Notificator) notifyConferenceEnd(bot *gotgbot.Bot) error {
-	reports, err := n.Database.SelectReports(n.Database.Collection("report"))
+// surveyed returns the users who answered the survey of the conference or were already invited to it.
+// A simulation doesn't count the real invites, so it invites the users again.
+func (n *Notificator) surveyed(conferenceID string) (map[int]bool, error) {
+	surveys, err := n.Database.SelectSurveys(conferenceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	users, err := n.Database.SelectUsers(n.Database.Collection("user"))
-	if err != nil {
-		return err
+	surveyed := make(map[int]bool, len(surveys))
+	for _, survey := range surveys {
+		surveyed[survey.TgID] = true
 	}
 
-	location, err := time.LoadLocation("Europe/Moscow")
+	if n.simulation != nil {
+		return surveyed, nil
+	}
+
+	invited, err := n.Database.SelectSurveyInvites(conferenceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	now := time.Now().In(location).Truncate(time.Second)
+	for _, tgID := range invited {
+		surveyed[tgID] = true
+	}
 
-	conferenceEndTime := time.Date(time.Time(n.Cfg.Conference.TimeUntil).Year(), time.Time(n.Cfg.Conference.TimeUntil).Month(), time.Time(n.Cfg.Conference.TimeUntil).Day(), 23, 59, 59, 0, location)
+	return surveyed, nil
+}
 
-	if now.After(conferenceEndTime.Add(2 * 24 * time.Hour)) {
-		for _, user := range users {
-			userKey := fmt.Sprintf("conf_end_%d_%s", user.TgID, conferenceEndTime.Format("02-01-2006"))
-			if !n.NotifiedUsers[userKey] {
-				var unevaluatedReports []models.Report
-				for _, report := range reports {
-					evaluationExists, _, err := n.Database.SelectEvaluation(n.Database.Collection("evaluation"), user.TgID, report.URL)
-					if err != nil {
-						log.Printf("failed to check evaluation for user %d: %v", user.TgID, err)
-						continue
-					}
-					if !evaluationExists {
-						unevaluatedReports = append(unevaluatedReports, report)
-					}
-				}
-				if len(unevaluatedReports) > 0 {
-					message := fmt.Sprintf("Конференция завершилась. Пожалуйста, оцените следующие доклады: %v", unevaluatedReports)
-					msg, err := bot.SendMessage(int64(user.TgID), message, nil)
-					if err != nil {
-						log.Printf("failed to send message to user %d: %v", user.TgID, err)
-						continue
-					}
-					n.NotifiedUsers[userKey] = true
-					go func(msg *gotgbot.Message) {
-						time.Sleep(7 * time.Second)
-						_, err := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil)
-						if err != nil {
-							log.Printf("failed to delete message: %v", err)
-						}
-					}(msg)
-				}
+// markNotified marks the notification with the key as sent and reports whether it hadn't been sent yet.
+// The marks are shared through Marks, so a replica taking over the leadership doesn't repeat the notifications of the previous leader.
+// Known marks are also kept in NotifiedUsers to save the round trips. A simulation uses only its own NotifiedUsers.
+// The caller should hold n.mu.
+func (n *Notificator) markNotified(key string) bool {
+	if n.NotifiedUsers[key] {
+		return false
+	}
+
+	if n.Marks != nil && n.simulation == nil {
+		marked, err := n.Marks.Mark(context.Background(), "notified:"+key, notifiedTTL)
+		if err != nil {
+			log.Printf("failed to mark notification %s: %v", key, err)
+			return false
+		}
+		if !marked {
+			n.NotifiedUsers[key] = true
+			return false
+		}
+	}
+
+	n.NotifiedUsers[key] = true
+
+	return true
+}
+
+// markSurveyInvited marks the user as invited to the survey of the conference and reports whether they hadn't been invited yet.
+// A simulation marks the invites in its own notified users, so it doesn't suppress the real ones. The caller should hold n.mu.
+func (n *Notificator) markSurveyInvited(tgID int, conferenceID string, now time.Time) (bool, error) {
+	if n.simulation == nil {
+		return n.Database.MarkSurveyInvited(tgID, conferenceID, now)
+	}
+
+	userKey := fmt.Sprintf("survey_%d_%s", tgID, conferenceID)
+	if n.NotifiedUsers[userKey] {
+		return false, nil
+	}
+	n.NotifiedUsers[userKey] = true
+
+	return true, nil
+}
+
+// sendTemporary enqueues a notification to the user and deletes it after notificationLifetime.
+func (n *Notificator) sendTemporary(bot *gotgbot.Bot, userID int, message string) {
+	n.deliver(sender.Message{
+		ChatID: int64(userID),
+		Text:   message,
+		Done: func(msg *gotgbot.Message, err error) {
+			if err != nil {
+				log.Printf("failed to send message to user %d: %v", userID, err)
+				return
 			}
+			time.AfterFunc(notificationLifetime, func() {
+				if _, errD := bot.DeleteMessage(msg.Chat.Id, msg.MessageId, nil); errD != nil {
+					log.Printf("failed to delete message: %v", errD)
+				}
+			})
+		},
+	})
+}
+
+// sendRatingPrompt enqueues a prompt listing the unrated reports with a "rate" button for each of them.
+// Long lists are split into several messages to fit Telegram limits.
+// The prompt is not deleted automatically, it turns into the evaluation flow once the user picks a report.
+func (n *Notificator) sendRatingPrompt(userID int, header string, reports []models.Report) {
+	for from := 0; from < len(reports); from += ratingPromptSize {
+		until := min(from+ratingPromptSize, len(reports))
+
+		message := formatReports(reports[from:until], from)
+		if from == 0 {
+			message = fmt.Sprintf("%s\n\n%s", header, message)
 		}
+
+		n.deliver(sender.Message{ChatID: int64(userID), Text: message, Opts: &gotgbot.SendMessageOpts{ReplyMarkup: handlers.RateReportsKB(reports[from:until], from)}})
 	}
-	return nil
 }
 
-// isFavoriteReport checks if a report is in a user's list of favorite reports.
-func (n *Notificator) isFavoriteReport(user models.User, reportURL string) bool {
-	for _, report := range user.FavoriteReports {
-		if report.URL == reportURL {
-			return true
+// formatReports returns a human-readable numbered list of reports, offset is added to the report numbers.
+func formatReports(reports []models.Report, offset int) string {
+	var text string
+
+	for ind, report := range reports {
+		text += fmt.Sprintf("%v. %s %s\n%s - %s\n\n", offset+ind+1, report.StartTime.Format("02.01"), report.StartTime.Format("15:04"), report.Speakers, report.Title)
+	}
+
+	return text
+}
+
+// groupReportsByDay groups reports by the day they start on, the day is formatted as "02-01-2006".
+// Reports of every day are sorted by their start time.
+func groupReportsByDay(reports []models.Report) map[string][]models.Report {
+	days := make(map[string][]models.Report)
+
+	for _, report := range reports {
+		day := report.StartTime.Format(dayLayout)
+		days[day] = append(days[day], report)
+	}
+
+	for _, reportsOfDay := range days {
+		sort.Slice(reportsOfDay, func(i, j int) bool {
+			return reportsOfDay[i].StartTime.Before(reportsOfDay[j].StartTime)
+		})
+	}
+
+	return days
+}
+
+// dayEndTime returns the end time of the last report of the day in the given location.
+func dayEndTime(reportsOfDay []models.Report, location *time.Location) time.Time {
+	var lastReportEndTime time.Time
+
+	for _, report := range reportsOfDay {
+		endTime := report.StartTime.Add(time.Duration(report.Duration) * time.Minute).Truncate(time.Second)
+		reportEndTime := time.Date(endTime.Year(), endTime.Month(), endTime.Day(), endTime.Hour(),
+			endTime.Minute(), endTime.Second(), endTime.Nanosecond(), location)
+		if reportEndTime.After(lastReportEndTime) {
+			lastReportEndTime = reportEndTime
 		}
 	}
-	return false
+
+	return lastReportEndTime
+}
+
+// unevaluatedReports returns the reports the user has not evaluated yet.
+func (n *Notificator) unevaluatedReports(user models.User, reports []models.Report) []models.Report {
+	var unevaluated []models.Report
+
+	for _, report := range reports {
+		evaluationExists, _, err := n.Database.SelectEvaluation(user.TgID, report.ConferenceID, report.URL)
+		if err != nil {
+			log.Printf("failed to check evaluation for user %d: %v", user.TgID, err)
+			continue
+		}
+		if !evaluationExists {
+			unevaluated = append(unevaluated, report)
+		}
+	}
+
+	return unevaluated
+}
+
+// isFavoriteReport checks if a report is in a user's list of favorite reports.
+func (n *Notificator) isFavoriteReport(user models.User, report models.Report) bool {
+	return slices.Contains(user.Favorites, report.Ref())
 }
@@ -0,0 +1,112 @@
+package notificator
+
+import (
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/bot/sender"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
+	"strings"
+	"sync"
+	"time"
+)
+
+// simulation is the state of a dry-run of the conference with a simulated clock.
+// Notifications are not sent to users during a simulation: the observer gets their own ones
+// and a summary of the notifications that would be sent to the others.
+type simulation struct {
+	mu           sync.Mutex
+	observer     int64           // observer is the chat ID of the admin who runs the simulation.
+	realNotified map[string]bool // realNotified are the notified users of the real run, restored after the simulation.
+	tally        map[string]int  // tally maps the first line of a notification to the number of its recipients.
+	order        []string        // order is the order the notifications fired in.
+}
+
+// now returns the current time of the notificator clock.
+func (n *Notificator) now() time.Time {
+	if n.Clock == nil {
+		return time.Now()
+	}
+	return n.Clock.Now()
+}
+
+// syncSimulation starts or stops the dry-run according to the clock.
+// The simulation uses its own notified users, so it doesn't suppress the real notifications.
+func (n *Notificator) syncSimulation() {
+	sim, ok := n.Clock.(*clock.Simulated)
+	if !ok {
+		return
+	}
+
+	observer, active := sim.Observer()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case active && n.simulation == nil:
+		n.simulation = &simulation{observer: observer, realNotified: n.NotifiedUsers, tally: make(map[string]int)}
+		n.NotifiedUsers = make(map[string]bool, 100)
+	case !active && n.simulation != nil:
+		n.NotifiedUsers = n.simulation.realNotified
+		n.simulation = nil
+	case active:
+		n.simulation.observer = observer
+	}
+}
+
+// deliver enqueues a notification, or records it in the dry-run summary during a simulation.
+func (n *Notificator) deliver(msg sender.Message) {
+	sim := n.simulation
+
+	if sim == nil {
+		n.Sender.Enqueue(msg)
+		return
+	}
+
+	if msg.ChatID == sim.observer {
+		msg.Text = "🧪 " + msg.Text
+		n.Sender.Enqueue(msg)
+		return
+	}
+
+	header, _, _ := strings.Cut(msg.Text, "\n")
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if _, exists := sim.tally[header]; !exists {
+		sim.order = append(sim.order, header)
+	}
+	sim.tally[header]++
+}
+
+// flushSimulation sends the observer a summary of the notifications fired during the last check.
+func (n *Notificator) flushSimulation() {
+	sim := n.simulation
+
+	if sim == nil {
+		return
+	}
+
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if len(sim.order) == 0 {
+		return
+	}
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		location = time.Local
+	}
+
+	text := fmt.Sprintf("🧪 Симуляция, сейчас %s. Другим участникам ушло бы:\n\n", n.now().In(location).Format("02.01.2006 15:04"))
+
+	for _, header := range sim.order {
+		text += fmt.Sprintf("• %s — получателей: %d\n", header, sim.tally[header])
+	}
+
+	n.Sender.SendText(sim.observer, text, nil)
+
+	sim.tally = make(map[string]int)
+	sim.order = nil
+}
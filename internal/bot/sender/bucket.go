@@ -0,0 +1,74 @@
+package sender
+
+import (
+	"context"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket limiting the rate of outbound requests.
+type bucket struct {
+	mu       sync.Mutex
+	clock    clock.Clock // clock is the time source of the refills.
+	tokens   float64     // tokens is the number of currently available tokens.
+	capacity float64     // capacity is the maximal number of tokens the bucket can hold.
+	rate     float64     // rate is the number of tokens added per second.
+	last     time.Time   // last is the time the bucket was last refilled.
+	pause    time.Time   // pause is the time until which no tokens are handed out.
+}
+
+// newBucket creates a full bucket with the given rate per second.
+func newBucket(rate int, clk clock.Clock) *bucket {
+	return &bucket{clock: clk, tokens: float64(rate), capacity: float64(rate), rate: float64(rate), last: clk.Now()}
+}
+
+// wait blocks until a token is available or the context is done.
+func (b *bucket) wait(ctx context.Context) error {
+	for {
+		delay := b.take()
+		if delay == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// take takes a token if one is available, otherwise it returns the time to wait before retrying.
+func (b *bucket) take() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+
+	if now.Before(b.pause) {
+		return b.pause.Sub(now)
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// pauseFor stops handing out tokens for the given duration.
+func (b *bucket) pauseFor(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until := b.clock.Now().Add(d); until.After(b.pause) {
+		b.pause = until
+	}
+}
@@ -0,0 +1,76 @@
+package sender
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
+	"testing"
+	"time"
+)
+
+// drift is how much shorter than expected a wait may be, since the bucket's simulated clock keeps ticking between steps.
+const drift = 50 * time.Millisecond
+
+func TestBucket(t *testing.T) {
+	type step struct {
+		advance time.Duration // advance moves the clock before the step.
+		pause   time.Duration // pause pauses the bucket before taking a token.
+		want    time.Duration // want is the delay returned by take, zero if a token is taken.
+	}
+
+	tests := []struct {
+		name  string
+		rate  int
+		steps []step
+	}{
+		{
+			name:  "full bucket",
+			rate:  3,
+			steps: []step{{}, {}, {}},
+		},
+		{
+			name:  "empty bucket",
+			rate:  2,
+			steps: []step{{}, {}, {want: 500 * time.Millisecond}},
+		},
+		{
+			name:  "refill",
+			rate:  2,
+			steps: []step{{}, {}, {advance: 500 * time.Millisecond}, {want: 500 * time.Millisecond}},
+		},
+		{
+			name:  "refill is capped",
+			rate:  2,
+			steps: []step{{}, {}, {advance: time.Hour}, {}, {want: 500 * time.Millisecond}},
+		},
+		{
+			name:  "pause",
+			rate:  5,
+			steps: []step{{pause: 3 * time.Second, want: 3 * time.Second}, {advance: 2 * time.Second, want: time.Second}, {advance: time.Second}},
+		},
+		{
+			name:  "shorter pause doesn't shorten a longer one",
+			rate:  5,
+			steps: []step{{pause: 3 * time.Second, want: 3 * time.Second}, {pause: time.Second, want: 3 * time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &clock.Simulated{}
+			clk.Set(time.Date(2024, time.May, 16, 10, 0, 0, 0, time.UTC), 0)
+
+			b := newBucket(tt.rate, clk)
+
+			for ind, step := range tt.steps {
+				clk.Advance(step.advance)
+				if step.pause != 0 {
+					b.pauseFor(step.pause)
+				}
+
+				got := b.take()
+				if got > step.want || got < step.want-drift || (step.want == 0) != (got == 0) {
+					t.Errorf("step %d: take() = %v, want %v", ind+1, got, step.want)
+				}
+			}
+		})
+	}
+}
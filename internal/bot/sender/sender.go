@@ -0,0 +1,308 @@
+// Package sender provides a rate-limited outbound message queue shared by the bot components.
+package sender
+
+import (
+	"context"
+	"errors"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/clock"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// These constants define the limits of the queue.
+const (
+	globalRate   = 30              // globalRate is the number of messages per second Telegram allows a bot to send.
+	chatInterval = time.Second     // chatInterval is the minimal interval between two messages to the same chat.
+	maxAttempts  = 5               // maxAttempts is the number of delivery attempts before a message is dead-lettered.
+	baseBackoff  = 2 * time.Second // baseBackoff is the delay before the first retry, it doubles with every attempt.
+	queueSize    = 4096            // queueSize is the capacity of the buffer of each worker.
+	workers      = 8               // workers is the number of goroutines delivering messages.
+)
+
+// ErrQueueFull is the error of a message dropped because the buffer of its worker is full.
+var ErrQueueFull = errors.New("sender: queue is full")
+
+// SendFunc performs a single delivery attempt of a message.
+type SendFunc func(bot *gotgbot.Bot) (*gotgbot.Message, error)
+
+// Message represents a single outbound message.
+type Message struct {
+	ChatID   int64                                 // ChatID is the ID of the chat the message is addressed to.
+	Text     string                                // Text is the text of the message.
+	Opts     *gotgbot.SendMessageOpts              // Opts are the options of the text message. Optional.
+	Send     SendFunc                              // Send overrides the default text delivery, e.g. for photos and documents. Optional.
+	Done     func(msg *gotgbot.Message, err error) // Done is called once the message is delivered or dropped. Optional.
+	attempts int                                   // attempts is the number of delivery attempts made so far.
+}
+
+// Queue is a rate-limited outbound message queue.
+// It respects the global and the per-chat Telegram limits, handles retry-after responses,
+// retries failed deliveries with exponential backoff and dead-letters messages that could not be delivered.
+// Messages of a chat are always handled by the same worker, which parks them until their chat is free, so they arrive in order.
+type Queue struct {
+	bot      *gotgbot.Bot
+	database storage.DeadLetterRepo
+	lanes    []chan *Message // lanes are the buffers of the workers, a chat is bound to a lane by its ID.
+	global   *bucket
+	mu       sync.Mutex
+	chats    map[int64]time.Time // chats maps a chat ID to the time the next message to it may be sent.
+}
+
+// New creates a new Queue for the given bot. Undelivered messages are recorded in the database.
+func New(bot *gotgbot.Bot, database storage.DeadLetterRepo) *Queue {
+	lanes := make([]chan *Message, workers)
+	for i := range lanes {
+		lanes[i] = make(chan *Message, queueSize)
+	}
+
+	return &Queue{
+		bot:      bot,
+		database: database,
+		lanes:    lanes,
+		global:   newBucket(globalRate, clock.Real{}),
+		chats:    make(map[int64]time.Time, 100),
+	}
+}
+
+// Start starts the workers delivering queued messages until the context is done.
+func (q *Queue) Start(ctx context.Context) {
+	for _, lane := range q.lanes {
+		go q.work(ctx, lane)
+	}
+}
+
+// Enqueue adds a message to the queue without blocking.
+// A message that doesn't fit into the buffer is dead-lettered with ErrQueueFull.
+func (q *Queue) Enqueue(msg Message) {
+	select {
+	case q.lane(msg.ChatID) <- &msg:
+	default:
+		q.deadLetter(&msg, ErrQueueFull)
+	}
+}
+
+// lane returns the buffer of the worker delivering the messages of the chat.
+func (q *Queue) lane(chatID int64) chan *Message {
+	ind := chatID % int64(len(q.lanes))
+	if ind < 0 {
+		ind = -ind
+	}
+	return q.lanes[ind]
+}
+
+// SendText is a shortcut for enqueuing a text message.
+func (q *Queue) SendText(chatID int64, text string, opts *gotgbot.SendMessageOpts) {
+	q.Enqueue(Message{ChatID: chatID, Text: text, Opts: opts})
+}
+
+// IsBlocked reports whether the error means the user blocked the bot or the chat is unavailable.
+func IsBlocked(err error) bool {
+	var tgErr *gotgbot.TelegramError
+	return errors.As(err, &tgErr) && tgErr.Code == http.StatusForbidden
+}
+
+// chat holds the parked messages of a chat in the order they were enqueued.
+type chat struct {
+	messages  []*Message // messages are the undelivered messages of the chat, the first one is attempted next.
+	notBefore time.Time  // notBefore is the time the first message may be attempted at.
+}
+
+// work delivers messages from the lane until the context is done.
+// Messages are parked per chat: a message waiting for its chat or for a retry holds back only the later messages
+// of the same chat, while the other chats of the lane keep being delivered.
+func (q *Queue) work(ctx context.Context, lane chan *Message) {
+	chats := make(map[int64]*chat)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		wait := q.flush(ctx, chats)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait >= 0 {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			q.cancel(ctx.Err(), chats, lane)
+			return
+		case msg := <-lane:
+			if pending, ok := chats[msg.ChatID]; ok {
+				pending.messages = append(pending.messages, msg)
+			} else {
+				chats[msg.ChatID] = &chat{messages: []*Message{msg}}
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// flush attempts the first message of every chat that is due and returns the time until the next chat is due,
+// or a negative duration if nothing is parked.
+func (q *Queue) flush(ctx context.Context, chats map[int64]*chat) time.Duration {
+	wait := time.Duration(-1)
+
+	for chatID, pending := range chats {
+		for len(pending.messages) > 0 && ctx.Err() == nil {
+			now := time.Now()
+			if pending.notBefore.After(now) {
+				break
+			}
+
+			delay := q.attempt(ctx, pending.messages[0])
+			if delay > 0 {
+				pending.notBefore = now.Add(delay)
+				break
+			}
+
+			pending.messages[0] = nil
+			pending.messages = pending.messages[1:]
+		}
+
+		if len(pending.messages) == 0 {
+			delete(chats, chatID)
+			continue
+		}
+
+		if until := time.Until(pending.notBefore); wait < 0 || until < wait {
+			wait = max(until, 0)
+		}
+	}
+
+	return wait
+}
+
+// cancel drops the parked messages and the messages left in the lane once the queue is stopped.
+func (q *Queue) cancel(err error, chats map[int64]*chat, lane chan *Message) {
+	for _, pending := range chats {
+		for _, msg := range pending.messages {
+			q.done(msg, nil, err)
+		}
+	}
+
+	for {
+		select {
+		case msg := <-lane:
+			q.done(msg, nil, err)
+		default:
+			return
+		}
+	}
+}
+
+// attempt makes a single delivery attempt and returns the delay before the next one, or zero if the message is done with.
+func (q *Queue) attempt(ctx context.Context, msg *Message) time.Duration {
+	if delay := q.chatDelay(msg.ChatID); delay > 0 {
+		return delay
+	}
+
+	if err := q.global.wait(ctx); err != nil {
+		q.done(msg, nil, err)
+		return 0
+	}
+
+	msg.attempts++
+
+	var (
+		sent *gotgbot.Message
+		err  error
+	)
+
+	if msg.Send != nil {
+		sent, err = msg.Send(q.bot)
+	} else {
+		sent, err = q.bot.SendMessage(msg.ChatID, msg.Text, msg.Opts)
+	}
+
+	if err == nil {
+		q.done(msg, sent, nil)
+		return 0
+	}
+
+	var tgErr *gotgbot.TelegramError
+
+	switch {
+	case errors.As(err, &tgErr) && tgErr.Code == http.StatusTooManyRequests && tgErr.ResponseParams != nil:
+		wait := time.Duration(tgErr.ResponseParams.RetryAfter) * time.Second
+		q.global.pauseFor(wait)
+		q.pauseChat(msg.ChatID, wait)
+		if msg.attempts >= maxAttempts {
+			q.deadLetter(msg, err)
+			return 0
+		}
+		return wait
+	case IsBlocked(err), errors.As(err, &tgErr) && tgErr.Code == http.StatusBadRequest:
+		q.deadLetter(msg, err)
+		return 0
+	default:
+		if msg.attempts >= maxAttempts {
+			q.deadLetter(msg, err)
+			return 0
+		}
+		return baseBackoff << (msg.attempts - 1)
+	}
+}
+
+// chatDelay reserves a slot for the chat and returns zero, or returns the time to wait before the chat is free.
+func (q *Queue) chatDelay(chatID int64) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+
+	if next, ok := q.chats[chatID]; ok && next.After(now) {
+		return next.Sub(now)
+	}
+
+	if len(q.chats) > queueSize {
+		for id, next := range q.chats {
+			if next.Before(now) {
+				delete(q.chats, id)
+			}
+		}
+	}
+
+	q.chats[chatID] = now.Add(chatInterval)
+
+	return 0
+}
+
+// pauseChat forbids sending messages to the chat for the given duration.
+func (q *Queue) pauseChat(chatID int64, d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.chats[chatID] = time.Now().Add(d)
+}
+
+// deadLetter records a message that could not be delivered.
+func (q *Queue) deadLetter(msg *Message, err error) {
+	log.Printf("failed to deliver message to chat %d after %d attempts: %v", msg.ChatID, msg.attempts, err)
+
+	record := models.DeadLetter{ChatID: msg.ChatID, Text: msg.Text, Error: err.Error(), Attempts: msg.attempts, CreatedAt: time.Now()}
+
+	if errI := q.database.InsertDeadLetter(record); errI != nil {
+		log.Printf("failed to record dead letter: %v", errI)
+	}
+
+	q.done(msg, nil, err)
+}
+
+// done calls the completion callback of the message if it is set.
+func (q *Queue) done(msg *Message, sent *gotgbot.Message, err error) {
+	if msg.Done != nil {
+		msg.Done(sent, err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package clock provides a time source that can be replaced in rehearsals of the conference schedule.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is an interface that provides the current time.
+type Clock interface {
+	Now() time.Time // Now returns the current time.
+}
+
+// Real is a Clock that returns the system time.
+type Real struct{}
+
+// Now returns the system time.
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Simulated is a Clock that can be moved to an arbitrary moment to dry-run the conference.
+// The simulated time keeps running from the moment it was set. Until it is set, the system time is returned.
+type Simulated struct {
+	mu       sync.RWMutex
+	offset   time.Duration // offset is the difference between the simulated and the system time.
+	active   bool          // active is true while the simulation is running.
+	observer int64         // observer is the chat ID of the admin who runs the simulation.
+}
+
+// Now returns the simulated time if the simulation is running, otherwise the system time.
+func (s *Simulated) Now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return time.Now().Add(s.offset)
+}
+
+// Set starts the simulation from the given moment on behalf of the observer.
+func (s *Simulated) Set(t time.Time, observer int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset = time.Until(t)
+	s.active = true
+	s.observer = observer
+}
+
+// Advance moves the simulated time by d. It does nothing if the simulation is not running.
+func (s *Simulated) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		s.offset += d
+	}
+}
+
+// Reset stops the simulation and returns to the system time.
+func (s *Simulated) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offset = 0
+	s.active = false
+	s.observer = 0
+}
+
+// Observer returns the chat ID of the admin who runs the simulation and whether the simulation is running.
+func (s *Simulated) Observer() (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.observer, s.active
+}
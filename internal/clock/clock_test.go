@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// tolerance is the largest difference between the simulated time and the expected one, as the time runs on during a case.
+const tolerance = 50 * time.Millisecond
+
+func TestSimulated(t *testing.T) {
+	moment := time.Date(2024, time.May, 16, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		run          func(s *Simulated)
+		want         func() time.Time
+		wantObserver int64
+		wantActive   bool
+	}{
+		{
+			name: "system time until set",
+			run:  func(*Simulated) {},
+			want: time.Now,
+		},
+		{
+			name:         "set",
+			run:          func(s *Simulated) { s.Set(moment, 42) },
+			want:         func() time.Time { return moment },
+			wantObserver: 42,
+			wantActive:   true,
+		},
+		{
+			name: "advance",
+			run: func(s *Simulated) {
+				s.Set(moment, 42)
+				s.Advance(2 * time.Hour)
+				s.Advance(30 * time.Minute)
+			},
+			want:         func() time.Time { return moment.Add(150 * time.Minute) },
+			wantObserver: 42,
+			wantActive:   true,
+		},
+		{
+			name: "advance without simulation",
+			run:  func(s *Simulated) { s.Advance(time.Hour) },
+			want: time.Now,
+		},
+		{
+			name: "reset",
+			run: func(s *Simulated) {
+				s.Set(moment, 42)
+				s.Reset()
+			},
+			want: time.Now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Simulated{}
+			tt.run(s)
+
+			got, want := s.Now(), tt.want()
+			if diff := got.Sub(want); diff < -tolerance || diff > tolerance {
+				t.Errorf("Now() = %v, want %v", got, want)
+			}
+
+			if observer, active := s.Observer(); observer != tt.wantObserver || active != tt.wantActive {
+				t.Errorf("Observer() = %d, %v, want %d, %v", observer, active, tt.wantObserver, tt.wantActive)
+			}
+		})
+	}
+}
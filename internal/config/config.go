@@ -14,15 +14,33 @@ type Config struct {
 	Database
 	Telegram
 	Redis
-	DebugLevel int `env:"DEBUG_LEVEL" envDefault:"0"` // DebugLevel is the level of debugging. 0 is default.
+	Cache
+	Digest
+	Export
+	DebugLevel   int           `env:"DEBUG_LEVEL" envDefault:"0"`                 // DebugLevel is the level of debugging. 0 is default.
+	Simulation   bool          `env:"TIME_SIMULATION_ENABLED" envDefault:"false"` // Simulation enables the admin-only time simulation for staging. Default is false.
+	StateTTL     time.Duration `env:"STATE_TTL" envDefault:"30m"`                 // StateTTL is the time a user has to finish a flow before returning to the menu. Default is 30m.
+	LongStateTTL time.Duration `env:"LONG_STATE_TTL" envDefault:"2h"`             // LongStateTTL is the time to finish a schedule or questionnaire upload or a conference creation. Default is 2h.
 }
 
+// Database backends.
+const (
+	DatabaseMongo    = "mongo"
+	DatabaseMemory   = "memory"
+	DatabaseSQLite   = "sqlite"
+	DatabasePostgres = "postgres"
+)
+
 // Database is the configuration structure for the database.
 type Database struct {
-	Host     string `env:"DB_HOST" envDefault:"localhost"` // Host is the database host. Default is localhost.
-	Port     int    `env:"DB_PORT" envDefault:"27017"`     // Port is the database port. Default is 27017.
-	Password string `env:"DB_PASSWORD" envDefault:""`      // Password is the database password. Default is "".
-	User     string `env:"DB_USER" envDefault:""`          // User is the database user. Default is "".
+	Backend          string `env:"DB_BACKEND" envDefault:"mongo"`            // Backend is one of mongo, memory, sqlite or postgres. Default is mongo.
+	DSN              string `env:"DB_DSN" envDefault:""`                     // DSN is the file path for sqlite or the connection string for postgres.
+	Name             string `env:"DB_NAME" envDefault:"tg-bot"`              // Name is the mongo database name. Default is tg-bot.
+	Host             string `env:"DB_HOST" envDefault:"localhost"`           // Host is the database host. Default is localhost.
+	Port             int    `env:"DB_PORT" envDefault:"27017"`               // Port is the database port. Default is 27017.
+	Password         string `env:"DB_PASSWORD" envDefault:""`                // Password is the database password. Default is "".
+	User             string `env:"DB_USER" envDefault:""`                    // User is the database user. Default is "".
+	MigrationsDryRun bool   `env:"DB_MIGRATIONS_DRY_RUN" envDefault:"false"` // MigrationsDryRun logs the pending migrations on start instead of applying them. Default is false.
 }
 
 // Telegram is the configuration structure for Telegram.
@@ -33,8 +51,7 @@ type Telegram struct {
 
 // Administrators is the configuration structure for Telegram administrators.
 type Administrators struct {
-	IDs      []int        `env:"ADMIN_IDS_LIST" envSeparator:","` // IDs is the list of administrator IDs.
-	IDsInMap map[int]bool // IDsInMap is a map of administrator IDs for quick lookup.
+	IDs []int `env:"ADMIN_IDS_LIST" envSeparator:","` // IDs is the list of administrator IDs.
 }
 
 // Redis is the configuration structure for Redis.
@@ -43,16 +60,41 @@ type Redis struct {
 	Port int    `env:"REDIS_PORT" envDefault:"6379"`      // Port is the Redis port. Default is 6379.
 }
 
+// Cache backends of the user states and the notificator lease.
+const (
+	CacheRedis  = "redis"
+	CacheMemory = "memory"
+	CacheBolt   = "bolt"
+)
+
+// Cache is the configuration structure for the storage of the user states and the notificator lease.
+type Cache struct {
+	Backend  string `env:"CACHE_BACKEND" envDefault:"redis"`           // Backend is one of redis, memory or bolt. Default is redis.
+	BoltPath string `env:"CACHE_BOLT_PATH" envDefault:"data/cache.db"` // BoltPath is the path of the bolt database file. Default is data/cache.db.
+}
+
+// Digest is the configuration structure for the morning daily digest.
+type Digest struct {
+	Enabled bool `env:"DIGEST_ENABLED" envDefault:"false"` // Enabled turns the morning digest on. Default is false.
+	Hour    int  `env:"DIGEST_HOUR" envDefault:"9"`        // Hour is the hour (MSK) the digest is sent at. Default is 9.
+}
+
+// Export is the configuration structure for the reviews export.
+type Export struct {
+	TimeZone string `env:"EXPORT_TIME_ZONE" envDefault:"Europe/Moscow"` // TimeZone is the IANA time zone of the report times in the CSV and XLSX exports. Default is Europe/Moscow.
+}
+
 // confTime is a custom time type for unmarshalling time from environment variables.
 type confTime time.Time
 
-// Conference is the configuration structure for the conference.
+// Conference is the configuration structure for the default conference, it is stored in the database on start.
+// Other conferences are created from the bot.
 type Conference struct {
-	Name                 string   `env:"CONFERENCE_NAME" env-required:"true"`                   // Name is the conference name. It is required.
-	URL                  string   `env:"CONFERENCE_URL" env-required:"true"`                    // URL is the conference URL. It is required.
-	TimeFrom             confTime `env:"CONFERENCE_FROM_TIME" env-required:"true"`              // TimeFrom is the start time of the conference. It is required.
-	TimeUntil            confTime `env:"CONFERENCE_UNTIL_TIME" env-required:"true"`             // TimeUntil is the end time of the conference. It is required.
-	TimeReviewsAvailable confTime `env:"CONFERENCE_REVIEWS_AVAILABLE_TIME" env-required:"true"` // TimeReviewsAvailable is the time when reviews become available. It is required.
+	Name                 string   `env:"CONFERENCE_NAME"`                   // Name is the conference name. Without it there is no default conference.
+	URL                  string   `env:"CONFERENCE_URL"`                    // URL is the conference URL. It is required with the name.
+	TimeFrom             confTime `env:"CONFERENCE_FROM_TIME"`              // TimeFrom is the start time of the conference. It is required with the name.
+	TimeUntil            confTime `env:"CONFERENCE_UNTIL_TIME"`             // TimeUntil is the end time of the conference. It is required with the name.
+	TimeReviewsAvailable confTime `env:"CONFERENCE_REVIEWS_AVAILABLE_TIME"` // TimeReviewsAvailable is the time when reviews become available. It is required with the name.
 }
 
 // UnmarshalText unmarshals a byte slice into a confTime.
@@ -95,31 +137,63 @@ func New() (*Config, error) {
 		return nil, err
 	}
 	fmt.Println(cfg.Administrators.IDs)
-	// Conference name should be given
-	if cfg.Conference.Name == "" {
-		return nil, fmt.Errorf("CONFERENCE_NAME is required")
+	// The conference is optional: conferences can be created from the bot. If it is given, it is the default conference.
+	if cfg.Conference.Name != "" {
+		// Conference URL should be given
+		if cfg.Conference.URL == "" {
+			return nil, fmt.Errorf("CONFERENCE_URL is required")
+		}
+
+		// Conference times should be given
+		if time.Time(cfg.Conference.TimeFrom).IsZero() || time.Time(cfg.Conference.TimeUntil).IsZero() || time.Time(cfg.Conference.TimeReviewsAvailable).IsZero() {
+			return nil, fmt.Errorf("CONFERENCE_FROM_TIME, CONFERENCE_UNTIL_TIME and CONFERENCE_REVIEWS_AVAILABLE_TIME are required")
+		}
+
+		// Check that conference times are logical.
+		if time.Time(cfg.Conference.TimeFrom).After(time.Time(cfg.Conference.TimeUntil)) {
+			panic("time CONFERENCE_FROM_TIME bigger than CONFERENCE_UNTIL_TIME, it should be the other way around")
+		}
+
+		if time.Time(cfg.Conference.TimeUntil).After(time.Time(cfg.Conference.TimeReviewsAvailable)) {
+			panic("time CONFERENCE_REVIEWS_AVAILABLE_TIME less than CONFERENCE_UNTIL_TIME, it should be the other way around")
+		}
+	}
+
+	switch cfg.Database.Backend {
+	case DatabaseMongo, DatabaseMemory:
+	case DatabaseSQLite:
+		if cfg.Database.DSN == "" {
+			cfg.Database.DSN = "data/bot.db"
+		}
+	case DatabasePostgres:
+		if cfg.Database.DSN == "" {
+			return nil, fmt.Errorf("DB_DSN is required for the %s backend", DatabasePostgres)
+		}
+	default:
+		return nil, fmt.Errorf("DB_BACKEND should be one of %s, %s, %s or %s, got %q",
+			DatabaseMongo, DatabaseMemory, DatabaseSQLite, DatabasePostgres, cfg.Database.Backend)
 	}
 
-	// Conference URL should be given
-	if cfg.Conference.URL == "" {
-		return nil, fmt.Errorf("CONFERENCE_URL is required")
+	switch cfg.Cache.Backend {
+	case CacheRedis, CacheMemory, CacheBolt:
+	default:
+		return nil, fmt.Errorf("CACHE_BACKEND should be one of %s, %s or %s, got %q", CacheRedis, CacheMemory, CacheBolt, cfg.Cache.Backend)
 	}
 
-	// Check that conference times are logical.
-	if time.Time(cfg.Conference.TimeFrom).After(time.Time(cfg.Conference.TimeUntil)) {
-		panic("time CONFERENCE_FROM_TIME bigger than CONFERENCE_UNTIL_TIME, it should be the other way around")
+	if cfg.StateTTL <= 0 {
+		return nil, fmt.Errorf("STATE_TTL should be positive, got %s", cfg.StateTTL)
 	}
 
-	if time.Time(cfg.Conference.TimeUntil).After(time.Time(cfg.Conference.TimeReviewsAvailable)) {
-		panic("time CONFERENCE_REVIEWS_AVAILABLE_TIME less than CONFERENCE_UNTIL_TIME, it should be the other way around")
+	if cfg.LongStateTTL <= 0 {
+		return nil, fmt.Errorf("LONG_STATE_TTL should be positive, got %s", cfg.LongStateTTL)
 	}
 
-	// Create a map of administrator IDs for quick lookup.
-	cfg.Telegram.Administrators.IDsInMap = make(map[int]bool, len(cfg.Telegram.Administrators.IDs))
-	for _, v := range cfg.Telegram.Administrators.IDs {
-		if _, exists := cfg.Telegram.Administrators.IDsInMap[v]; !exists {
-			cfg.Telegram.Administrators.IDsInMap[v] = true
-		}
+	if cfg.Digest.Hour < 0 || cfg.Digest.Hour > 23 {
+		return nil, fmt.Errorf("DIGEST_HOUR should be between 0 and 23, got %d", cfg.Digest.Hour)
+	}
+
+	if _, err = time.LoadLocation(cfg.Export.TimeZone); err != nil {
+		return nil, fmt.Errorf("EXPORT_TIME_ZONE should be an IANA time zone, got %q: %w", cfg.Export.TimeZone, err)
 	}
 
 	return cfg, nil
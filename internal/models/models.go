@@ -5,28 +5,244 @@ import (
 	"time"
 )
 
-// Report represents a report with its start time, duration, title, speakers, and URL.
+// DefaultConferenceID is the ID of the conference configured by the CONFERENCE_* variables.
+// The data stored before conferences were introduced belongs to it.
+const DefaultConferenceID = "default"
+
+// Conference represents a conference with its own schedule, time window and review-open time.
+// Times are Moscow wall times labelled as UTC, like the start times of the reports.
+type Conference struct {
+	ID                   string    `bson:"_id"`                  // ID is the short unique code of the conference.
+	Name                 string    `bson:"name"`                 // Name is the name of the conference.
+	URL                  string    `bson:"url"`                  // URL is the site of the conference.
+	TimeFrom             time.Time `bson:"timeFrom"`             // TimeFrom is the start time of the conference.
+	TimeUntil            time.Time `bson:"timeUntil"`            // TimeUntil is the end time of the conference.
+	TimeReviewsAvailable time.Time `bson:"timeReviewsAvailable"` // TimeReviewsAvailable is the time when reviews become available.
+	CreatedBy            int       `bson:"createdBy"`            // CreatedBy is the Telegram ID of the admin who created the conference.
+}
+
+// Roles of the users.
+const (
+	RoleOwner     = "owner"     // RoleOwner manages the bot: conferences and the roles of all conferences.
+	RoleOrganizer = "organizer" // RoleOrganizer runs a conference: schedule, reviews, broadcasts and announcements.
+	RoleModerator = "moderator" // RoleModerator helps to run a conference: announcements and audience moderation.
+	RoleSpeaker   = "speaker"   // RoleSpeaker speaks at a conference.
+)
+
+// Roles are all the roles in the order of decreasing privileges.
+var Roles = []string{RoleOwner, RoleOrganizer, RoleModerator, RoleSpeaker}
+
+// UserRole is a role granted to a user. The owner role is granted for all conferences, the others for a single one.
+type UserRole struct {
+	TgID         int       `bson:"tgID"`         // TgID is the Telegram ID of the user.
+	Role         string    `bson:"role"`         // Role is the granted role.
+	ConferenceID string    `bson:"conferenceID"` // ConferenceID is the ID of the conference the role is granted for, empty for owners.
+	GrantedBy    int       `bson:"grantedBy"`    // GrantedBy is the Telegram ID of the owner who granted the role, zero if it was granted on start.
+	GrantedAt    time.Time `bson:"grantedAt"`    // GrantedAt is the time the role was granted at.
+}
+
+// Actions recorded in the role audit trail.
+const (
+	RoleGranted = "grant"  // RoleGranted is the action of granting a role.
+	RoleRevoked = "revoke" // RoleRevoked is the action of revoking a role.
+)
+
+// RoleAudit is an entry of the audit trail of role changes.
+type RoleAudit struct {
+	TgID         int       `bson:"tgID"`         // TgID is the Telegram ID of the user whose role changed.
+	Role         string    `bson:"role"`         // Role is the changed role.
+	ConferenceID string    `bson:"conferenceID"` // ConferenceID is the ID of the conference of the role, empty for owners.
+	Action       string    `bson:"action"`       // Action is either RoleGranted or RoleRevoked.
+	By           int       `bson:"by"`           // By is the Telegram ID of the owner who changed the role, zero if it was changed on start.
+	At           time.Time `bson:"at"`           // At is the time of the change.
+}
+
+// SpeakerLink links a user to a report they speak at.
+type SpeakerLink struct {
+	TgID         int       `bson:"tgID"`         // TgID is the Telegram ID of the speaker.
+	URL          string    `bson:"url"`          // URL is the URL of the report.
+	ConferenceID string    `bson:"conferenceID"` // ConferenceID is the ID of the conference the report belongs to.
+	LinkedBy     int       `bson:"linkedBy"`     // LinkedBy is the Telegram ID of the organizer who linked the speaker.
+	LinkedAt     time.Time `bson:"linkedAt"`     // LinkedAt is the time the speaker was linked at.
+}
+
+// Report represents a report with its start time, duration, title, speakers, URL and room.
 type Report struct {
-	StartTime time.Time `bson:"startTime"` // StartTime is the start time of the report.
-	Duration  int       `bson:"duration"`  // Duration is the duration of the report in minutes.
-	Title     string    `bson:"title"`     // Title is the title of the report.
-	Speakers  string    `bson:"speakers"`  // Speakers is a string of speakers' names.
-	URL       string    `bson:"url"`       // URL is the URL of the report.
+	ConferenceID string    `bson:"conferenceID"`   // ConferenceID is the ID of the conference the report belongs to.
+	StartTime    time.Time `bson:"startTime"`      // StartTime is the start time of the report.
+	Duration     int       `bson:"duration"`       // Duration is the duration of the report in minutes.
+	Title        string    `bson:"title"`          // Title is the title of the report.
+	Speakers     string    `bson:"speakers"`       // Speakers is a string of speakers' names.
+	URL          string    `bson:"url"`            // URL is the URL of the report.
+	Room         string    `bson:"room,omitempty"` // Room is the room the report takes place in. It is optional.
+}
+
+// Ref returns the reference to the report.
+func (r Report) Ref() ReportRef {
+	return ReportRef{ConferenceID: r.ConferenceID, URL: r.URL}
+}
+
+// ReportRef references a report by its conference and URL: a URL is unique only within its conference.
+type ReportRef struct {
+	ConferenceID string `bson:"conferenceID"` // ConferenceID is the ID of the conference the report belongs to.
+	URL          string `bson:"url"`          // URL is the URL of the report.
+}
+
+// ReportChange represents a change of a scheduled report caused by a schedule upload.
+type ReportChange struct {
+	Previous     Report // Previous is the report as it was before the upload.
+	Current      Report // Current is the report as it is after the upload. It is empty for cancelled reports.
+	TimeMoved    bool   // TimeMoved is true if the start time or the duration of the report changed.
+	TitleChanged bool   // TitleChanged is true if the title of the report changed.
+	Cancelled    bool   // Cancelled is true if the report was removed from the schedule.
 }
 
 // User represents a user with their chat ID, Telegram ID, identification, and favorite reports.
 type User struct {
-	ChatID          int      `bson:"chatID"`          // ChatID is the ID of the chat with the user.
-	TgID            int      `bson:"tgID"`            // TgID is the Telegram ID of the user.
-	Identification  string   `bson:"identification"`  // Identification is the identification of the user.
-	FavoriteReports []Report `bson:"favoriteReports"` // FavoriteReports is a slice of the user's favorite reports.
+	ChatID          int         `bson:"chatID"`                 // ChatID is the ID of the chat with the user.
+	TgID            int         `bson:"tgID"`                   // TgID is the Telegram ID of the user.
+	Identification  string      `bson:"identification"`         // Identification is the identification of the user.
+	Favorites       []ReportRef `bson:"favorites,omitempty"`    // Favorites are the references to the user's favorite reports in the order they were added.
+	FavoriteReports []Report    `bson:"-"`                      // FavoriteReports are resolved from Favorites on read and never stored.
+	ConferenceID    string      `bson:"conferenceID,omitempty"` // ConferenceID is the ID of the conference the user picked.
+}
+
+// ActiveConference returns the ID of the conference the user picked, users who never picked one are at the default conference.
+func (u User) ActiveConference() string {
+	if u.ConferenceID == "" {
+		return DefaultConferenceID
+	}
+	return u.ConferenceID
 }
 
 // Evaluation represents an evaluation with its URL, Telegram ID, content, performance, and comment.
 type Evaluation struct {
-	URL         string `bson:"url" json:"url"`                           // URL is the URL of the evaluation.
-	TgID        int    `bson:"tgID" json:"tgID"`                         // TgID is the Telegram ID of the user who made the evaluation.
-	Content     string `bson:"content" json:"content"`                   // Content is the content of the evaluation.
-	Performance string `bson:"performance,omitempty" json:"performance"` // Performance is the performance rating of the evaluation. It is optional.
-	Comment     string `bson:"comment,omitempty" bson:"comment"`         // Comment is the comment of the evaluation. It is optional.
+	URL          string `bson:"url" json:"url"`                           // URL is the URL of the evaluated report.
+	ConferenceID string `bson:"conferenceID" json:"conferenceID"`         // ConferenceID is the ID of the conference of the evaluated report.
+	TgID         int    `bson:"tgID" json:"tgID"`                         // TgID is the Telegram ID of the user who made the evaluation.
+	Content      string `bson:"content" json:"content"`                   // Content is the content of the evaluation.
+	Performance  string `bson:"performance,omitempty" json:"performance"` // Performance is the performance rating of the evaluation. It is optional.
+	Comment      string `bson:"comment,omitempty" bson:"comment"`         // Comment is the comment of the evaluation. It is optional.
+	// Answers are the answers to the questionnaire by the IDs of its items. The answers to the items with the IDs
+	// of the default questionnaire are also kept in Content, Performance and Comment.
+	Answers map[string]string `bson:"answers,omitempty" json:"answers,omitempty"`
+}
+
+// Types of the items of a review questionnaire.
+const (
+	ItemScale  = "scale"  // ItemScale is a mark from Min to Max.
+	ItemSingle = "single" // ItemSingle is a choice of one of the options.
+	ItemMulti  = "multi"  // ItemMulti is a choice of any number of the options.
+	ItemYesNo  = "yesno"  // ItemYesNo is a yes or no answer.
+	ItemText   = "text"   // ItemText is a free text answer.
+)
+
+// IDs of the items of the default questionnaire, their answers are kept in the fields of an evaluation.
+const (
+	ItemContent     = "content"
+	ItemPerformance = "performance"
+	ItemComment     = "comment"
+)
+
+// QuestionnaireItem represents a question of a review questionnaire.
+type QuestionnaireItem struct {
+	ID       string   `bson:"id" json:"id"`                                 // ID is the key of the answer to the item in an evaluation.
+	Type     string   `bson:"type" json:"type"`                             // Type is the type of the item.
+	Text     string   `bson:"text" json:"text"`                             // Text is the question shown to the user.
+	Min      int      `bson:"min,omitempty" json:"min,omitempty"`           // Min is the lowest mark of a scale.
+	Max      int      `bson:"max,omitempty" json:"max,omitempty"`           // Max is the highest mark of a scale.
+	Options  []string `bson:"options,omitempty" json:"options,omitempty"`   // Options are the options of a single or multiple choice.
+	Optional bool     `bson:"optional,omitempty" json:"optional,omitempty"` // Optional is true if the user may skip the item.
+}
+
+// Questionnaire represents the review questionnaire of a conference or of one of its tracks.
+type Questionnaire struct {
+	ConferenceID string              `bson:"conferenceID" json:"conferenceID"` // ConferenceID is the ID of the conference.
+	Track        string              `bson:"track" json:"track"`               // Track is the room of the reports, empty for the whole conference.
+	Items        []QuestionnaireItem `bson:"items" json:"items"`               // Items are the questions in the order they are asked.
+	UpdatedBy    int                 `bson:"updatedBy" json:"updatedBy"`       // UpdatedBy is the Telegram ID of the admin who uploaded the questionnaire.
+	UpdatedAt    time.Time           `bson:"updatedAt" json:"updatedAt"`       // UpdatedAt is the time the questionnaire was uploaded at.
+}
+
+// DefaultQuestionnaire returns the items asked when neither the track nor the conference has a questionnaire:
+// the marks from 1 to 5 for the content and the performance and an optional comment.
+func DefaultQuestionnaire() []QuestionnaireItem {
+	return []QuestionnaireItem{
+		{ID: ItemContent, Type: ItemScale, Text: "Какую оценку вы бы поставили за содержание доклада:", Min: 1, Max: 5},
+		{ID: ItemPerformance, Type: ItemScale, Text: "Какую бы оценку вы поставили за выступление:", Min: 1, Max: 5},
+		{ID: ItemComment, Type: ItemText, Text: "Введите дополнительный комментарий или нажмите на кнопку \"Далее\"", Optional: true},
+	}
+}
+
+// Question represents a question of a user to the speaker asked while the report is running.
+type Question struct {
+	ID           string    `bson:"_id" json:"id"`                    // ID is the unique identifier of the question.
+	ConferenceID string    `bson:"conferenceID" json:"conferenceID"` // ConferenceID is the ID of the conference the report belongs to.
+	URL          string    `bson:"url" json:"url"`                   // URL is the URL of the report.
+	TgID         int       `bson:"tgID" json:"tgID"`                 // TgID is the Telegram ID of the user who asked the question.
+	Text         string    `bson:"text" json:"text"`                 // Text is the text of the question.
+	Votes        int       `bson:"votes" json:"votes"`               // Votes is the number of upvotes of the question.
+	Answered     bool      `bson:"answered" json:"answered"`         // Answered is true if the speaker or a moderator marked the question as answered.
+	AskedAt      time.Time `bson:"askedAt" json:"askedAt"`           // AskedAt is the time the question was asked at.
+}
+
+// Poll represents a multiple-choice poll launched by a speaker or a moderator during a report.
+type Poll struct {
+	ID               string    `bson:"_id" json:"id"`                    // ID is the unique identifier of the poll.
+	ConferenceID     string    `bson:"conferenceID" json:"conferenceID"` // ConferenceID is the ID of the conference the report belongs to.
+	URL              string    `bson:"url" json:"url"`                   // URL is the URL of the report.
+	Question         string    `bson:"question" json:"question"`         // Question is the question of the poll.
+	Options          []string  `bson:"options" json:"options"`           // Options are the answer options of the poll.
+	Counts           []int     `bson:"counts" json:"counts"`             // Counts are the numbers of votes for each option.
+	Closed           bool      `bson:"closed" json:"closed"`             // Closed is true if the poll no longer accepts votes.
+	CreatedBy        int       `bson:"createdBy" json:"createdBy"`       // CreatedBy is the Telegram ID of the user who launched the poll.
+	ResultsMessageID int64     `bson:"resultsMessageID" json:"-"`        // ResultsMessageID is the ID of the message with the live results in the chat of the creator.
+	CreatedAt        time.Time `bson:"createdAt" json:"createdAt"`       // CreatedAt is the time the poll was launched at.
+}
+
+// Survey represents the answers of a user to the survey about a whole conference.
+type Survey struct {
+	ConferenceID string    `bson:"conferenceID" json:"conferenceID"` // ConferenceID is the ID of the conference.
+	TgID         int       `bson:"tgID" json:"tgID"`                 // TgID is the Telegram ID of the user who answered the survey.
+	NPS          int       `bson:"nps" json:"nps"`                   // NPS is the likelihood from 0 to 10 that the user recommends the conference.
+	Venue        int       `bson:"venue" json:"venue"`               // Venue is the mark from 1 to 5 for the venue.
+	Catering     int       `bson:"catering" json:"catering"`         // Catering is the mark from 1 to 5 for the catering.
+	Organization int       `bson:"organization" json:"organization"` // Organization is the mark from 1 to 5 for the organization.
+	Comment      string    `bson:"comment,omitempty" json:"comment"` // Comment is the free text feedback. It is optional.
+	AnsweredAt   time.Time `bson:"answeredAt" json:"answeredAt"`     // AnsweredAt is the time the user finished the survey.
+}
+
+// DeadLetter represents an outbound message that could not be delivered after all retries.
+type DeadLetter struct {
+	ChatID    int64     `bson:"chatID"`    // ChatID is the ID of the chat the message was addressed to.
+	Text      string    `bson:"text"`      // Text is the text or caption of the message.
+	Error     string    `bson:"error"`     // Error is the last error returned by Telegram.
+	Attempts  int       `bson:"attempts"`  // Attempts is the number of delivery attempts made.
+	CreatedAt time.Time `bson:"createdAt"` // CreatedAt is the time the message was dead-lettered.
+}
+
+// Statuses of an announcement.
+const (
+	AnnouncementPending   = "pending"   // AnnouncementPending is the status of an announcement waiting to be sent.
+	AnnouncementSent      = "sent"      // AnnouncementSent is the status of a delivered announcement.
+	AnnouncementCancelled = "cancelled" // AnnouncementCancelled is the status of an announcement cancelled by an admin.
+)
+
+// Announcement represents an announcement scheduled by an admin to be sent to the users of a conference at a set time.
+type Announcement struct {
+	ID           string    `bson:"_id"`          // ID is the unique identifier of the announcement.
+	ConferenceID string    `bson:"conferenceID"` // ConferenceID is the ID of the conference whose users get the announcement.
+	Text         string    `bson:"text"`         // Text is the text of the announcement.
+	SendAt       time.Time `bson:"sendAt"`       // SendAt is the time the announcement should be sent at.
+	Status       string    `bson:"status"`       // Status is the status of the announcement.
+	CreatedBy    int       `bson:"createdBy"`    // CreatedBy is the Telegram ID of the admin who created the announcement.
+}
+
+// AbandonedFlow is a record of a user who left a flow unfinished until its state expired.
+type AbandonedFlow struct {
+	TgID        int       `bson:"tgID"`           // TgID is the Telegram ID of the user.
+	State       string    `bson:"state"`          // State is the name of the abandoned state.
+	Step        string    `bson:"step,omitempty"` // Step is the step of the conversation the user stopped at, if any.
+	EnteredAt   time.Time `bson:"enteredAt"`      // EnteredAt is the time the user entered the state.
+	AbandonedAt time.Time `bson:"abandonedAt"`    // AbandonedAt is the time the expired state was detected.
 }
@@ -0,0 +1,228 @@
+// Package bolt provides an embedded on-disk cache based on BoltDB for single-process deployments.
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
+	"go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	cacheBucket = []byte("cache") // cacheBucket is the bucket of the cached values.
+	locksBucket = []byte("locks") // locksBucket is the bucket of the locks.
+)
+
+// Client is a BoltDB-backed cache that implements the redis.CacheClient, redis.Locker and redis.Marker interfaces.
+// The database file is locked by the process, so it can't be shared between bot replicas.
+type Client struct {
+	db    *bbolt.DB
+	swept time.Time // swept is the time the expired entries were last deleted. It is accessed only within write transactions.
+}
+
+// New opens or creates the database file at the path and returns a pointer to a new Client.
+func New(path string) (*Client, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{cacheBucket, locksBucket} {
+			if _, errC := tx.CreateBucketIfNotExists(bucket); errC != nil {
+				return errC
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Client{db: db}, nil
+}
+
+// Close closes the database file.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// Get retrieves a value from the cache by key.
+// It returns redis.Nil if there is no value or it has expired.
+func (c *Client) Get(_ context.Context, key int64) (string, error) {
+	var e redis.Entry
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		var errG error
+		e, errG = get(tx.Bucket(cacheBucket), strconv.FormatInt(key, 10))
+		return errG
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return e.Value, nil
+}
+
+// Set adds a value to the cache with a specified duration. Zero duration means the value never expires.
+func (c *Client) Set(_ context.Context, key int64, value interface{}, duration time.Duration) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		if err := c.sweep(tx); err != nil {
+			return err
+		}
+		return put(tx.Bucket(cacheBucket), strconv.FormatInt(key, 10), redis.NewEntry(value, duration))
+	})
+}
+
+// Acquire takes the lock with the given key for the owner if it is free.
+// The lock expires after ttl unless it is refreshed. It reports whether the lock was taken.
+func (c *Client) Acquire(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	var acquired bool
+
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		if err := c.sweep(tx); err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(locksBucket)
+
+		if _, err := get(bucket, key); err == nil {
+			return nil
+		} else if !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		acquired = true
+
+		return put(bucket, key, redis.NewEntry(owner, ttl))
+	})
+
+	return acquired, err
+}
+
+// Mark sets the mark with the given key if it isn't set, the mark expires after ttl.
+// Marks are stored as locks. It reports whether the mark was set by this call.
+func (c *Client) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.Acquire(ctx, key, "1", ttl)
+}
+
+// Refresh prolongs the lease of the lock for ttl if it is still held by the owner.
+// It reports whether the lock is still held.
+func (c *Client) Refresh(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	var held bool
+
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(locksBucket)
+
+		lock, err := get(bucket, key)
+		if errors.Is(err, redis.Nil) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if lock.Value != owner {
+			return nil
+		}
+
+		held = true
+
+		return put(bucket, key, redis.NewEntry(owner, ttl))
+	})
+
+	return held, err
+}
+
+// Release frees the lock if it is held by the owner.
+func (c *Client) Release(_ context.Context, key, owner string) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(locksBucket)
+
+		lock, err := get(bucket, key)
+		if errors.Is(err, redis.Nil) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if lock.Value != owner {
+			return nil
+		}
+
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// sweep deletes the expired values and locks once redis.SweepInterval has passed since the last sweep.
+// The deletions are made by the given write transaction.
+func (c *Client) sweep(tx *bbolt.Tx) error {
+	now := time.Now()
+	if now.Sub(c.swept) < redis.SweepInterval {
+		return nil
+	}
+
+	for _, name := range [][]byte{cacheBucket, locksBucket} {
+		var expired [][]byte
+
+		err := tx.Bucket(name).ForEach(func(key, data []byte) error {
+			var e redis.Entry
+			if err := json.Unmarshal(data, &e); err != nil || e.Expired(now) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err = tx.Bucket(name).Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.swept = now
+
+	return nil
+}
+
+// get returns the entry stored in the bucket by key or redis.Nil if there is no entry or it has expired.
+func get(bucket *bbolt.Bucket, key string) (redis.Entry, error) {
+	var e redis.Entry
+
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return e, redis.Nil
+	}
+
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, err
+	}
+
+	if e.Expired(time.Now()) {
+		return redis.Entry{}, redis.Nil
+	}
+
+	return e, nil
+}
+
+// put stores the entry in the bucket by key.
+func put(bucket *bbolt.Bucket, key string, e redis.Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
@@ -0,0 +1,122 @@
+// Package memory provides an in-memory cache and repository for tests and single-process deployments.
+package memory
+
+import (
+	"context"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/redis"
+	"sync"
+	"time"
+)
+
+// Client is an in-memory cache that implements the redis.CacheClient, redis.Locker and redis.Marker interfaces.
+// Its data is lost on restart and isn't shared between processes.
+type Client struct {
+	mu    sync.Mutex
+	cache map[int64]redis.Entry
+	locks map[string]redis.Entry
+	swept time.Time // swept is the time the expired entries were last deleted.
+}
+
+// New creates a new empty Client and returns a pointer to it.
+func New() *Client {
+	return &Client{cache: make(map[int64]redis.Entry), locks: make(map[string]redis.Entry)}
+}
+
+// Get retrieves a value from the cache by key.
+// It returns redis.Nil if there is no value or it has expired.
+func (c *Client) Get(_ context.Context, key int64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, exists := c.cache[key]
+	if !exists || e.Expired(time.Now()) {
+		delete(c.cache, key)
+		return "", redis.Nil
+	}
+
+	return e.Value, nil
+}
+
+// Set adds a value to the cache with a specified duration. Zero duration means the value never expires.
+func (c *Client) Set(_ context.Context, key int64, value interface{}, duration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sweep(time.Now())
+	c.cache[key] = redis.NewEntry(value, duration)
+
+	return nil
+}
+
+// Acquire takes the lock with the given key for the owner if it is free.
+// The lock expires after ttl unless it is refreshed. It reports whether the lock was taken.
+func (c *Client) Acquire(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	if lock, exists := c.locks[key]; exists && !lock.Expired(now) {
+		return false, nil
+	}
+
+	c.locks[key] = redis.NewEntry(owner, ttl)
+
+	return true, nil
+}
+
+// Mark sets the mark with the given key if it isn't set, the mark expires after ttl.
+// Marks are stored as locks. It reports whether the mark was set by this call.
+func (c *Client) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.Acquire(ctx, key, "1", ttl)
+}
+
+// Refresh prolongs the lease of the lock for ttl if it is still held by the owner.
+// It reports whether the lock is still held.
+func (c *Client) Refresh(_ context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lock, exists := c.locks[key]
+	if !exists || lock.Expired(time.Now()) || lock.Value != owner {
+		return false, nil
+	}
+
+	c.locks[key] = redis.NewEntry(owner, ttl)
+
+	return true, nil
+}
+
+// Release frees the lock if it is held by the owner.
+func (c *Client) Release(_ context.Context, key, owner string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lock, exists := c.locks[key]; exists && lock.Value == owner {
+		delete(c.locks, key)
+	}
+
+	return nil
+}
+
+// sweep deletes the expired values and locks once SweepInterval has passed since the last sweep.
+// The caller should hold c.mu.
+func (c *Client) sweep(now time.Time) {
+	if now.Sub(c.swept) < redis.SweepInterval {
+		return
+	}
+	c.swept = now
+
+	for key, e := range c.cache {
+		if e.Expired(now) {
+			delete(c.cache, key)
+		}
+	}
+
+	for key, lock := range c.locks {
+		if lock.Expired(now) {
+			delete(c.locks, key)
+		}
+	}
+}
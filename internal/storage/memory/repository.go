@@ -0,0 +1,1024 @@
+package memory
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Repository implements storage.Repository.
+var _ storage.Repository = (*Repository)(nil)
+
+// evaluationKey is the key of an evaluation: a user rates a report only once.
+type evaluationKey struct {
+	tgID   int
+	report models.ReportRef
+}
+
+// voteKey is the key of a vote: a user upvotes a question or votes in a poll only once.
+// It also keys the survey invites by the conference ID.
+type voteKey struct {
+	tgID int
+	id   string
+}
+
+// Repository is an in-memory implementation of storage.Repository for tests and short-lived single-process setups.
+// Its data is lost on restart. Returned slices are copies, so callers can't change the stored data.
+type Repository struct {
+	mu             sync.RWMutex
+	conferences    map[string]models.Conference
+	reports        []models.Report
+	users          []models.User
+	evaluations    map[evaluationKey]models.Evaluation
+	order          []evaluationKey
+	announcements  map[string]models.Announcement
+	deadLetters    []models.DeadLetter
+	abandonedFlows []models.AbandonedFlow
+	roles          []models.UserRole
+	roleAudit      []models.RoleAudit
+	speakerLinks   []models.SpeakerLink
+	questions      []models.Question
+	votes          map[voteKey]bool
+	polls          []models.Poll
+	pollVotes      map[voteKey]bool
+	views          map[models.ReportRef][]int
+	questionnaires []models.Questionnaire
+	surveys        []models.Survey
+	surveyInvites  map[voteKey]time.Time
+	lastID         int
+}
+
+// NewRepository creates a new empty Repository and returns a pointer to it.
+func NewRepository() *Repository {
+	return &Repository{
+		conferences:   make(map[string]models.Conference),
+		evaluations:   make(map[evaluationKey]models.Evaluation),
+		announcements: make(map[string]models.Announcement),
+		votes:         make(map[voteKey]bool),
+		pollVotes:     make(map[voteKey]bool),
+		views:         make(map[models.ReportRef][]int),
+		surveyInvites: make(map[voteKey]time.Time),
+	}
+}
+
+// SaveConference inserts the conference or replaces the one with the same ID.
+func (r *Repository) SaveConference(conference models.Conference) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.conferences[conference.ID] = conference
+
+	return nil
+}
+
+// SelectConference returns the conference with the ID.
+func (r *Repository) SelectConference(id string) (models.Conference, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conference, exists := r.conferences[id]
+	if !exists {
+		return models.Conference{}, storage.ErrNotFound
+	}
+
+	return conference, nil
+}
+
+// SelectConferences returns all conferences ordered by their start time.
+func (r *Repository) SelectConferences() ([]models.Conference, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conferences := make([]models.Conference, 0, len(r.conferences))
+	for _, conference := range r.conferences {
+		conferences = append(conferences, conference)
+	}
+
+	sort.Slice(conferences, func(i, j int) bool {
+		return conferences[i].TimeFrom.Before(conferences[j].TimeFrom)
+	})
+
+	return conferences, nil
+}
+
+// UpdateReports replaces the schedule of the conference with the given reports and returns the changes of the previously scheduled ones.
+func (r *Repository) UpdateReports(conferenceID string, reports []models.Report) ([]models.ReportChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes := storage.DiffReports(r.conferenceReports(conferenceID), reports)
+
+	if len(reports) == 0 {
+		return changes, nil
+	}
+
+	kept := r.reports[:0]
+	for _, report := range r.reports {
+		if report.ConferenceID != conferenceID {
+			kept = append(kept, report)
+		}
+	}
+
+	for _, report := range reports {
+		report.ConferenceID = conferenceID
+		kept = append(kept, report)
+	}
+
+	r.reports = kept
+
+	return changes, nil
+}
+
+// SelectReport returns the report of the conference with the URL.
+func (r *Repository) SelectReport(conferenceID, url string) (models.Report, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, report := range r.reports {
+		if report.ConferenceID == conferenceID && report.URL == url {
+			return report, nil
+		}
+	}
+
+	return models.Report{}, storage.ErrNotFound
+}
+
+// SelectReports returns the reports of the conference or of all conferences if conferenceID is empty.
+func (r *Repository) SelectReports(conferenceID string) ([]models.Report, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.conferenceReports(conferenceID), nil
+}
+
+// conferenceReports returns a copy of the reports of the conference or of all reports if conferenceID is empty.
+// The caller should hold the lock.
+func (r *Repository) conferenceReports(conferenceID string) []models.Report {
+	var reports []models.Report
+	for _, report := range r.reports {
+		if conferenceID == "" || report.ConferenceID == conferenceID {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// InsertUser inserts a new user, an existing user with the same Telegram ID is left untouched.
+func (r *Repository) InsertUser(user models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.user(user.TgID) != nil {
+		return nil
+	}
+
+	user = copyUser(user)
+	user.FavoriteReports = nil
+	r.users = append(r.users, user)
+
+	return nil
+}
+
+// SelectUser returns the user with the Telegram ID.
+func (r *Repository) SelectUser(tgID int) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user := r.user(tgID)
+	if user == nil {
+		return models.User{}, storage.ErrNotFound
+	}
+
+	users := []models.User{copyUser(*user)}
+	storage.ResolveFavorites(users, r.reports)
+
+	return users[0], nil
+}
+
+// SelectUsers returns all users.
+func (r *Repository) SelectUsers() ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, copyUser(user))
+	}
+
+	storage.ResolveFavorites(users, r.reports)
+
+	return users, nil
+}
+
+// UpdateUserID updates the identification of the user, the user is created if it doesn't exist.
+func (r *Repository) UpdateUserID(tgID int, identification string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user := r.user(tgID)
+	if user == nil {
+		r.users = append(r.users, models.User{TgID: tgID, Identification: identification})
+		return true, nil
+	}
+
+	user.Identification = identification
+
+	return true, nil
+}
+
+// SelectUserConference returns the conference the user picked.
+func (r *Repository) SelectUserConference(tgID int) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user := r.user(tgID)
+	if user == nil {
+		return "", storage.ErrNotFound
+	}
+
+	return user.ActiveConference(), nil
+}
+
+// SetUserConference sets the conference the user picked.
+func (r *Repository) SetUserConference(tgID int, conferenceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user := r.user(tgID); user != nil {
+		user.ConferenceID = conferenceID
+	}
+
+	return nil
+}
+
+// AddUserFavReport adds the report of the conference to the favorites of the user if it isn't there yet.
+func (r *Repository) AddUserFavReport(tgID int, conferenceID, reportURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user := r.user(tgID)
+	if user == nil {
+		return nil
+	}
+
+	ref := models.ReportRef{ConferenceID: conferenceID, URL: reportURL}
+	if !slices.Contains(user.Favorites, ref) {
+		user.Favorites = append(user.Favorites, ref)
+	}
+
+	return nil
+}
+
+// RemoveUserFavReport removes the report of the conference from the favorite reports of the user.
+func (r *Repository) RemoveUserFavReport(tgID int, conferenceID, reportURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user := r.user(tgID); user != nil {
+		user.Favorites = without(user.Favorites, models.ReportRef{ConferenceID: conferenceID, URL: reportURL})
+	}
+
+	return nil
+}
+
+// RemoveFavReportFromAll removes the report of the conference from the favorite reports of every user.
+func (r *Repository) RemoveFavReportFromAll(conferenceID, reportURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.users {
+		r.users[i].Favorites = without(r.users[i].Favorites, models.ReportRef{ConferenceID: conferenceID, URL: reportURL})
+	}
+
+	return nil
+}
+
+// InsertEvaluation inserts a new evaluation, an existing evaluation of the report by the user is left untouched.
+func (r *Repository) InsertEvaluation(evaluation models.Evaluation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := evaluationKey{tgID: evaluation.TgID, report: models.ReportRef{ConferenceID: evaluation.ConferenceID, URL: evaluation.URL}}
+	if _, exists := r.evaluations[key]; exists {
+		return nil
+	}
+
+	r.evaluations[key] = copyEvaluation(evaluation)
+	r.order = append(r.order, key)
+
+	return nil
+}
+
+// SelectEvaluation returns the evaluation of the report of the conference by the user and reports whether it exists.
+func (r *Repository) SelectEvaluation(tgID int, conferenceID, url string) (bool, models.Evaluation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	evaluation, exists := r.evaluations[evaluationKey{tgID: tgID, report: models.ReportRef{ConferenceID: conferenceID, URL: url}}]
+
+	return exists, copyEvaluation(evaluation), nil
+}
+
+// SelectEvaluations returns the evaluations of the reports of the conference made by the user in the order they were made.
+func (r *Repository) SelectEvaluations(tgID int, conferenceID string) ([]models.Evaluation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var evaluations []models.Evaluation
+	for _, key := range r.order {
+		if key.tgID == tgID && key.report.ConferenceID == conferenceID {
+			evaluations = append(evaluations, copyEvaluation(r.evaluations[key]))
+		}
+	}
+
+	return evaluations, nil
+}
+
+// SelectAllEvaluations returns the evaluations of the reports of the conference in the order they were made.
+func (r *Repository) SelectAllEvaluations(conferenceID string) ([]models.Evaluation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var evaluations []models.Evaluation
+	for _, key := range r.order {
+		if key.report.ConferenceID == conferenceID {
+			evaluations = append(evaluations, copyEvaluation(r.evaluations[key]))
+		}
+	}
+
+	return evaluations, nil
+}
+
+// UpdateEvaluation updates the marks, the comment and the answers of an evaluation. It reports whether anything changed.
+func (r *Repository) UpdateEvaluation(tgID int, conferenceID, url string, evaluation models.Evaluation) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := evaluationKey{tgID: tgID, report: models.ReportRef{ConferenceID: conferenceID, URL: url}}
+
+	stored, exists := r.evaluations[key]
+	if !exists {
+		return false, nil
+	}
+
+	if stored.Content == evaluation.Content && stored.Performance == evaluation.Performance &&
+		stored.Comment == evaluation.Comment && maps.Equal(stored.Answers, evaluation.Answers) {
+		return false, nil
+	}
+
+	stored.Content, stored.Performance, stored.Comment = evaluation.Content, evaluation.Performance, evaluation.Comment
+	stored.Answers = maps.Clone(evaluation.Answers)
+
+	r.evaluations[key] = stored
+
+	return true, nil
+}
+
+// DeleteEvaluation deletes the evaluation of the report of the conference by the user and reports whether it existed.
+func (r *Repository) DeleteEvaluation(tgID int, conferenceID, url string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := evaluationKey{tgID: tgID, report: models.ReportRef{ConferenceID: conferenceID, URL: url}}
+	if _, exists := r.evaluations[key]; !exists {
+		return false, nil
+	}
+
+	delete(r.evaluations, key)
+
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+
+	return true, nil
+}
+
+// InsertAnnouncement inserts a new announcement and returns its ID.
+func (r *Repository) InsertAnnouncement(announcement models.Announcement) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	announcement.ID = strconv.Itoa(r.lastID)
+	r.announcements[announcement.ID] = announcement
+
+	return announcement.ID, nil
+}
+
+// SelectAnnouncement returns the announcement with the ID.
+func (r *Repository) SelectAnnouncement(id string) (models.Announcement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	announcement, exists := r.announcements[id]
+	if !exists {
+		return models.Announcement{}, storage.ErrNotFound
+	}
+
+	return announcement, nil
+}
+
+// SelectAnnouncements returns the announcements with the status ordered by their send time.
+func (r *Repository) SelectAnnouncements(status string) ([]models.Announcement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var announcements []models.Announcement
+	for _, announcement := range r.announcements {
+		if announcement.Status == status {
+			announcements = append(announcements, announcement)
+		}
+	}
+
+	sort.Slice(announcements, func(i, j int) bool {
+		return announcements[i].SendAt.Before(announcements[j].SendAt)
+	})
+
+	return announcements, nil
+}
+
+// UpdateAnnouncement updates the text and the send time of a pending announcement. It reports whether it was pending.
+func (r *Repository) UpdateAnnouncement(id string, text string, sendAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	announcement, exists := r.announcements[id]
+	if !exists || announcement.Status != models.AnnouncementPending {
+		return false, nil
+	}
+
+	announcement.Text, announcement.SendAt = text, sendAt
+	r.announcements[id] = announcement
+
+	return true, nil
+}
+
+// SetAnnouncementStatus changes the status of an announcement if it currently has the status from.
+func (r *Repository) SetAnnouncementStatus(id string, from, to string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	announcement, exists := r.announcements[id]
+	if !exists || announcement.Status != from {
+		return false, nil
+	}
+
+	announcement.Status = to
+	r.announcements[id] = announcement
+
+	return true, nil
+}
+
+// InsertDeadLetter stores an undelivered message.
+func (r *Repository) InsertDeadLetter(letter models.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadLetters = append(r.deadLetters, letter)
+
+	return nil
+}
+
+// DeadLetters returns the stored undelivered messages.
+func (r *Repository) DeadLetters() []models.DeadLetter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]models.DeadLetter(nil), r.deadLetters...)
+}
+
+// InsertAbandonedFlow stores an abandoned flow.
+func (r *Repository) InsertAbandonedFlow(flow models.AbandonedFlow) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.abandonedFlows = append(r.abandonedFlows, flow)
+
+	return nil
+}
+
+// AbandonedFlows returns the stored abandoned flows.
+func (r *Repository) AbandonedFlows() []models.AbandonedFlow {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]models.AbandonedFlow(nil), r.abandonedFlows...)
+}
+
+// GrantRole grants the role to the user and records it in the audit trail. It reports whether the user didn't have the role yet.
+func (r *Repository) GrantRole(role models.UserRole) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, granted := range r.roles {
+		if granted.TgID == role.TgID && granted.Role == role.Role && granted.ConferenceID == role.ConferenceID {
+			return false, nil
+		}
+	}
+
+	r.roles = append(r.roles, role)
+	r.roleAudit = append(r.roleAudit, models.RoleAudit{TgID: role.TgID, Role: role.Role, ConferenceID: role.ConferenceID,
+		Action: models.RoleGranted, By: role.GrantedBy, At: role.GrantedAt})
+
+	return true, nil
+}
+
+// RevokeRole revokes the role of the conference from the user and records it in the audit trail. It reports whether the user had the role.
+func (r *Repository) RevokeRole(tgID int, role string, conferenceID string, by int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, granted := range r.roles {
+		if granted.TgID == tgID && granted.Role == role && granted.ConferenceID == conferenceID {
+			r.roles = append(r.roles[:i], r.roles[i+1:]...)
+			r.roleAudit = append(r.roleAudit, models.RoleAudit{TgID: tgID, Role: role, ConferenceID: conferenceID,
+				Action: models.RoleRevoked, By: by, At: time.Now().UTC()})
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SelectUserRoles returns the roles of the user.
+func (r *Repository) SelectUserRoles(tgID int) ([]models.UserRole, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var roles []models.UserRole
+	for _, role := range r.roles {
+		if role.TgID == tgID {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, nil
+}
+
+// SelectRoles returns the owners and the roles granted for the conference in the order they were granted.
+func (r *Repository) SelectRoles(conferenceID string) ([]models.UserRole, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var roles []models.UserRole
+	for _, role := range r.roles {
+		if role.Role == models.RoleOwner || role.ConferenceID == conferenceID {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles, nil
+}
+
+// SelectRoleAudit returns the latest entries of the audit trail, the newest first.
+func (r *Repository) SelectRoleAudit(limit int) ([]models.RoleAudit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]models.RoleAudit, 0, min(limit, len(r.roleAudit)))
+	for i := len(r.roleAudit) - 1; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, r.roleAudit[i])
+	}
+
+	return entries, nil
+}
+
+// LinkSpeaker links the user to the report. It reports whether the user wasn't linked to it yet.
+func (r *Repository) LinkSpeaker(link models.SpeakerLink) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, linked := range r.speakerLinks {
+		if linked.TgID == link.TgID && linked.ConferenceID == link.ConferenceID && linked.URL == link.URL {
+			return false, nil
+		}
+	}
+
+	r.speakerLinks = append(r.speakerLinks, link)
+
+	return true, nil
+}
+
+// UnlinkSpeaker unlinks the user from the report of the conference. It reports whether the user was linked to it.
+func (r *Repository) UnlinkSpeaker(tgID int, conferenceID, url string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, linked := range r.speakerLinks {
+		if linked.TgID == tgID && linked.ConferenceID == conferenceID && linked.URL == url {
+			r.speakerLinks = append(r.speakerLinks[:i], r.speakerLinks[i+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SelectSpeakerLinks returns the links of the conference in the order they were made.
+func (r *Repository) SelectSpeakerLinks(conferenceID string) ([]models.SpeakerLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var links []models.SpeakerLink
+	for _, link := range r.speakerLinks {
+		if link.ConferenceID == conferenceID {
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// InsertQuestion inserts a new question and returns its ID.
+func (r *Repository) InsertQuestion(question models.Question) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	question.ID = strconv.Itoa(r.lastID)
+	r.questions = append(r.questions, question)
+
+	return question.ID, nil
+}
+
+// question returns a pointer to the stored question with the ID or nil. The caller should hold the lock.
+func (r *Repository) question(id string) *models.Question {
+	for i := range r.questions {
+		if r.questions[i].ID == id {
+			return &r.questions[i]
+		}
+	}
+	return nil
+}
+
+// SelectQuestion returns the question with the ID.
+func (r *Repository) SelectQuestion(id string) (models.Question, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	question := r.question(id)
+	if question == nil {
+		return models.Question{}, storage.ErrNotFound
+	}
+
+	return *question, nil
+}
+
+// SelectQuestions returns the questions of the conference in the order they were asked.
+func (r *Repository) SelectQuestions(conferenceID string) ([]models.Question, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var questions []models.Question
+	for _, question := range r.questions {
+		if question.ConferenceID == conferenceID {
+			questions = append(questions, question)
+		}
+	}
+
+	return questions, nil
+}
+
+// UpvoteQuestion adds the vote of the user to the question. It reports whether the user hadn't voted for it yet.
+func (r *Repository) UpvoteQuestion(id string, tgID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	question := r.question(id)
+	key := voteKey{tgID: tgID, id: id}
+	if question == nil || r.votes[key] {
+		return false, nil
+	}
+
+	r.votes[key] = true
+	question.Votes++
+
+	return true, nil
+}
+
+// SetQuestionAnswered marks the question as answered. It reports whether it wasn't answered yet.
+func (r *Repository) SetQuestionAnswered(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	question := r.question(id)
+	if question == nil || question.Answered {
+		return false, nil
+	}
+
+	question.Answered = true
+
+	return true, nil
+}
+
+// InsertPoll inserts a new poll and returns its ID.
+func (r *Repository) InsertPoll(poll models.Poll) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	poll.ID = strconv.Itoa(r.lastID)
+	poll.Options = append([]string(nil), poll.Options...)
+	poll.Counts = make([]int, len(poll.Options))
+	r.polls = append(r.polls, poll)
+
+	return poll.ID, nil
+}
+
+// poll returns a pointer to the stored poll with the ID or nil. The caller should hold the lock.
+func (r *Repository) poll(id string) *models.Poll {
+	for i := range r.polls {
+		if r.polls[i].ID == id {
+			return &r.polls[i]
+		}
+	}
+	return nil
+}
+
+// copyPoll returns a copy of the poll which doesn't share the options and the counts with the stored one.
+func copyPoll(poll models.Poll) models.Poll {
+	poll.Options = append([]string(nil), poll.Options...)
+	poll.Counts = append([]int(nil), poll.Counts...)
+	return poll
+}
+
+// SelectPoll returns the poll with the ID.
+func (r *Repository) SelectPoll(id string) (models.Poll, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	poll := r.poll(id)
+	if poll == nil {
+		return models.Poll{}, storage.ErrNotFound
+	}
+
+	return copyPoll(*poll), nil
+}
+
+// SelectPolls returns the polls of the conference in the order they were launched.
+func (r *Repository) SelectPolls(conferenceID string) ([]models.Poll, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var polls []models.Poll
+	for _, poll := range r.polls {
+		if poll.ConferenceID == conferenceID {
+			polls = append(polls, copyPoll(poll))
+		}
+	}
+
+	return polls, nil
+}
+
+// VotePoll adds the vote of the user for the option of an open poll. It reports whether the vote counted.
+func (r *Repository) VotePoll(id string, tgID int, option int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	poll := r.poll(id)
+	key := voteKey{tgID: tgID, id: id}
+	if poll == nil || poll.Closed || option < 0 || option >= len(poll.Options) || r.pollVotes[key] {
+		return false, nil
+	}
+
+	r.pollVotes[key] = true
+	poll.Counts[option]++
+
+	return true, nil
+}
+
+// ClosePoll closes the poll. It reports whether it was open.
+func (r *Repository) ClosePoll(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	poll := r.poll(id)
+	if poll == nil || poll.Closed {
+		return false, nil
+	}
+
+	poll.Closed = true
+
+	return true, nil
+}
+
+// AddReportView records that the user opened the card of the report of the conference, repeated views are recorded once.
+func (r *Repository) AddReportView(tgID int, conferenceID, url string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ref := models.ReportRef{ConferenceID: conferenceID, URL: url}
+	if !slices.Contains(r.views[ref], tgID) {
+		r.views[ref] = append(r.views[ref], tgID)
+	}
+
+	return nil
+}
+
+// SelectReportViewers returns the Telegram IDs of the users who opened the card of the report of the conference
+// in the order they opened it.
+func (r *Repository) SelectReportViewers(conferenceID, url string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]int(nil), r.views[models.ReportRef{ConferenceID: conferenceID, URL: url}]...), nil
+}
+
+// SelectConferenceViewers returns the Telegram IDs of the users who opened the card of any report of the conference.
+func (r *Repository) SelectConferenceViewers(conferenceID string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var viewers []int
+	for ref, tgIDs := range r.views {
+		if ref.ConferenceID != conferenceID {
+			continue
+		}
+		for _, tgID := range tgIDs {
+			if !slices.Contains(viewers, tgID) {
+				viewers = append(viewers, tgID)
+			}
+		}
+	}
+
+	return viewers, nil
+}
+
+// SaveQuestionnaire inserts the questionnaire or replaces the one of the same conference and track.
+func (r *Repository) SaveQuestionnaire(questionnaire models.Questionnaire) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	questionnaire.Items = copyItems(questionnaire.Items)
+
+	for i, stored := range r.questionnaires {
+		if stored.ConferenceID == questionnaire.ConferenceID && stored.Track == questionnaire.Track {
+			r.questionnaires[i] = questionnaire
+			return nil
+		}
+	}
+
+	r.questionnaires = append(r.questionnaires, questionnaire)
+
+	return nil
+}
+
+// SelectQuestionnaires returns the questionnaires of the conference ordered by their tracks.
+func (r *Repository) SelectQuestionnaires(conferenceID string) ([]models.Questionnaire, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var questionnaires []models.Questionnaire
+	for _, questionnaire := range r.questionnaires {
+		if questionnaire.ConferenceID == conferenceID {
+			questionnaire.Items = copyItems(questionnaire.Items)
+			questionnaires = append(questionnaires, questionnaire)
+		}
+	}
+
+	sort.Slice(questionnaires, func(i, j int) bool { return questionnaires[i].Track < questionnaires[j].Track })
+
+	return questionnaires, nil
+}
+
+// DeleteQuestionnaire deletes the questionnaire of the conference and track. It reports whether it existed.
+func (r *Repository) DeleteQuestionnaire(conferenceID string, track string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, stored := range r.questionnaires {
+		if stored.ConferenceID == conferenceID && stored.Track == track {
+			r.questionnaires = slices.Delete(r.questionnaires, i, i+1)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// InsertSurvey inserts the answers of the user. It reports whether the user hadn't answered the survey of the conference yet.
+func (r *Repository) InsertSurvey(survey models.Survey) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.surveys {
+		if stored.ConferenceID == survey.ConferenceID && stored.TgID == survey.TgID {
+			return false, nil
+		}
+	}
+
+	r.surveys = append(r.surveys, survey)
+
+	return true, nil
+}
+
+// SelectSurvey returns the answers of the user to the survey of the conference and reports whether they exist.
+func (r *Repository) SelectSurvey(tgID int, conferenceID string) (bool, models.Survey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, survey := range r.surveys {
+		if survey.ConferenceID == conferenceID && survey.TgID == tgID {
+			return true, survey, nil
+		}
+	}
+
+	return false, models.Survey{}, nil
+}
+
+// SelectSurveys returns the answers to the survey of the conference in the order they were given.
+func (r *Repository) SelectSurveys(conferenceID string) ([]models.Survey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var surveys []models.Survey
+	for _, survey := range r.surveys {
+		if survey.ConferenceID == conferenceID {
+			surveys = append(surveys, survey)
+		}
+	}
+
+	return surveys, nil
+}
+
+// MarkSurveyInvited records that the user was invited to the survey of the conference at invitedAt.
+// It reports whether the user hadn't been invited yet.
+func (r *Repository) MarkSurveyInvited(tgID int, conferenceID string, invitedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := voteKey{tgID: tgID, id: conferenceID}
+	if _, invited := r.surveyInvites[key]; invited {
+		return false, nil
+	}
+
+	r.surveyInvites[key] = invitedAt
+
+	return true, nil
+}
+
+// SelectSurveyInvites returns the Telegram IDs of the users invited to the survey of the conference.
+func (r *Repository) SelectSurveyInvites(conferenceID string) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var invited []int
+	for key := range r.surveyInvites {
+		if key.id == conferenceID {
+			invited = append(invited, key.tgID)
+		}
+	}
+
+	return invited, nil
+}
+
+// user returns a pointer to the stored user with the Telegram ID or nil. The caller should hold the lock.
+func (r *Repository) user(tgID int) *models.User {
+	for i := range r.users {
+		if r.users[i].TgID == tgID {
+			return &r.users[i]
+		}
+	}
+	return nil
+}
+
+// copyEvaluation returns a copy of the evaluation which doesn't share the answers with the original.
+func copyEvaluation(evaluation models.Evaluation) models.Evaluation {
+	evaluation.Answers = maps.Clone(evaluation.Answers)
+	return evaluation
+}
+
+// copyItems returns a copy of the questionnaire items which don't share the options with the originals.
+func copyItems(items []models.QuestionnaireItem) []models.QuestionnaireItem {
+	copied := make([]models.QuestionnaireItem, len(items))
+	for i, item := range items {
+		item.Options = append([]string(nil), item.Options...)
+		copied[i] = item
+	}
+	return copied
+}
+
+// copyUser returns a copy of the user which doesn't share the favorites with the original.
+func copyUser(user models.User) models.User {
+	user.Favorites = append([]models.ReportRef(nil), user.Favorites...)
+	return user
+}
+
+// without returns the references without the given one.
+func without(refs []models.ReportRef, ref models.ReportRef) []models.ReportRef {
+	filtered := refs[:0]
+	for _, r := range refs {
+		if r != ref {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
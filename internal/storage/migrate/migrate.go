@@ -0,0 +1,102 @@
+// Package migrate runs the versioned migrations of a database.
+// A migration is applied once: the database records the applied versions, so only the pending ones run on start.
+package migrate
+
+import (
+	"fmt"
+	"time"
+)
+
+// Migration is a versioned change of the database.
+type Migration struct {
+	Version int    // Version orders the migrations, it is never reused.
+	Name    string // Name describes the change.
+}
+
+// Status is a migration with the time it was applied at.
+type Status struct {
+	Migration
+	Applied   bool      // Applied reports whether the migration is applied.
+	AppliedAt time.Time // AppliedAt is the time the migration was applied at, zero if it is pending.
+}
+
+// Migrator is a database with versioned migrations.
+type Migrator interface {
+	// Migrations returns the migrations known to the binary ordered by version.
+	Migrations() []Migration
+	// Applied returns the application times of the applied migrations by version.
+	Applied() (map[int]time.Time, error)
+	// Apply applies the migration with the version and records it.
+	Apply(version int) error
+}
+
+// Statuses returns the statuses of the known migrations ordered by version.
+func Statuses(m Migrator) ([]Status, error) {
+	migrations := m.Migrations()
+
+	if err := validate(migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	known := make(map[int]bool, len(migrations))
+
+	for _, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+		known[migration.Version] = true
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return statuses, fmt.Errorf("migration %d is applied but unknown to this version of the bot", version)
+		}
+	}
+
+	return statuses, nil
+}
+
+// Up applies the pending migrations in order and returns them.
+// In dry-run mode nothing is applied and the migrations which would be applied are returned.
+// Up stops at the first failed migration, the ones before it stay applied.
+func Up(m Migrator, dryRun bool) ([]Migration, error) {
+	statuses, err := Statuses(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+
+		if !dryRun {
+			if err = m.Apply(status.Version); err != nil {
+				return pending, fmt.Errorf("failed to apply migration %d (%s): %w", status.Version, status.Name, err)
+			}
+		}
+
+		pending = append(pending, status.Migration)
+	}
+
+	return pending, nil
+}
+
+// validate checks that the versions of the migrations are positive and strictly increasing.
+func validate(migrations []Migration) error {
+	previous := 0
+	for _, migration := range migrations {
+		if migration.Version <= previous {
+			return fmt.Errorf("migration %d (%s) is out of order", migration.Version, migration.Name)
+		}
+		previous = migration.Version
+	}
+	return nil
+}
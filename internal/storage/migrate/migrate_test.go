@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// migrator is an in-memory database with versioned migrations.
+type migrator struct {
+	migrations []Migration
+	applied    map[int]time.Time
+	fail       int // fail is the version whose application fails.
+}
+
+func (m *migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+func (m *migrator) Applied() (map[int]time.Time, error) {
+	return m.applied, nil
+}
+
+func (m *migrator) Apply(version int) error {
+	if version == m.fail {
+		return errors.New("syntax error")
+	}
+	m.applied[version] = time.Now()
+	return nil
+}
+
+func TestUp(t *testing.T) {
+	migrations := []Migration{{1, "init"}, {2, "roles"}, {3, "polls"}}
+
+	tests := []struct {
+		name        string
+		migrations  []Migration
+		applied     []int
+		fail        int
+		dryRun      bool
+		wantPending []Migration
+		wantApplied []int
+		wantErr     bool
+	}{
+		{
+			name:        "fresh database",
+			migrations:  migrations,
+			wantPending: migrations,
+			wantApplied: []int{1, 2, 3},
+		},
+		{
+			name:        "pending migrations",
+			migrations:  migrations,
+			applied:     []int{1},
+			wantPending: migrations[1:],
+			wantApplied: []int{1, 2, 3},
+		},
+		{
+			name:        "up to date",
+			migrations:  migrations,
+			applied:     []int{1, 2, 3},
+			wantApplied: []int{1, 2, 3},
+		},
+		{
+			name:        "dry run applies nothing",
+			migrations:  migrations,
+			applied:     []int{1},
+			dryRun:      true,
+			wantPending: migrations[1:],
+			wantApplied: []int{1},
+		},
+		{
+			name:        "stops at the failed migration",
+			migrations:  migrations,
+			fail:        3,
+			wantPending: migrations[:2],
+			wantApplied: []int{1, 2},
+			wantErr:     true,
+		},
+		{
+			name:        "dry run doesn't fail",
+			migrations:  migrations,
+			fail:        3,
+			dryRun:      true,
+			wantPending: migrations,
+		},
+		{
+			name:        "unknown applied migration",
+			migrations:  migrations[:2],
+			applied:     []int{1, 2, 3},
+			wantApplied: []int{1, 2, 3},
+			wantErr:     true,
+		},
+		{
+			name:       "out of order",
+			migrations: []Migration{{2, "roles"}, {1, "init"}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &migrator{migrations: tt.migrations, applied: make(map[int]time.Time), fail: tt.fail}
+			for _, version := range tt.applied {
+				m.applied[version] = time.Now()
+			}
+
+			pending, err := Up(m, tt.dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Up() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(pending, tt.wantPending) {
+				t.Errorf("Up() = %v, want %v", pending, tt.wantPending)
+			}
+
+			for _, version := range tt.wantApplied {
+				if _, ok := m.applied[version]; !ok {
+					t.Errorf("migration %d is not applied", version)
+				}
+			}
+			if len(m.applied) != len(tt.wantApplied) {
+				t.Errorf("%d migrations applied, want %d", len(m.applied), len(tt.wantApplied))
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/migrate"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// migration is a versioned change of the documents or indexes.
+// MongoDB has no transactions on a standalone server, so a migration should be safe to run again if it failed halfway.
+type migration struct {
+	version int
+	name    string
+	up      func(c *Client) error
+}
+
+// migrations are the changes in the order they are applied. Applied migrations should never be edited, add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create unique indexes of users and evaluations",
+		up: func(c *Client) error {
+			if err := c.ensureUserTgIDUnique(); err != nil {
+				return err
+			}
+			return c.ensureEvaluationTgIDAndURLUnique()
+		},
+	},
+	{
+		version: 2,
+		name:    "store favorite reports as references",
+		up:      (*Client).convertFavoriteReports,
+	},
+	{
+		version: 3,
+		name:    "assign reports and announcements to the default conference",
+		up: func(c *Client) error {
+			filter := bson.M{"conferenceID": bson.M{"$exists": false}}
+			update := bson.M{"$set": bson.M{"conferenceID": models.DefaultConferenceID}}
+			for _, collection := range []string{"report", "announcement"} {
+				if _, err := c.collection(collection).UpdateMany(ctx, filter, update); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 4,
+		name:    "identify reports by their conference and URL",
+		up:      (*Client).scopeReportsByConference,
+	},
+	{
+		version: 5,
+		name:    "create the unique index of roles and make the conference creators organizers",
+		up:      (*Client).convertConferenceAdmins,
+	},
+	{
+		version: 6,
+		name:    "create the unique index of speaker links",
+		up: func(c *Client) error {
+			indexModel := mongo.IndexModel{
+				Keys:    bson.D{{Key: "tgID", Value: 1}, {Key: "conferenceID", Value: 1}, {Key: "url", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}
+			_, err := c.collection("speaker").Indexes().CreateOne(ctx, indexModel)
+			return err
+		},
+	},
+	{
+		version: 7,
+		name:    "create the index of questions by conference",
+		up: func(c *Client) error {
+			indexModel := mongo.IndexModel{Keys: bson.D{{Key: "conferenceID", Value: 1}, {Key: "askedAt", Value: 1}}}
+			_, err := c.collection("question").Indexes().CreateOne(ctx, indexModel)
+			return err
+		},
+	},
+	{
+		version: 8,
+		name:    "create the indexes of polls and report views",
+		up: func(c *Client) error {
+			pollIndex := mongo.IndexModel{Keys: bson.D{{Key: "conferenceID", Value: 1}, {Key: "createdAt", Value: 1}}}
+			if _, err := c.collection("poll").Indexes().CreateOne(ctx, pollIndex); err != nil {
+				return err
+			}
+			viewIndex := mongo.IndexModel{
+				Keys:    bson.D{{Key: "tgID", Value: 1}, {Key: "conferenceID", Value: 1}, {Key: "url", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}
+			_, err := c.collection("reportView").Indexes().CreateOne(ctx, viewIndex)
+			return err
+		},
+	},
+	{
+		version: 9,
+		name:    "create the unique index of questionnaires",
+		up: func(c *Client) error {
+			index := mongo.IndexModel{
+				Keys:    bson.D{{Key: "conferenceID", Value: 1}, {Key: "track", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}
+			_, err := c.collection("questionnaire").Indexes().CreateOne(ctx, index)
+			return err
+		},
+	},
+	{
+		version: 10,
+		name:    "create the unique index of conference surveys",
+		up: func(c *Client) error {
+			index := mongo.IndexModel{
+				Keys:    bson.D{{Key: "conferenceID", Value: 1}, {Key: "tgID", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}
+			_, err := c.collection("survey").Indexes().CreateOne(ctx, index)
+			return err
+		},
+	},
+	{
+		version: 11,
+		name:    "create the unique index of conference survey invites",
+		up: func(c *Client) error {
+			index := mongo.IndexModel{
+				Keys:    bson.D{{Key: "conferenceID", Value: 1}, {Key: "tgID", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			}
+			_, err := c.collection("surveyInvite").Indexes().CreateOne(ctx, index)
+			return err
+		},
+	},
+}
+
+// appliedMigration is a record of an applied migration in the migration collection.
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// Client implements migrate.Migrator.
+var _ migrate.Migrator = (*Client)(nil)
+
+// Migrations returns the migrations ordered by version.
+func (c *Client) Migrations() []migrate.Migration {
+	list := make([]migrate.Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, migrate.Migration{Version: m.version, Name: m.name})
+	}
+	return list
+}
+
+// Applied returns the application times of the migrations recorded in the migration collection.
+func (c *Client) Applied() (map[int]time.Time, error) {
+	cursor, err := c.collection("migration").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []appliedMigration
+
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Version] = record.AppliedAt.UTC()
+	}
+
+	return applied, nil
+}
+
+// Apply applies the migration with the version and records it in the migration collection.
+func (c *Client) Apply(version int) error {
+	for _, m := range migrations {
+		if m.version != version {
+			continue
+		}
+
+		if err := m.up(c); err != nil {
+			return err
+		}
+
+		return c.insertOne("migration", appliedMigration{Version: m.version, Name: m.name, AppliedAt: time.Now().UTC()})
+	}
+
+	return fmt.Errorf("unknown migration %d", version)
+}
+
+// ensureUserTgIDUnique ensures that the user ID is unique in the database.
+func (c *Client) ensureUserTgIDUnique() error {
+	coll := c.collection("user")
+	indexModel := mongo.IndexModel{
+		Keys:    bson.M{"tgID": 1},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err := coll.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
+
+// ensureEvaluationTgIDAndURLUnique ensures that the combination of user ID and URL is unique in the database.
+func (c *Client) ensureEvaluationTgIDAndURLUnique() error {
+	coll := c.collection("evaluation")
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tgID", Value: 1},
+			{Key: "url", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err := coll.Indexes().CreateOne(ctx, indexModel)
+	return err
+}
+
+// convertFavoriteReports replaces the report copies embedded in favoriteReports of the users with the report URLs
+// in favoriteURLs, keeping their order. Users converted by an interrupted run already have no favoriteReports.
+func (c *Client) convertFavoriteReports() error {
+	coll := c.collection("user")
+
+	cursor, err := coll.Find(ctx, bson.M{"favoriteReports": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	var users []struct {
+		TgID            int      `bson:"tgID"`
+		FavoriteURLs    []string `bson:"favoriteURLs"`
+		FavoriteReports []struct {
+			URL string `bson:"url"`
+		} `bson:"favoriteReports"`
+	}
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		urls := make([]string, 0, len(user.FavoriteURLs)+len(user.FavoriteReports))
+		seen := make(map[string]bool, cap(urls))
+
+		for _, url := range user.FavoriteURLs {
+			if !seen[url] {
+				seen[url] = true
+				urls = append(urls, url)
+			}
+		}
+
+		for _, report := range user.FavoriteReports {
+			if !seen[report.URL] {
+				seen[report.URL] = true
+				urls = append(urls, report.URL)
+			}
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"favoriteURLs": urls},
+			"$unset": bson.M{"favoriteReports": ""},
+		}
+		if _, err = coll.UpdateOne(ctx, bson.M{"tgID": user.TgID}, update); err != nil {
+			return fmt.Errorf("failed to convert favorites of user %d: %w", user.TgID, err)
+		}
+	}
+
+	return nil
+}
+
+// scopeReportsByConference creates the unique index of the reports by their conference and URL, assigns the evaluations
+// and the favorites to the conferences of their reports and makes the unique index of the evaluations include the conference.
+// Before this migration a URL was unique among all reports, so it identifies the conference. Documents converted by an
+// interrupted run already have the conference.
+func (c *Client) scopeReportsByConference() error {
+	reportIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "conferenceID", Value: 1}, {Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := c.collection("report").Indexes().CreateOne(ctx, reportIndex); err != nil {
+		return err
+	}
+
+	reports, err := c.SelectReports("")
+	if err != nil {
+		return err
+	}
+
+	conferenceOf := make(map[string]string, len(reports))
+	for _, report := range reports {
+		conferenceOf[report.URL] = report.ConferenceID
+	}
+
+	conference := func(url string) string {
+		if id, exists := conferenceOf[url]; exists {
+			return id
+		}
+		return models.DefaultConferenceID
+	}
+
+	evaluations := c.collection("evaluation")
+
+	urls, err := evaluations.Distinct(ctx, "url", bson.M{"conferenceID": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+
+	for _, url := range urls {
+		filter := bson.M{"url": url, "conferenceID": bson.M{"$exists": false}}
+		if _, err = evaluations.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"conferenceID": conference(fmt.Sprint(url))}}); err != nil {
+			return err
+		}
+	}
+
+	if err = dropIndex(evaluations, "tgID_1_url_1"); err != nil {
+		return err
+	}
+
+	evaluationIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "tgID", Value: 1}, {Key: "conferenceID", Value: 1}, {Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err = evaluations.Indexes().CreateOne(ctx, evaluationIndex); err != nil {
+		return err
+	}
+
+	coll := c.collection("user")
+
+	cursor, err := coll.Find(ctx, bson.M{"favoriteURLs": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+
+	var users []struct {
+		TgID         int      `bson:"tgID"`
+		FavoriteURLs []string `bson:"favoriteURLs"`
+	}
+
+	if err = cursor.All(ctx, &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		favorites := make([]models.ReportRef, 0, len(user.FavoriteURLs))
+		for _, url := range user.FavoriteURLs {
+			favorites = append(favorites, models.ReportRef{ConferenceID: conference(url), URL: url})
+		}
+
+		update := bson.M{
+			"$set":   bson.M{"favorites": favorites},
+			"$unset": bson.M{"favoriteURLs": ""},
+		}
+		if _, err = coll.UpdateOne(ctx, bson.M{"tgID": user.TgID}, update); err != nil {
+			return fmt.Errorf("failed to convert favorites of user %d: %w", user.TgID, err)
+		}
+	}
+
+	return nil
+}
+
+// dropIndex drops the index of the collection with the name, a missing index or collection has nothing to drop.
+func dropIndex(coll *mongo.Collection, name string) error {
+	_, err := coll.Indexes().DropOne(ctx, name)
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Name == "IndexNotFound" || commandErr.Name == "NamespaceNotFound") {
+		return nil
+	}
+
+	return err
+}
+
+// convertConferenceAdmins creates the unique index of the roles, grants the organizer role to the creators of the conferences
+// and removes the admins of the conferences, which are replaced by the roles. Roles granted by an interrupted run are kept.
+func (c *Client) convertConferenceAdmins() error {
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tgID", Value: 1},
+			{Key: "role", Value: 1},
+			{Key: "conferenceID", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err := c.collection("role").Indexes().CreateOne(ctx, indexModel); err != nil {
+		return err
+	}
+
+	conferences, err := c.SelectConferences()
+	if err != nil {
+		return err
+	}
+
+	for _, conference := range conferences {
+		if conference.CreatedBy == 0 {
+			continue
+		}
+		role := models.UserRole{TgID: conference.CreatedBy, Role: models.RoleOrganizer, ConferenceID: conference.ID,
+			GrantedBy: conference.CreatedBy, GrantedAt: time.Now().UTC()}
+		if _, err = c.GrantRole(role); err != nil {
+			return fmt.Errorf("failed to grant organizer of conference %s: %w", conference.ID, err)
+		}
+	}
+
+	_, err = c.collection("conference").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"admins": ""}})
+	return err
+}
@@ -6,61 +6,33 @@ import (
 	"errors"
 	"fmt"
 	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 )
 
 // ctx is a global context used for MongoDB operations.
 var ctx context.Context
 
-// Client is a struct that wraps a MongoDB client.
+// Client is a struct that wraps a MongoDB client and the name of the database.
 type Client struct {
-	mongo *mongo.Client
+	mongo    *mongo.Client
+	database string
 }
 
-// DataManipulator is an interface that defines methods for manipulating data in the database.
-type DataManipulator interface {
-	ReportManipulator
-	UserManipulator
-	EvaluationManipulator
-	Init(context context.Context) error
-	Collection(collection string) *mongo.Collection
-	InsertOne(coll *mongo.Collection, data interface{}) error
-}
-
-// ReportManipulator is an interface that defines methods for manipulating report data.
-type ReportManipulator interface {
-	InsertMany(coll *mongo.Collection, data []interface{}) (bool, bool, error)
-	SelectReport(coll *mongo.Collection, url string) (models.Report, error)
-	SelectReports(coll *mongo.Collection) ([]models.Report, error)
-}
-
-// UserManipulator is an interface that defines methods for manipulating user data.
-type UserManipulator interface {
-	SelectUser(coll *mongo.Collection, tgID int) (models.User, error)
-	SelectUsers(coll *mongo.Collection) ([]models.User, error)
-	UpdateUserID(coll *mongo.Collection, tgID int, identification string) (bool, error)
-	AddUserFavReports(coll *mongo.Collection, tgID int, report models.Report) error
-	RemoveUserFavReport(coll *mongo.Collection, tgID int, reportURL string) error
-}
-
-// EvaluationManipulator is an interface that defines methods for manipulating evaluation data.
-type EvaluationManipulator interface {
-	SelectEvaluation(coll *mongo.Collection, tgID int, url string) (bool, models.Evaluation, error)
-	SelectEvaluations(coll *mongo.Collection, tgID int) ([]models.Evaluation, error)
-	SelectAllEvaluations(coll *mongo.Collection) ([]models.Evaluation, error)
-	UpdateEvaluation(coll *mongo.Collection, tgID int, url string, evaluation models.Evaluation) (bool, error)
-	DeleteEvaluation(coll *mongo.Collection, tgID int, url string) (bool, error)
-}
+// Client implements storage.Repository.
+var _ storage.Repository = (*Client)(nil)
 
-// New creates a new MongoDB client and returns it.
-func New(host string, port int, user, password string) (*Client, error) {
+// New creates a new MongoDB client working with the given database and returns it.
+func New(host string, port int, user, password, database string) (*Client, error) {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s@%s:%v", user, password, host, port)))
 	if err != nil {
 		return nil, err
 	}
-	return &Client{mongo: client}, nil
+	return &Client{mongo: client, database: database}, nil
 }
 
 // Close disconnects the MongoDB client.
@@ -68,115 +40,107 @@ func (c *Client) Close() error {
 	return c.mongo.Disconnect(ctx)
 }
 
-// Init initializes the MongoDB client with a given context and ensures uniqueness of user IDs and evaluations.
+// Init sets the context of the MongoDB operations. The indexes are created by applying the migrations with migrate.Up.
 func (c *Client) Init(context context.Context) error {
 	ctx = context
-	if err := c.ensureUserTgIDUnique(); err != nil {
-		return err
-	}
-	return c.ensureEvaluationTgIDAndURLUnique()
+	return nil
 }
 
-// ensureUserTgIDUnique ensures that the user ID is unique in the database.
-func (c *Client) ensureUserTgIDUnique() error {
-	coll := c.Collection("user")
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"tgID": 1},
-		Options: options.Index().SetUnique(true),
-	}
-	_, err := coll.Indexes().CreateOne(ctx, indexModel)
-	if err != nil {
-		return err
-	}
+// collection returns a MongoDB collection with the given name.
+func (c *Client) collection(collection string) *mongo.Collection {
+	return c.mongo.Database(c.database).Collection(collection)
+}
+
+// SaveConference inserts the conference into the conference collection or replaces the one with the same ID.
+func (c *Client) SaveConference(conference models.Conference) error {
+	coll := c.collection("conference")
+
+	_, err := coll.ReplaceOne(ctx, bson.M{"_id": conference.ID}, conference, options.Replace().SetUpsert(true))
 	return err
 }
 
-// ensureEvaluationTgIDAndURLUnique ensures that the combination of user ID and URL is unique in the database.
-func (c *Client) ensureEvaluationTgIDAndURLUnique() error {
-	coll := c.Collection("evaluation")
-	indexModel := mongo.IndexModel{
-		Keys: bson.D{
-			{Key: "tgID", Value: 1},
-			{Key: "url", Value: 1},
-		},
-		Options: options.Index().SetUnique(true),
-	}
-	_, err := coll.Indexes().CreateOne(ctx, indexModel)
+// SelectConference selects a conference from a collection by its ID.
+func (c *Client) SelectConference(id string) (models.Conference, error) {
+	coll := c.collection("conference")
+
+	var conference models.Conference
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&conference)
 	if err != nil {
-		return err
+		return models.Conference{}, notFound(err)
 	}
-	return err
+	return conference, nil
 }
 
-// Collection returns a MongoDB collection with the given name.
-func (c *Client) Collection(collection string) *mongo.Collection {
-	return c.mongo.Database("tg-bot").Collection(collection)
-}
+// SelectConferences selects all conferences from a collection, ordered by their start time.
+func (c *Client) SelectConferences() ([]models.Conference, error) {
+	coll := c.collection("conference")
 
-// InsertMany inserts multiple documents into a collection.
-func (c *Client) InsertMany(coll *mongo.Collection, data []interface{}) (bool, bool, error) {
-	switch coll.Name() {
-	case "report":
-		existingURLS := make([]string, len(data), len(data))
-		for ind, report := range data {
-			existingURLS[ind] = report.(models.Report).URL
-		}
-		isUpdated, err := updateReports(coll, data)
-		if err != nil {
-			return false, false, err
-		}
-		isDeleted, err := deleteReports(coll, existingURLS)
-		if err != nil {
-			return false, false, err
-		}
-		return isUpdated, isDeleted, nil
-	default:
-		_, err := coll.InsertMany(ctx, data)
-		if err != nil {
-			return false, false, err
-		}
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"timeFrom": 1}))
+	if err != nil {
+		return nil, err
 	}
-	return false, false, nil
+
+	var conferences []models.Conference
+
+	if err = cursor.All(ctx, &conferences); err != nil {
+		return nil, err
+	}
+
+	return conferences, nil
 }
 
-// updateReports updates existing reports in the database.
-func updateReports(coll *mongo.Collection, data []interface{}) (bool, error) {
-	for _, report := range data {
-		filter := bson.M{"url": report.(models.Report).URL}
+// UpdateReports replaces the schedule of the conference stored in the report collection with the given reports.
+// It returns the changes of the previously scheduled reports: moved, retitled and cancelled ones.
+func (c *Client) UpdateReports(conferenceID string, reports []models.Report) ([]models.ReportChange, error) {
+	coll := c.collection("report")
+
+	existing, err := c.SelectReports(conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := storage.DiffReports(existing, reports)
+
+	urls := make([]string, 0, len(reports))
+
+	for _, report := range reports {
+		urls = append(urls, report.URL)
+
+		filter := bson.M{"conferenceID": conferenceID, "url": report.URL}
 		update := bson.M{
 			"$set": bson.M{
-				"title":     report.(models.Report).Title,
-				"startTime": report.(models.Report).StartTime,
-				"duration":  report.(models.Report).Duration,
-				"speakers":  report.(models.Report).Speakers,
+				"title":     report.Title,
+				"startTime": report.StartTime,
+				"duration":  report.Duration,
+				"speakers":  report.Speakers,
+				"room":      report.Room,
 			},
 		}
 		opts := options.Update().SetUpsert(true)
-		_, err := coll.UpdateOne(ctx, filter, update, opts)
-		if err != nil {
-			return false, err
+		if _, err = coll.UpdateOne(ctx, filter, update, opts); err != nil {
+			return nil, err
 		}
 	}
-	return true, nil
-}
 
-func deleteReports(coll *mongo.Collection, existingURLS []string) (bool, error) {
-	if len(existingURLS) != 0 {
-		filter := bson.M{"url": bson.M{"$nin": existingURLS}}
-		amount, err := coll.DeleteMany(ctx, filter)
-		if err != nil {
-			return false, fmt.Errorf("failed to delete reports: %w", err)
-		}
-		if amount.DeletedCount > 0 {
-			return true, nil
+	if len(urls) != 0 {
+		if _, err = coll.DeleteMany(ctx, bson.M{"conferenceID": conferenceID, "url": bson.M{"$nin": urls}}); err != nil {
+			return nil, fmt.Errorf("failed to delete reports: %w", err)
 		}
 	}
-	return false, nil
+
+	return changes, nil
 }
 
-// SelectReports selects all reports from a collection.
-func (c *Client) SelectReports(coll *mongo.Collection) ([]models.Report, error) {
-	cursor, err := coll.Find(ctx, bson.M{})
+// SelectReports selects the reports of the conference or of all conferences if conferenceID is empty from a collection.
+func (c *Client) SelectReports(conferenceID string) ([]models.Report, error) {
+	coll := c.collection("report")
+
+	filter := bson.M{}
+	if conferenceID != "" {
+		filter["conferenceID"] = conferenceID
+	}
+
+	cursor, err := coll.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -190,9 +154,9 @@ func (c *Client) SelectReports(coll *mongo.Collection) ([]models.Report, error)
 	return data, nil
 }
 
-// InsertOne inserts a single document into a collection.
-func (c *Client) InsertOne(coll *mongo.Collection, data interface{}) error {
-	_, err := coll.InsertOne(ctx, data)
+// insertOne inserts a single document into a collection, duplicates of unique fields are ignored.
+func (c *Client) insertOne(collection string, data interface{}) error {
+	_, err := c.collection(collection).InsertOne(ctx, data)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
 			return nil
@@ -202,19 +166,69 @@ func (c *Client) InsertOne(coll *mongo.Collection, data interface{}) error {
 	return nil
 }
 
+// InsertUser inserts a new user into the user collection.
+func (c *Client) InsertUser(user models.User) error {
+	return c.insertOne("user", user)
+}
+
+// InsertEvaluation inserts a new evaluation into the evaluation collection.
+func (c *Client) InsertEvaluation(evaluation models.Evaluation) error {
+	return c.insertOne("evaluation", evaluation)
+}
+
+// InsertDeadLetter inserts an undelivered message into the deadLetter collection.
+func (c *Client) InsertDeadLetter(letter models.DeadLetter) error {
+	return c.insertOne("deadLetter", letter)
+}
+
+// InsertAbandonedFlow inserts an abandoned flow into the abandonedFlow collection.
+func (c *Client) InsertAbandonedFlow(flow models.AbandonedFlow) error {
+	return c.insertOne("abandonedFlow", flow)
+}
+
+// notFound converts the error of a missing document to storage.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
 // SelectUser selects a user from a collection by their Telegram ID.
-func (c *Client) SelectUser(coll *mongo.Collection, tgID int) (models.User, error) {
+func (c *Client) SelectUser(tgID int) (models.User, error) {
+	coll := c.collection("user")
+
 	var user models.User
 	filter := bson.D{{"tgID", tgID}}
 	err := coll.FindOne(ctx, filter).Decode(&user)
 	if err != nil {
+		return models.User{}, notFound(err)
+	}
+
+	users := []models.User{user}
+	if err = c.resolveFavorites(users); err != nil {
 		return models.User{}, err
 	}
-	return user, nil
+
+	return users[0], nil
+}
+
+// resolveFavorites fills the favorite reports of the users from the report collection.
+func (c *Client) resolveFavorites(users []models.User) error {
+	reports, err := c.SelectReports("")
+	if err != nil {
+		return err
+	}
+
+	storage.ResolveFavorites(users, reports)
+
+	return nil
 }
 
 // UpdateUserID updates a user's identification in the database.
-func (c *Client) UpdateUserID(coll *mongo.Collection, tgID int, identification string) (bool, error) {
+func (c *Client) UpdateUserID(tgID int, identification string) (bool, error) {
+	coll := c.collection("user")
+
 	filter := bson.M{"tgID": tgID}
 	update := bson.M{"$set": bson.M{
 		"identification": identification,
@@ -227,12 +241,36 @@ func (c *Client) UpdateUserID(coll *mongo.Collection, tgID int, identification s
 	return true, nil
 }
 
-// AddUserFavReports adds a report to a user's list of favorite reports.
-func (c *Client) AddUserFavReports(coll *mongo.Collection, tgID int, report models.Report) error {
+// SelectUserConference selects the conference the user picked.
+func (c *Client) SelectUserConference(tgID int) (string, error) {
+	coll := c.collection("user")
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"conferenceID": 1})
+	err := coll.FindOne(ctx, bson.M{"tgID": tgID}, opts).Decode(&user)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return user.ActiveConference(), nil
+}
+
+// SetUserConference sets the conference the user picked.
+func (c *Client) SetUserConference(tgID int, conferenceID string) error {
+	coll := c.collection("user")
+
+	_, err := coll.UpdateOne(ctx, bson.M{"tgID": tgID}, bson.M{"$set": bson.M{"conferenceID": conferenceID}})
+	return err
+}
+
+// AddUserFavReport adds a report of the conference to a user's list of favorite reports.
+func (c *Client) AddUserFavReport(tgID int, conferenceID, reportURL string) error {
+	coll := c.collection("user")
+
 	filter := bson.M{"tgID": tgID}
 	update := bson.M{
 		"$addToSet": bson.M{
-			"favoriteReports": report,
+			"favorites": models.ReportRef{ConferenceID: conferenceID, URL: reportURL},
 		},
 	}
 	_, err := coll.UpdateOne(ctx, filter, update)
@@ -242,10 +280,13 @@ func (c *Client) AddUserFavReports(coll *mongo.Collection, tgID int, report mode
 	return nil
 }
 
-func (c *Client) RemoveUserFavReport(coll *mongo.Collection, tgID int, reportURL string) error {
+// RemoveUserFavReport removes a report of the conference from a user's list of favorite reports.
+func (c *Client) RemoveUserFavReport(tgID int, conferenceID, reportURL string) error {
+	coll := c.collection("user")
+
 	filter := bson.M{"tgID": tgID}
 	update := bson.M{"$pull": bson.M{
-		"favoriteReports": bson.M{"url": reportURL},
+		"favorites": bson.M{"conferenceID": conferenceID, "url": reportURL},
 	}}
 	_, err := coll.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -254,7 +295,23 @@ func (c *Client) RemoveUserFavReport(coll *mongo.Collection, tgID int, reportURL
 	return nil
 }
 
-func (c *Client) SelectUsers(coll *mongo.Collection) ([]models.User, error) {
+// RemoveFavReportFromAll removes a report of the conference from the favorite reports of every user.
+func (c *Client) RemoveFavReportFromAll(conferenceID, reportURL string) error {
+	coll := c.collection("user")
+
+	update := bson.M{"$pull": bson.M{
+		"favorites": bson.M{"conferenceID": conferenceID, "url": reportURL},
+	}}
+	_, err := coll.UpdateMany(ctx, bson.M{}, update)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SelectUsers selects all users from a collection.
+func (c *Client) SelectUsers() ([]models.User, error) {
+	coll := c.collection("user")
 
 	cursor, err := coll.Find(ctx, bson.M{})
 
@@ -264,32 +321,41 @@ func (c *Client) SelectUsers(coll *mongo.Collection) ([]models.User, error) {
 
 	var users []models.User
 
-	if err := cursor.All(ctx, &users); err != nil {
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	if err = c.resolveFavorites(users); err != nil {
 		return nil, err
 	}
 
 	return users, nil
 }
 
-func (c *Client) SelectReport(coll *mongo.Collection, url string) (models.Report, error) {
+// SelectReport selects a report of the conference from a collection by its URL.
+func (c *Client) SelectReport(conferenceID, url string) (models.Report, error) {
+	coll := c.collection("report")
+
 	var report models.Report
 
-	filter := bson.D{{"url", url}}
+	filter := bson.D{{Key: "conferenceID", Value: conferenceID}, {Key: "url", Value: url}}
 
 	err := coll.FindOne(ctx, filter).Decode(&report)
 
 	if err != nil {
-		return models.Report{}, err
+		return models.Report{}, notFound(err)
 	}
 
 	return report, nil
 }
 
-// SelectEvaluation selects an evaluation from a collection by the user's Telegram ID and the report URL.
-func (c *Client) SelectEvaluation(coll *mongo.Collection, tgID int, url string) (bool, models.Evaluation, error) {
+// SelectEvaluation selects an evaluation from a collection by the user's Telegram ID, the conference and the report URL.
+func (c *Client) SelectEvaluation(tgID int, conferenceID, url string) (bool, models.Evaluation, error) {
+	coll := c.collection("evaluation")
+
 	var evaluation models.Evaluation
 
-	filter := bson.D{{"tgID", tgID}, {"url", url}}
+	filter := bson.D{{Key: "tgID", Value: tgID}, {Key: "conferenceID", Value: conferenceID}, {Key: "url", Value: url}}
 
 	err := coll.FindOne(ctx, filter).Decode(&evaluation)
 
@@ -303,10 +369,11 @@ func (c *Client) SelectEvaluation(coll *mongo.Collection, tgID int, url string)
 	return true, evaluation, nil
 }
 
-// SelectEvaluations selects all evaluations from a collection by the user's Telegram ID.
-func (c *Client) SelectEvaluations(coll *mongo.Collection, tgID int) ([]models.Evaluation, error) {
+// SelectEvaluations selects the evaluations of the reports of the conference from a collection by the user's Telegram ID.
+func (c *Client) SelectEvaluations(tgID int, conferenceID string) ([]models.Evaluation, error) {
+	coll := c.collection("evaluation")
 
-	cursor, err := coll.Find(ctx, bson.M{"tgID": tgID})
+	cursor, err := coll.Find(ctx, bson.M{"tgID": tgID, "conferenceID": conferenceID})
 
 	if err != nil {
 		return nil, err
@@ -321,9 +388,11 @@ func (c *Client) SelectEvaluations(coll *mongo.Collection, tgID int) ([]models.E
 	return evaluations, nil
 }
 
-// SelectAllEvaluations selects all evaluations from a collection.
-func (c *Client) SelectAllEvaluations(coll *mongo.Collection) ([]models.Evaluation, error) {
-	cursor, err := coll.Find(ctx, bson.M{})
+// SelectAllEvaluations selects the evaluations of the reports of the conference from a collection.
+func (c *Client) SelectAllEvaluations(conferenceID string) ([]models.Evaluation, error) {
+	coll := c.collection("evaluation")
+
+	cursor, err := coll.Find(ctx, bson.M{"conferenceID": conferenceID})
 	if err != nil {
 		return nil, err
 	}
@@ -340,13 +409,16 @@ func (c *Client) SelectAllEvaluations(coll *mongo.Collection) ([]models.Evaluati
 }
 
 // UpdateEvaluation updates an evaluation in the database.
-func (c *Client) UpdateEvaluation(coll *mongo.Collection, tgID int, url string, evaluation models.Evaluation) (bool, error) {
-	filter := bson.M{"tgID": tgID, "url": url}
+func (c *Client) UpdateEvaluation(tgID int, conferenceID, url string, evaluation models.Evaluation) (bool, error) {
+	coll := c.collection("evaluation")
+
+	filter := bson.M{"tgID": tgID, "conferenceID": conferenceID, "url": url}
 	update := bson.M{
 		"$set": bson.M{
 			"content":     evaluation.Content,
 			"performance": evaluation.Performance,
 			"comment":     evaluation.Comment,
+			"answers":     evaluation.Answers,
 		},
 	}
 
@@ -359,9 +431,10 @@ func (c *Client) UpdateEvaluation(coll *mongo.Collection, tgID int, url string,
 }
 
 // DeleteEvaluation deletes an evaluation from the database.
-func (c *Client) DeleteEvaluation(coll *mongo.Collection, tgID int, url string) (bool, error) {
+func (c *Client) DeleteEvaluation(tgID int, conferenceID, url string) (bool, error) {
+	coll := c.collection("evaluation")
 
-	deleted, err := coll.DeleteOne(ctx, bson.M{"tgID": tgID, "url": url})
+	deleted, err := coll.DeleteOne(ctx, bson.M{"tgID": tgID, "conferenceID": conferenceID, "url": url})
 
 	if err != nil {
 		return false, err
@@ -369,3 +442,487 @@ func (c *Client) DeleteEvaluation(coll *mongo.Collection, tgID int, url string)
 
 	return deleted.DeletedCount > 0, nil
 }
+
+// InsertAnnouncement inserts a new announcement into a collection and returns its ID.
+func (c *Client) InsertAnnouncement(announcement models.Announcement) (string, error) {
+	coll := c.collection("announcement")
+
+	announcement.ID = primitive.NewObjectID().Hex()
+	_, err := coll.InsertOne(ctx, announcement)
+	if err != nil {
+		return "", err
+	}
+	return announcement.ID, nil
+}
+
+// SelectAnnouncement selects an announcement from a collection by its ID.
+func (c *Client) SelectAnnouncement(id string) (models.Announcement, error) {
+	coll := c.collection("announcement")
+
+	var announcement models.Announcement
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&announcement)
+	if err != nil {
+		return models.Announcement{}, notFound(err)
+	}
+	return announcement, nil
+}
+
+// SelectAnnouncements selects all announcements with the given status from a collection, ordered by their send time.
+func (c *Client) SelectAnnouncements(status string) ([]models.Announcement, error) {
+	coll := c.collection("announcement")
+
+	cursor, err := coll.Find(ctx, bson.M{"status": status}, options.Find().SetSort(bson.M{"sendAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var announcements []models.Announcement
+
+	if err = cursor.All(ctx, &announcements); err != nil {
+		return nil, err
+	}
+
+	return announcements, nil
+}
+
+// UpdateAnnouncement updates the text and the send time of a pending announcement.
+func (c *Client) UpdateAnnouncement(id string, text string, sendAt time.Time) (bool, error) {
+	coll := c.collection("announcement")
+
+	filter := bson.M{"_id": id, "status": models.AnnouncementPending}
+	update := bson.M{"$set": bson.M{
+		"text":   text,
+		"sendAt": sendAt,
+	}}
+	updateResult, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return updateResult.MatchedCount > 0, nil
+}
+
+// SetAnnouncementStatus changes the status of an announcement if it currently has the status from.
+// It reports whether the status was changed, so only one caller can claim an announcement.
+func (c *Client) SetAnnouncementStatus(id string, from, to string) (bool, error) {
+	coll := c.collection("announcement")
+
+	filter := bson.M{"_id": id, "status": from}
+	update := bson.M{"$set": bson.M{"status": to}}
+	updateResult, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return updateResult.ModifiedCount > 0, nil
+}
+
+// GrantRole inserts the role into the role collection and records it in the roleAudit collection.
+// It reports whether the user didn't have the role yet.
+func (c *Client) GrantRole(role models.UserRole) (bool, error) {
+	if _, err := c.collection("role").InsertOne(ctx, role); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, c.insertOne("roleAudit", models.RoleAudit{TgID: role.TgID, Role: role.Role, ConferenceID: role.ConferenceID,
+		Action: models.RoleGranted, By: role.GrantedBy, At: role.GrantedAt})
+}
+
+// RevokeRole deletes the role of the conference from the role collection and records it in the roleAudit collection.
+// It reports whether the user had the role.
+func (c *Client) RevokeRole(tgID int, role string, conferenceID string, by int) (bool, error) {
+	deleteResult, err := c.collection("role").DeleteOne(ctx, bson.M{"tgID": tgID, "role": role, "conferenceID": conferenceID})
+	if err != nil {
+		return false, err
+	}
+
+	if deleteResult.DeletedCount == 0 {
+		return false, nil
+	}
+
+	return true, c.insertOne("roleAudit", models.RoleAudit{TgID: tgID, Role: role, ConferenceID: conferenceID,
+		Action: models.RoleRevoked, By: by, At: time.Now().UTC()})
+}
+
+// selectRoles selects the roles matching the filter ordered by the time they were granted.
+func (c *Client) selectRoles(filter bson.M) ([]models.UserRole, error) {
+	cursor, err := c.collection("role").Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "grantedAt", Value: 1}, {Key: "tgID", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []models.UserRole
+
+	if err = cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// SelectUserRoles selects the roles of the user from the role collection.
+func (c *Client) SelectUserRoles(tgID int) ([]models.UserRole, error) {
+	return c.selectRoles(bson.M{"tgID": tgID})
+}
+
+// SelectRoles selects the owners and the roles granted for the conference from the role collection.
+func (c *Client) SelectRoles(conferenceID string) ([]models.UserRole, error) {
+	return c.selectRoles(bson.M{"$or": bson.A{bson.M{"role": models.RoleOwner}, bson.M{"conferenceID": conferenceID}}})
+}
+
+// SelectRoleAudit selects the latest entries of the roleAudit collection, the newest first.
+func (c *Client) SelectRoleAudit(limit int) ([]models.RoleAudit, error) {
+	opts := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit))
+
+	cursor, err := c.collection("roleAudit").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []models.RoleAudit
+
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// LinkSpeaker inserts the link into the speaker collection. It reports whether the user wasn't linked to the report yet.
+func (c *Client) LinkSpeaker(link models.SpeakerLink) (bool, error) {
+	if _, err := c.collection("speaker").InsertOne(ctx, link); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// UnlinkSpeaker deletes the link from the speaker collection. It reports whether the user was linked to the report.
+func (c *Client) UnlinkSpeaker(tgID int, conferenceID, url string) (bool, error) {
+	deleteResult, err := c.collection("speaker").DeleteOne(ctx, bson.M{"tgID": tgID, "conferenceID": conferenceID, "url": url})
+	if err != nil {
+		return false, err
+	}
+	return deleteResult.DeletedCount > 0, nil
+}
+
+// SelectSpeakerLinks selects the links of the conference from the speaker collection ordered by the time they were made.
+func (c *Client) SelectSpeakerLinks(conferenceID string) ([]models.SpeakerLink, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "linkedAt", Value: 1}, {Key: "tgID", Value: 1}})
+
+	cursor, err := c.collection("speaker").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []models.SpeakerLink
+
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// InsertQuestion inserts a new question into the question collection and returns its ID.
+func (c *Client) InsertQuestion(question models.Question) (string, error) {
+	question.ID = primitive.NewObjectID().Hex()
+	if _, err := c.collection("question").InsertOne(ctx, question); err != nil {
+		return "", err
+	}
+	return question.ID, nil
+}
+
+// SelectQuestion selects a question from the question collection by its ID.
+func (c *Client) SelectQuestion(id string) (models.Question, error) {
+	var question models.Question
+	if err := c.collection("question").FindOne(ctx, bson.M{"_id": id}).Decode(&question); err != nil {
+		return models.Question{}, notFound(err)
+	}
+	return question, nil
+}
+
+// SelectQuestions selects the questions of the conference from the question collection ordered by the time they were asked.
+func (c *Client) SelectQuestions(conferenceID string) ([]models.Question, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "askedAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := c.collection("question").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []models.Question
+
+	if err = cursor.All(ctx, &questions); err != nil {
+		return nil, err
+	}
+
+	return questions, nil
+}
+
+// UpvoteQuestion adds the user to the voters of the question and increments its votes in one update.
+// It reports whether the user hadn't voted for it yet.
+func (c *Client) UpvoteQuestion(id string, tgID int) (bool, error) {
+	filter := bson.M{"_id": id, "voters": bson.M{"$ne": tgID}}
+	update := bson.M{"$push": bson.M{"voters": tgID}, "$inc": bson.M{"votes": 1}}
+
+	updateResult, err := c.collection("question").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return updateResult.ModifiedCount > 0, nil
+}
+
+// SetQuestionAnswered marks the question as answered. It reports whether it wasn't answered yet.
+func (c *Client) SetQuestionAnswered(id string) (bool, error) {
+	updateResult, err := c.collection("question").UpdateOne(ctx, bson.M{"_id": id, "answered": false}, bson.M{"$set": bson.M{"answered": true}})
+	if err != nil {
+		return false, err
+	}
+	return updateResult.ModifiedCount > 0, nil
+}
+
+// InsertPoll inserts a new poll with zero counts into the poll collection and returns its ID.
+func (c *Client) InsertPoll(poll models.Poll) (string, error) {
+	poll.ID = primitive.NewObjectID().Hex()
+	poll.Counts = make([]int, len(poll.Options))
+	if _, err := c.collection("poll").InsertOne(ctx, poll); err != nil {
+		return "", err
+	}
+	return poll.ID, nil
+}
+
+// SelectPoll selects a poll from the poll collection by its ID.
+func (c *Client) SelectPoll(id string) (models.Poll, error) {
+	var poll models.Poll
+	if err := c.collection("poll").FindOne(ctx, bson.M{"_id": id}).Decode(&poll); err != nil {
+		return models.Poll{}, notFound(err)
+	}
+	return poll, nil
+}
+
+// SelectPolls selects the polls of the conference from the poll collection ordered by the time they were launched.
+func (c *Client) SelectPolls(conferenceID string) ([]models.Poll, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := c.collection("poll").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var polls []models.Poll
+
+	if err = cursor.All(ctx, &polls); err != nil {
+		return nil, err
+	}
+
+	return polls, nil
+}
+
+// VotePoll adds the user to the voters of an open poll and increments the count of the option in one update.
+// It reports whether the vote counted.
+func (c *Client) VotePoll(id string, tgID int, option int) (bool, error) {
+	if option < 0 {
+		return false, nil
+	}
+
+	counter := fmt.Sprintf("counts.%d", option)
+	filter := bson.M{"_id": id, "closed": false, "voters": bson.M{"$ne": tgID}, counter: bson.M{"$exists": true}}
+	update := bson.M{"$push": bson.M{"voters": tgID}, "$inc": bson.M{counter: 1}}
+
+	updateResult, err := c.collection("poll").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return updateResult.ModifiedCount > 0, nil
+}
+
+// ClosePoll closes the poll. It reports whether it was open.
+func (c *Client) ClosePoll(id string) (bool, error) {
+	updateResult, err := c.collection("poll").UpdateOne(ctx, bson.M{"_id": id, "closed": false}, bson.M{"$set": bson.M{"closed": true}})
+	if err != nil {
+		return false, err
+	}
+	return updateResult.ModifiedCount > 0, nil
+}
+
+// AddReportView inserts the view of the report of the conference into the reportView collection, repeated views are recorded once.
+func (c *Client) AddReportView(tgID int, conferenceID, url string) error {
+	filter := bson.M{"tgID": tgID, "conferenceID": conferenceID, "url": url}
+	update := bson.M{"$setOnInsert": bson.M{"viewedAt": time.Now().UTC()}}
+
+	_, err := c.collection("reportView").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// SelectReportViewers selects the Telegram IDs of the users who opened the card of the report of the conference
+// from the reportView collection.
+func (c *Client) SelectReportViewers(conferenceID, url string) ([]int, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "viewedAt", Value: 1}, {Key: "tgID", Value: 1}})
+
+	cursor, err := c.collection("reportView").Find(ctx, bson.M{"conferenceID": conferenceID, "url": url}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var views []struct {
+		TgID int `bson:"tgID"`
+	}
+
+	if err = cursor.All(ctx, &views); err != nil {
+		return nil, err
+	}
+
+	viewers := make([]int, 0, len(views))
+	for _, view := range views {
+		viewers = append(viewers, view.TgID)
+	}
+
+	return viewers, nil
+}
+
+// SelectConferenceViewers selects the Telegram IDs of the users who opened the card of any report of the conference.
+func (c *Client) SelectConferenceViewers(conferenceID string) ([]int, error) {
+	opts := options.Find().SetProjection(bson.M{"tgID": 1}).SetSort(bson.D{{Key: "tgID", Value: 1}})
+
+	cursor, err := c.collection("reportView").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var views []struct {
+		TgID int `bson:"tgID"`
+	}
+
+	if err = cursor.All(ctx, &views); err != nil {
+		return nil, err
+	}
+
+	var viewers []int
+	for _, view := range views {
+		if len(viewers) == 0 || viewers[len(viewers)-1] != view.TgID {
+			viewers = append(viewers, view.TgID)
+		}
+	}
+
+	return viewers, nil
+}
+
+// SaveQuestionnaire inserts the questionnaire into the questionnaire collection or replaces the one of the same conference and track.
+func (c *Client) SaveQuestionnaire(questionnaire models.Questionnaire) error {
+	filter := bson.M{"conferenceID": questionnaire.ConferenceID, "track": questionnaire.Track}
+
+	_, err := c.collection("questionnaire").ReplaceOne(ctx, filter, questionnaire, options.Replace().SetUpsert(true))
+	return err
+}
+
+// SelectQuestionnaires selects the questionnaires of the conference from the questionnaire collection ordered by their tracks.
+func (c *Client) SelectQuestionnaires(conferenceID string) ([]models.Questionnaire, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "track", Value: 1}})
+
+	cursor, err := c.collection("questionnaire").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var questionnaires []models.Questionnaire
+
+	if err = cursor.All(ctx, &questionnaires); err != nil {
+		return nil, err
+	}
+
+	return questionnaires, nil
+}
+
+// DeleteQuestionnaire deletes the questionnaire of the conference and track from the questionnaire collection.
+func (c *Client) DeleteQuestionnaire(conferenceID string, track string) (bool, error) {
+	deleteResult, err := c.collection("questionnaire").DeleteOne(ctx, bson.M{"conferenceID": conferenceID, "track": track})
+	if err != nil {
+		return false, err
+	}
+	return deleteResult.DeletedCount > 0, nil
+}
+
+// InsertSurvey inserts the answers of the user into the survey collection.
+// It reports whether the user hadn't answered the survey of the conference yet.
+func (c *Client) InsertSurvey(survey models.Survey) (bool, error) {
+	if _, err := c.collection("survey").InsertOne(ctx, survey); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SelectSurvey selects the answers of the user to the survey of the conference and reports whether they exist.
+func (c *Client) SelectSurvey(tgID int, conferenceID string) (bool, models.Survey, error) {
+	var survey models.Survey
+
+	err := c.collection("survey").FindOne(ctx, bson.M{"tgID": tgID, "conferenceID": conferenceID}).Decode(&survey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, models.Survey{}, nil
+		}
+		return false, models.Survey{}, err
+	}
+
+	return true, survey, nil
+}
+
+// SelectSurveys selects the answers to the survey of the conference from the survey collection ordered by the time they were given.
+func (c *Client) SelectSurveys(conferenceID string) ([]models.Survey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "answeredAt", Value: 1}, {Key: "tgID", Value: 1}})
+
+	cursor, err := c.collection("survey").Find(ctx, bson.M{"conferenceID": conferenceID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var surveys []models.Survey
+
+	if err = cursor.All(ctx, &surveys); err != nil {
+		return nil, err
+	}
+
+	return surveys, nil
+}
+
+// MarkSurveyInvited inserts the invite of the user to the survey of the conference into the surveyInvite collection.
+// It reports whether the user hadn't been invited yet.
+func (c *Client) MarkSurveyInvited(tgID int, conferenceID string, invitedAt time.Time) (bool, error) {
+	invite := bson.M{"conferenceID": conferenceID, "tgID": tgID, "invitedAt": invitedAt}
+	if _, err := c.collection("surveyInvite").InsertOne(ctx, invite); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SelectSurveyInvites selects the Telegram IDs of the users invited to the survey of the conference from the surveyInvite collection.
+func (c *Client) SelectSurveyInvites(conferenceID string) ([]int, error) {
+	cursor, err := c.collection("surveyInvite").Find(ctx, bson.M{"conferenceID": conferenceID})
+	if err != nil {
+		return nil, err
+	}
+
+	var invites []struct {
+		TgID int `bson:"tgID"`
+	}
+
+	if err = cursor.All(ctx, &invites); err != nil {
+		return nil, err
+	}
+
+	invited := make([]int, 0, len(invites))
+	for _, invite := range invites {
+		invited = append(invited, invite.TgID)
+	}
+
+	return invited, nil
+}
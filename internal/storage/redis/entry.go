@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+)
+
+// SweepInterval is how often the memory and bolt caches delete their expired entries.
+// Marks are never looked up again once they expire, so they would pile up otherwise.
+const SweepInterval = 10 * time.Minute
+
+// Entry is a cached value with its expiration time, the way the memory and bolt caches keep values and locks.
+// Zero expiration means the value never expires.
+type Entry struct {
+	Value     string    `json:"value"`     // Value is the cached value or the owner of a lock.
+	ExpiresAt time.Time `json:"expiresAt"` // ExpiresAt is the expiration time of the value.
+}
+
+// NewEntry returns an entry with the value converted the way Redis stores it, which expires after ttl.
+func NewEntry(value interface{}, ttl time.Duration) Entry {
+	return Entry{Value: Stringify(value), ExpiresAt: ExpiresAt(ttl)}
+}
+
+// Expired reports whether the entry has expired at now.
+func (e Entry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// ExpiresAt returns the expiration time for the duration from now, zero duration means no expiration.
+func ExpiresAt(duration time.Duration) time.Time {
+	if duration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(duration)
+}
+
+// Stringify converts a cached value to a string the way Redis stores it.
+func Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
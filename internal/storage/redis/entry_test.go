@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEntryExpired(t *testing.T) {
+	now := time.Date(2024, time.May, 16, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      bool
+	}{
+		{name: "never expires", want: false},
+		{name: "before expiration", expiresAt: now.Add(time.Second), want: false},
+		{name: "at expiration", expiresAt: now, want: true},
+		{name: "after expiration", expiresAt: now.Add(-time.Second), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Entry{Value: "1", ExpiresAt: tt.expiresAt}).Expired(now); got != tt.want {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		ttl       time.Duration
+		wantValue string
+		wantTTL   bool
+	}{
+		{name: "string", value: "menu", wantValue: "menu"},
+		{name: "bytes", value: []byte(`{"name":"menu"}`), wantValue: `{"name":"menu"}`},
+		{name: "number", value: 42, wantValue: "42"},
+		{name: "with ttl", value: "1", ttl: time.Minute, wantValue: "1", wantTTL: true},
+		{name: "negative ttl never expires", value: "1", ttl: -time.Minute, wantValue: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEntry(tt.value, tt.ttl)
+
+			if e.Value != tt.wantValue {
+				t.Errorf("Value = %q, want %q", e.Value, tt.wantValue)
+			}
+			if e.ExpiresAt.IsZero() == tt.wantTTL {
+				t.Errorf("ExpiresAt = %v, want expiration %v", e.ExpiresAt, tt.wantTTL)
+			}
+			if tt.wantTTL && (e.Expired(time.Now()) || !e.Expired(time.Now().Add(tt.ttl))) {
+				t.Errorf("entry with ttl %v expires at %v", tt.ttl, e.ExpiresAt)
+			}
+		})
+	}
+}
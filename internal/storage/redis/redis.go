@@ -18,7 +18,42 @@ type CacheClient interface {
 	Get(ctx context.Context, key int64) (string, error)                                  // Get retrieves a value from the cache by key.
 }
 
-// Client is a struct that wraps the Redis client and implements the CacheClient interface.
+// Locker is an interface that defines methods for a distributed lock with an expiring lease.
+type Locker interface {
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) // Acquire takes the lock if it is free.
+	Refresh(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) // Refresh prolongs the lease if the lock is held by the owner.
+	Release(ctx context.Context, key, owner string) error                            // Release frees the lock if it is held by the owner.
+}
+
+// Marker is an interface that defines a method for setting expiring marks shared between replicas.
+type Marker interface {
+	Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) // Mark sets the mark if it isn't set and reports whether it was set.
+}
+
+// Store is an interface of a cache which can also hold locks and marks. Redis, memory and bolt clients implement it.
+type Store interface {
+	CacheClient
+	Locker
+	Marker
+}
+
+// refreshScript prolongs the lease only if the lock is still held by the owner.
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock only if it is held by the owner.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Client is a struct that wraps the Redis client and implements the CacheClient, Locker and Marker interfaces.
 type Client struct {
 	Rdb *redis.Client // Rdb is the underlying Redis client.
 }
@@ -42,3 +77,30 @@ func (c *Client) Get(ctx context.Context, key int64) (string, error) {
 func (c *Client) Set(ctx context.Context, key int64, value interface{}, duration time.Duration) error {
 	return c.Rdb.Set(ctx, strconv.Itoa(int(key)), value, duration).Err()
 }
+
+// Acquire takes the lock with the given key for the owner if it is free.
+// The lock expires after ttl unless it is refreshed. It reports whether the lock was taken.
+func (c *Client) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	return c.Rdb.SetNX(ctx, key, owner, ttl).Result()
+}
+
+// Refresh prolongs the lease of the lock for ttl if it is still held by the owner.
+// It reports whether the lock is still held.
+func (c *Client) Refresh(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	res, err := refreshScript.Run(ctx, c.Rdb, []string{key}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+// Release frees the lock if it is held by the owner.
+func (c *Client) Release(ctx context.Context, key, owner string) error {
+	return releaseScript.Run(ctx, c.Rdb, []string{key}, owner).Err()
+}
+
+// Mark sets the mark with the given key if it isn't set, the mark expires after ttl.
+// It reports whether the mark was set by this call.
+func (c *Client) Mark(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.Rdb.SetNX(ctx, key, 1, ttl).Result()
+}
@@ -0,0 +1,530 @@
+package sqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/migrate"
+	"time"
+)
+
+// migration is a versioned change of the schema. It is written for each dialect, since column types differ.
+type migration struct {
+	version  int
+	name     string
+	sqlite   string
+	postgres string
+}
+
+// migrations are the schema changes in the order they are applied. Applied migrations should never be edited,
+// add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create reports, users, favorites and evaluations",
+		sqlite: `
+CREATE TABLE reports (
+	url        TEXT PRIMARY KEY,
+	title      TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	duration   INTEGER NOT NULL,
+	speakers   TEXT NOT NULL,
+	room       TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE users (
+	tg_id          INTEGER PRIMARY KEY,
+	chat_id        INTEGER NOT NULL DEFAULT 0,
+	identification TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE favorites (
+	tg_id    INTEGER NOT NULL REFERENCES users (tg_id) ON DELETE CASCADE,
+	url      TEXT NOT NULL,
+	added_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, url)
+);
+CREATE TABLE evaluations (
+	tg_id       INTEGER NOT NULL,
+	url         TEXT NOT NULL,
+	content     TEXT NOT NULL DEFAULT '',
+	performance TEXT NOT NULL DEFAULT '',
+	comment     TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, url)
+);`,
+		postgres: `
+CREATE TABLE reports (
+	url        TEXT PRIMARY KEY,
+	title      TEXT NOT NULL,
+	start_time TIMESTAMPTZ NOT NULL,
+	duration   INTEGER NOT NULL,
+	speakers   TEXT NOT NULL,
+	room       TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE users (
+	tg_id          BIGINT PRIMARY KEY,
+	chat_id        BIGINT NOT NULL DEFAULT 0,
+	identification TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE favorites (
+	tg_id    BIGINT NOT NULL REFERENCES users (tg_id) ON DELETE CASCADE,
+	url      TEXT NOT NULL,
+	added_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tg_id, url)
+);
+CREATE TABLE evaluations (
+	tg_id       BIGINT NOT NULL,
+	url         TEXT NOT NULL,
+	content     TEXT NOT NULL DEFAULT '',
+	performance TEXT NOT NULL DEFAULT '',
+	comment     TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tg_id, url)
+);`,
+	},
+	{
+		version: 2,
+		name:    "create announcements, dead letters and abandoned flows",
+		sqlite: `
+CREATE TABLE announcements (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	text       TEXT NOT NULL,
+	send_at    TIMESTAMP NOT NULL,
+	status     TEXT NOT NULL,
+	created_by INTEGER NOT NULL
+);
+CREATE INDEX announcements_status_send_at ON announcements (status, send_at);
+CREATE TABLE dead_letters (
+	chat_id    INTEGER NOT NULL,
+	text       TEXT NOT NULL,
+	error      TEXT NOT NULL,
+	attempts   INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE abandoned_flows (
+	tg_id        INTEGER NOT NULL,
+	state        TEXT NOT NULL,
+	step         TEXT NOT NULL DEFAULT '',
+	entered_at   TIMESTAMP NOT NULL,
+	abandoned_at TIMESTAMP NOT NULL
+);`,
+		postgres: `
+CREATE TABLE announcements (
+	id         BIGSERIAL PRIMARY KEY,
+	text       TEXT NOT NULL,
+	send_at    TIMESTAMPTZ NOT NULL,
+	status     TEXT NOT NULL,
+	created_by BIGINT NOT NULL
+);
+CREATE INDEX announcements_status_send_at ON announcements (status, send_at);
+CREATE TABLE dead_letters (
+	chat_id    BIGINT NOT NULL,
+	text       TEXT NOT NULL,
+	error      TEXT NOT NULL,
+	attempts   INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE abandoned_flows (
+	tg_id        BIGINT NOT NULL,
+	state        TEXT NOT NULL,
+	step         TEXT NOT NULL DEFAULT '',
+	entered_at   TIMESTAMPTZ NOT NULL,
+	abandoned_at TIMESTAMPTZ NOT NULL
+);`,
+	},
+	{
+		version: 3,
+		name:    "create conferences and assign the existing data to the default conference",
+		sqlite: `
+CREATE TABLE conferences (
+	id                     TEXT PRIMARY KEY,
+	name                   TEXT NOT NULL,
+	url                    TEXT NOT NULL DEFAULT '',
+	time_from              TIMESTAMP NOT NULL,
+	time_until             TIMESTAMP NOT NULL,
+	time_reviews_available TIMESTAMP NOT NULL,
+	admins                 TEXT NOT NULL DEFAULT '',
+	created_by             INTEGER NOT NULL DEFAULT 0
+);
+ALTER TABLE reports ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX reports_conference_id ON reports (conference_id);
+ALTER TABLE users ADD COLUMN conference_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE announcements ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';`,
+		postgres: `
+CREATE TABLE conferences (
+	id                     TEXT PRIMARY KEY,
+	name                   TEXT NOT NULL,
+	url                    TEXT NOT NULL DEFAULT '',
+	time_from              TIMESTAMPTZ NOT NULL,
+	time_until             TIMESTAMPTZ NOT NULL,
+	time_reviews_available TIMESTAMPTZ NOT NULL,
+	admins                 TEXT NOT NULL DEFAULT '',
+	created_by             BIGINT NOT NULL DEFAULT 0
+);
+ALTER TABLE reports ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX reports_conference_id ON reports (conference_id);
+ALTER TABLE users ADD COLUMN conference_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE announcements ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';`,
+	},
+	{
+		version: 4,
+		name:    "identify reports by their conference and URL",
+		sqlite: `
+CREATE TABLE reports_new (
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	title         TEXT NOT NULL,
+	start_time    TIMESTAMP NOT NULL,
+	duration      INTEGER NOT NULL,
+	speakers      TEXT NOT NULL,
+	room          TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (conference_id, url)
+);
+INSERT INTO reports_new (conference_id, url, title, start_time, duration, speakers, room)
+SELECT conference_id, url, title, start_time, duration, speakers, room FROM reports;
+CREATE TABLE favorites_new (
+	tg_id         INTEGER NOT NULL REFERENCES users (tg_id) ON DELETE CASCADE,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	added_at      TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+INSERT INTO favorites_new (tg_id, conference_id, url, added_at)
+SELECT f.tg_id, COALESCE((SELECT r.conference_id FROM reports r WHERE r.url = f.url), 'default'), f.url, f.added_at FROM favorites f;
+CREATE TABLE evaluations_new (
+	tg_id         INTEGER NOT NULL,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	content       TEXT NOT NULL DEFAULT '',
+	performance   TEXT NOT NULL DEFAULT '',
+	comment       TEXT NOT NULL DEFAULT '',
+	created_at    TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+INSERT INTO evaluations_new (tg_id, conference_id, url, content, performance, comment, created_at)
+SELECT e.tg_id, COALESCE((SELECT r.conference_id FROM reports r WHERE r.url = e.url), 'default'), e.url, e.content, e.performance,
+e.comment, e.created_at FROM evaluations e;
+DROP TABLE reports;
+DROP TABLE favorites;
+DROP TABLE evaluations;
+ALTER TABLE reports_new RENAME TO reports;
+ALTER TABLE favorites_new RENAME TO favorites;
+ALTER TABLE evaluations_new RENAME TO evaluations;`,
+		postgres: `
+ALTER TABLE reports DROP CONSTRAINT reports_pkey, ADD PRIMARY KEY (conference_id, url);
+DROP INDEX reports_conference_id;
+ALTER TABLE favorites ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';
+UPDATE favorites f SET conference_id = r.conference_id FROM reports r WHERE r.url = f.url;
+ALTER TABLE favorites ALTER COLUMN conference_id DROP DEFAULT, DROP CONSTRAINT favorites_pkey, ADD PRIMARY KEY (tg_id, conference_id, url);
+ALTER TABLE evaluations ADD COLUMN conference_id TEXT NOT NULL DEFAULT 'default';
+UPDATE evaluations e SET conference_id = r.conference_id FROM reports r WHERE r.url = e.url;
+ALTER TABLE evaluations ALTER COLUMN conference_id DROP DEFAULT, DROP CONSTRAINT evaluations_pkey, ADD PRIMARY KEY (tg_id, conference_id, url);`,
+	},
+	{
+		version: 5,
+		name:    "create roles with their audit trail and make the conference creators organizers",
+		sqlite: `
+CREATE TABLE user_roles (
+	tg_id         INTEGER NOT NULL,
+	role          TEXT NOT NULL,
+	conference_id TEXT NOT NULL DEFAULT '',
+	granted_by    INTEGER NOT NULL DEFAULT 0,
+	granted_at    TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, role, conference_id)
+);
+CREATE TABLE role_audit (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	tg_id         INTEGER NOT NULL,
+	role          TEXT NOT NULL,
+	conference_id TEXT NOT NULL DEFAULT '',
+	action        TEXT NOT NULL,
+	by_tg_id      INTEGER NOT NULL DEFAULT 0,
+	at            TIMESTAMP NOT NULL
+);
+INSERT INTO user_roles (tg_id, role, conference_id, granted_by, granted_at)
+SELECT created_by, 'organizer', id, created_by, CURRENT_TIMESTAMP FROM conferences WHERE created_by <> 0;
+ALTER TABLE conferences DROP COLUMN admins;`,
+		postgres: `
+CREATE TABLE user_roles (
+	tg_id         BIGINT NOT NULL,
+	role          TEXT NOT NULL,
+	conference_id TEXT NOT NULL DEFAULT '',
+	granted_by    BIGINT NOT NULL DEFAULT 0,
+	granted_at    TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tg_id, role, conference_id)
+);
+CREATE TABLE role_audit (
+	id            BIGSERIAL PRIMARY KEY,
+	tg_id         BIGINT NOT NULL,
+	role          TEXT NOT NULL,
+	conference_id TEXT NOT NULL DEFAULT '',
+	action        TEXT NOT NULL,
+	by_tg_id      BIGINT NOT NULL DEFAULT 0,
+	at            TIMESTAMPTZ NOT NULL
+);
+INSERT INTO user_roles (tg_id, role, conference_id, granted_by, granted_at)
+SELECT created_by, 'organizer', id, created_by, CURRENT_TIMESTAMP FROM conferences WHERE created_by <> 0;
+ALTER TABLE conferences DROP COLUMN admins;`,
+	},
+	{
+		version: 6,
+		name:    "create speaker links",
+		sqlite: `
+CREATE TABLE speaker_links (
+	tg_id         INTEGER NOT NULL,
+	url           TEXT NOT NULL,
+	conference_id TEXT NOT NULL,
+	linked_by     INTEGER NOT NULL DEFAULT 0,
+	linked_at     TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+CREATE INDEX speaker_links_conference_id ON speaker_links (conference_id);`,
+		postgres: `
+CREATE TABLE speaker_links (
+	tg_id         BIGINT NOT NULL,
+	url           TEXT NOT NULL,
+	conference_id TEXT NOT NULL,
+	linked_by     BIGINT NOT NULL DEFAULT 0,
+	linked_at     TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+CREATE INDEX speaker_links_conference_id ON speaker_links (conference_id);`,
+	},
+	{
+		version: 7,
+		name:    "create questions and their votes",
+		sqlite: `
+CREATE TABLE questions (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	tg_id         INTEGER NOT NULL,
+	text          TEXT NOT NULL,
+	votes         INTEGER NOT NULL DEFAULT 0,
+	answered      BOOLEAN NOT NULL DEFAULT FALSE,
+	asked_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX questions_conference_id ON questions (conference_id);
+CREATE TABLE question_votes (
+	question_id INTEGER NOT NULL REFERENCES questions (id) ON DELETE CASCADE,
+	tg_id       INTEGER NOT NULL,
+	PRIMARY KEY (question_id, tg_id)
+);`,
+		postgres: `
+CREATE TABLE questions (
+	id            BIGSERIAL PRIMARY KEY,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	tg_id         BIGINT NOT NULL,
+	text          TEXT NOT NULL,
+	votes         INTEGER NOT NULL DEFAULT 0,
+	answered      BOOLEAN NOT NULL DEFAULT FALSE,
+	asked_at      TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX questions_conference_id ON questions (conference_id);
+CREATE TABLE question_votes (
+	question_id BIGINT NOT NULL REFERENCES questions (id) ON DELETE CASCADE,
+	tg_id       BIGINT NOT NULL,
+	PRIMARY KEY (question_id, tg_id)
+);`,
+	},
+	{
+		version: 8,
+		name:    "create polls with their votes and report views",
+		sqlite: `
+CREATE TABLE polls (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	conference_id      TEXT NOT NULL,
+	url                TEXT NOT NULL,
+	question           TEXT NOT NULL,
+	options            TEXT NOT NULL,
+	closed             BOOLEAN NOT NULL DEFAULT FALSE,
+	created_by         INTEGER NOT NULL,
+	results_message_id INTEGER NOT NULL DEFAULT 0,
+	created_at         TIMESTAMP NOT NULL
+);
+CREATE INDEX polls_conference_id ON polls (conference_id);
+CREATE TABLE poll_votes (
+	poll_id INTEGER NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+	tg_id   INTEGER NOT NULL,
+	option  INTEGER NOT NULL,
+	PRIMARY KEY (poll_id, tg_id)
+);
+CREATE TABLE report_views (
+	tg_id         INTEGER NOT NULL,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	viewed_at     TIMESTAMP NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+CREATE INDEX report_views_conference_id_url ON report_views (conference_id, url);`,
+		postgres: `
+CREATE TABLE polls (
+	id                 BIGSERIAL PRIMARY KEY,
+	conference_id      TEXT NOT NULL,
+	url                TEXT NOT NULL,
+	question           TEXT NOT NULL,
+	options            TEXT NOT NULL,
+	closed             BOOLEAN NOT NULL DEFAULT FALSE,
+	created_by         BIGINT NOT NULL,
+	results_message_id BIGINT NOT NULL DEFAULT 0,
+	created_at         TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX polls_conference_id ON polls (conference_id);
+CREATE TABLE poll_votes (
+	poll_id BIGINT NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+	tg_id   BIGINT NOT NULL,
+	option  INTEGER NOT NULL,
+	PRIMARY KEY (poll_id, tg_id)
+);
+CREATE TABLE report_views (
+	tg_id         BIGINT NOT NULL,
+	conference_id TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	viewed_at     TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tg_id, conference_id, url)
+);
+CREATE INDEX report_views_conference_id_url ON report_views (conference_id, url);`,
+	},
+	{
+		version: 9,
+		name:    "create questionnaires and add the answers of evaluations",
+		sqlite: `
+CREATE TABLE questionnaires (
+	conference_id TEXT NOT NULL,
+	track         TEXT NOT NULL DEFAULT '',
+	items         TEXT NOT NULL,
+	updated_by    INTEGER NOT NULL,
+	updated_at    TIMESTAMP NOT NULL,
+	PRIMARY KEY (conference_id, track)
+);
+ALTER TABLE evaluations ADD COLUMN answers TEXT NOT NULL DEFAULT '';`,
+		postgres: `
+CREATE TABLE questionnaires (
+	conference_id TEXT NOT NULL,
+	track         TEXT NOT NULL DEFAULT '',
+	items         TEXT NOT NULL,
+	updated_by    BIGINT NOT NULL,
+	updated_at    TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (conference_id, track)
+);
+ALTER TABLE evaluations ADD COLUMN answers TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		version: 10,
+		name:    "create conference surveys",
+		sqlite: `
+CREATE TABLE surveys (
+	conference_id TEXT NOT NULL,
+	tg_id         INTEGER NOT NULL,
+	nps           INTEGER NOT NULL,
+	venue         INTEGER NOT NULL,
+	catering      INTEGER NOT NULL,
+	organization  INTEGER NOT NULL,
+	comment       TEXT NOT NULL DEFAULT '',
+	answered_at   TIMESTAMP NOT NULL,
+	PRIMARY KEY (conference_id, tg_id)
+);`,
+		postgres: `
+CREATE TABLE surveys (
+	conference_id TEXT NOT NULL,
+	tg_id         BIGINT NOT NULL,
+	nps           INTEGER NOT NULL,
+	venue         INTEGER NOT NULL,
+	catering      INTEGER NOT NULL,
+	organization  INTEGER NOT NULL,
+	comment       TEXT NOT NULL DEFAULT '',
+	answered_at   TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (conference_id, tg_id)
+);`,
+	},
+	{
+		version: 11,
+		name:    "create conference survey invites",
+		sqlite: `
+CREATE TABLE survey_invites (
+	conference_id TEXT NOT NULL,
+	tg_id         INTEGER NOT NULL,
+	invited_at    TIMESTAMP NOT NULL,
+	PRIMARY KEY (conference_id, tg_id)
+);`,
+		postgres: `
+CREATE TABLE survey_invites (
+	conference_id TEXT NOT NULL,
+	tg_id         BIGINT NOT NULL,
+	invited_at    TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (conference_id, tg_id)
+);`,
+	},
+}
+
+// Client implements migrate.Migrator.
+var _ migrate.Migrator = (*Client)(nil)
+
+// ensureMigrationsTable creates the table recording the applied migrations.
+func (c *Client) ensureMigrationsTable() error {
+	_, err := c.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// Migrations returns the schema migrations ordered by version.
+func (c *Client) Migrations() []migrate.Migration {
+	list := make([]migrate.Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, migrate.Migration{Version: m.version, Name: m.name})
+	}
+	return list
+}
+
+// Applied returns the application times of the migrations recorded in the schema_migrations table.
+func (c *Client) Applied() (map[int]time.Time, error) {
+	rows, err := c.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt.UTC()
+	}
+
+	return applied, rows.Err()
+}
+
+// Apply applies the migration with the version and records it in the same transaction.
+func (c *Client) Apply(version int) error {
+	for _, m := range migrations {
+		if m.version != version {
+			continue
+		}
+
+		statement := m.sqlite
+		if c.dialect == Postgres {
+			statement = m.postgres
+		}
+
+		return c.tx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+			_, err := tx.Exec(c.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`), m.version, m.name, time.Now().UTC())
+			return err
+		})
+	}
+
+	return fmt.Errorf("unknown migration %d", version)
+}
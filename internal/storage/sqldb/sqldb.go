@@ -0,0 +1,1162 @@
+// Package sqldb provides a SQL implementation of the repositories for SQLite and PostgreSQL.
+package sqldb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialects of SQL supported by the Client.
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// Client implements storage.Repository.
+var _ storage.Repository = (*Client)(nil)
+
+// Client is a struct that wraps a SQL database.
+type Client struct {
+	db      *sql.DB
+	dialect string
+}
+
+// New opens the database of the dialect with the DSN. The schema is created by applying the migrations with migrate.Up.
+// The DSN is a file path for SQLite and a connection string for PostgreSQL.
+func New(dialect, dsn string) (*Client, error) {
+	var driver string
+
+	switch dialect {
+	case SQLite:
+		driver = "sqlite"
+		if err := os.MkdirAll(filepath.Dir(dsn), 0o755); err != nil {
+			return nil, err
+		}
+		dsn = fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)", dsn)
+	case Postgres:
+		driver = "pgx"
+	default:
+		return nil, fmt.Errorf("unknown SQL dialect %q", dialect)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if dialect == SQLite {
+		// SQLite allows a single writer, so the connections are serialized instead of failing with "database is locked".
+		db.SetMaxOpenConns(1)
+	}
+
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	c := &Client{db: db, dialect: dialect}
+
+	if err = c.ensureMigrationsTable(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes the database.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
+
+// rebind replaces the ? placeholders of the query with the placeholders of the dialect.
+func (c *Client) rebind(query string) string {
+	if c.dialect != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// exec executes the query with ? placeholders.
+func (c *Client) exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.Exec(c.rebind(query), args...)
+}
+
+// tx runs f in a transaction, which is committed if f returns no error and rolled back otherwise.
+func (c *Client) tx(f func(tx *sql.Tx) error) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// notFound converts the error of a missing row to storage.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+// affected reports whether the result changed any rows.
+func affected(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// conferenceColumns are the columns of a conference in the order scanConference reads them.
+const conferenceColumns = "id, name, url, time_from, time_until, time_reviews_available, created_by"
+
+// scanConference scans a conference from the conferenceColumns.
+func scanConference(row scanner) (models.Conference, error) {
+	var conference models.Conference
+
+	err := row.Scan(&conference.ID, &conference.Name, &conference.URL, &conference.TimeFrom, &conference.TimeUntil,
+		&conference.TimeReviewsAvailable, &conference.CreatedBy)
+	if err != nil {
+		return models.Conference{}, err
+	}
+
+	conference.TimeFrom = conference.TimeFrom.UTC()
+	conference.TimeUntil = conference.TimeUntil.UTC()
+	conference.TimeReviewsAvailable = conference.TimeReviewsAvailable.UTC()
+
+	return conference, nil
+}
+
+// SaveConference inserts the conference or replaces the one with the same ID.
+func (c *Client) SaveConference(conference models.Conference) error {
+	_, err := c.exec(`INSERT INTO conferences (`+conferenceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET name = excluded.name, url = excluded.url, time_from = excluded.time_from, time_until = excluded.time_until,
+time_reviews_available = excluded.time_reviews_available, created_by = excluded.created_by`,
+		conference.ID, conference.Name, conference.URL, conference.TimeFrom.UTC(), conference.TimeUntil.UTC(),
+		conference.TimeReviewsAvailable.UTC(), conference.CreatedBy)
+	return err
+}
+
+// SelectConference selects a conference by its ID.
+func (c *Client) SelectConference(id string) (models.Conference, error) {
+	conference, err := scanConference(c.db.QueryRow(c.rebind(`SELECT `+conferenceColumns+` FROM conferences WHERE id = ?`), id))
+	if err != nil {
+		return models.Conference{}, notFound(err)
+	}
+	return conference, nil
+}
+
+// SelectConferences selects all conferences ordered by their start time.
+func (c *Client) SelectConferences() ([]models.Conference, error) {
+	rows, err := c.db.Query(`SELECT ` + conferenceColumns + ` FROM conferences ORDER BY time_from, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conferences []models.Conference
+
+	for rows.Next() {
+		conference, errS := scanConference(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		conferences = append(conferences, conference)
+	}
+
+	return conferences, rows.Err()
+}
+
+// reportColumns are the columns of a report in the order scanReport reads them.
+const reportColumns = "r.conference_id, r.url, r.title, r.start_time, r.duration, r.speakers, r.room"
+
+// scanner is a row or rows to scan.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanReport scans a report from the reportColumns.
+// Report times are wall times labelled as UTC, so they are converted back to UTC.
+func scanReport(row scanner) (models.Report, error) {
+	var report models.Report
+	err := row.Scan(&report.ConferenceID, &report.URL, &report.Title, &report.StartTime, &report.Duration, &report.Speakers, &report.Room)
+	report.StartTime = report.StartTime.UTC()
+	return report, err
+}
+
+// UpdateReports replaces the schedule of the conference with the given reports.
+// It returns the changes of the previously scheduled reports: moved, retitled and cancelled ones.
+func (c *Client) UpdateReports(conferenceID string, reports []models.Report) ([]models.ReportChange, error) {
+	existing, err := c.SelectReports(conferenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := storage.DiffReports(existing, reports)
+
+	if len(reports) == 0 {
+		return changes, nil
+	}
+
+	err = c.tx(func(tx *sql.Tx) error {
+		urls := make([]interface{}, 0, len(reports))
+
+		for _, report := range reports {
+			urls = append(urls, report.URL)
+
+			_, errE := tx.Exec(c.rebind(`INSERT INTO reports (conference_id, url, title, start_time, duration, speakers, room) VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (conference_id, url) DO UPDATE SET title = excluded.title, start_time = excluded.start_time,
+duration = excluded.duration, speakers = excluded.speakers, room = excluded.room`),
+				conferenceID, report.URL, report.Title, report.StartTime.UTC(), report.Duration, report.Speakers, report.Room)
+			if errE != nil {
+				return errE
+			}
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(urls)), ", ")
+
+		_, errE := tx.Exec(c.rebind(fmt.Sprintf(`DELETE FROM reports WHERE conference_id = ? AND url NOT IN (%s)`, placeholders)),
+			append([]interface{}{conferenceID}, urls...)...)
+		if errE != nil {
+			return fmt.Errorf("failed to delete reports: %w", errE)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// SelectReport selects a report of the conference by its URL.
+func (c *Client) SelectReport(conferenceID, url string) (models.Report, error) {
+	report, err := scanReport(c.db.QueryRow(c.rebind(`SELECT `+reportColumns+` FROM reports r WHERE r.conference_id = ? AND r.url = ?`), conferenceID, url))
+	if err != nil {
+		return models.Report{}, notFound(err)
+	}
+	return report, nil
+}
+
+// SelectReports selects the reports of the conference or of all conferences if conferenceID is empty, ordered by their start time.
+func (c *Client) SelectReports(conferenceID string) ([]models.Report, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+reportColumns+` FROM reports r WHERE ? = '' OR r.conference_id = ? ORDER BY r.start_time, r.url`),
+		conferenceID, conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+
+	for rows.Next() {
+		report, errS := scanReport(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// InsertUser inserts a new user, an existing user with the same Telegram ID is left untouched.
+func (c *Client) InsertUser(user models.User) error {
+	return c.tx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(c.rebind(`INSERT INTO users (tg_id, chat_id, identification, conference_id) VALUES (?, ?, ?, ?) ON CONFLICT (tg_id) DO NOTHING`),
+			user.TgID, user.ChatID, user.Identification, user.ConferenceID)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range user.Favorites {
+			if err = c.addFavorite(tx, user.TgID, ref.ConferenceID, ref.URL); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SelectUser selects a user by their Telegram ID.
+func (c *Client) SelectUser(tgID int) (models.User, error) {
+	var user models.User
+
+	err := c.db.QueryRow(c.rebind(`SELECT tg_id, chat_id, identification, conference_id FROM users WHERE tg_id = ?`), tgID).
+		Scan(&user.TgID, &user.ChatID, &user.Identification, &user.ConferenceID)
+	if err != nil {
+		return models.User{}, notFound(err)
+	}
+
+	users := []models.User{user}
+	if err = c.resolveFavorites(users, &tgID); err != nil {
+		return models.User{}, err
+	}
+
+	return users[0], nil
+}
+
+// SelectUsers selects all users.
+func (c *Client) SelectUsers() ([]models.User, error) {
+	rows, err := c.db.Query(`SELECT tg_id, chat_id, identification, conference_id FROM users ORDER BY tg_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+
+	for rows.Next() {
+		var user models.User
+		if err = rows.Scan(&user.TgID, &user.ChatID, &user.Identification, &user.ConferenceID); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = c.resolveFavorites(users, nil); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// resolveFavorites fills the favorite references and reports of the users, who are all users if tgID is nil.
+func (c *Client) resolveFavorites(users []models.User, tgID *int) error {
+	query := `SELECT tg_id, conference_id, url FROM favorites`
+	var args []interface{}
+
+	if tgID != nil {
+		query += ` WHERE tg_id = ?`
+		args = append(args, *tgID)
+	}
+
+	rows, err := c.db.Query(c.rebind(query+` ORDER BY added_at`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	favorites := make(map[int][]models.ReportRef)
+
+	for rows.Next() {
+		var (
+			id  int
+			ref models.ReportRef
+		)
+		if err = rows.Scan(&id, &ref.ConferenceID, &ref.URL); err != nil {
+			return err
+		}
+		favorites[id] = append(favorites[id], ref)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range users {
+		users[i].Favorites = favorites[users[i].TgID]
+	}
+
+	reports, err := c.SelectReports("")
+	if err != nil {
+		return err
+	}
+
+	storage.ResolveFavorites(users, reports)
+
+	return nil
+}
+
+// UpdateUserID updates a user's identification, the user is created if it doesn't exist.
+func (c *Client) UpdateUserID(tgID int, identification string) (bool, error) {
+	_, err := c.exec(`INSERT INTO users (tg_id, identification) VALUES (?, ?)
+ON CONFLICT (tg_id) DO UPDATE SET identification = excluded.identification`, tgID, identification)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SelectUserConference selects the conference the user picked.
+func (c *Client) SelectUserConference(tgID int) (string, error) {
+	var user models.User
+
+	err := c.db.QueryRow(c.rebind(`SELECT conference_id FROM users WHERE tg_id = ?`), tgID).Scan(&user.ConferenceID)
+	if err != nil {
+		return "", notFound(err)
+	}
+
+	return user.ActiveConference(), nil
+}
+
+// SetUserConference sets the conference the user picked.
+func (c *Client) SetUserConference(tgID int, conferenceID string) error {
+	_, err := c.exec(`UPDATE users SET conference_id = ? WHERE tg_id = ?`, conferenceID, tgID)
+	return err
+}
+
+// AddUserFavReport adds a report of the conference to a user's list of favorite reports.
+func (c *Client) AddUserFavReport(tgID int, conferenceID, reportURL string) error {
+	return c.tx(func(tx *sql.Tx) error {
+		return c.addFavorite(tx, tgID, conferenceID, reportURL)
+	})
+}
+
+// addFavorite adds the report of the conference to the favorites of an existing user if it isn't there yet.
+func (c *Client) addFavorite(tx *sql.Tx, tgID int, conferenceID, url string) error {
+	_, err := tx.Exec(c.rebind(`INSERT INTO favorites (tg_id, conference_id, url, added_at) SELECT tg_id, ?, ?, ? FROM users WHERE tg_id = ?
+ON CONFLICT (tg_id, conference_id, url) DO NOTHING`), conferenceID, url, time.Now().UTC(), tgID)
+	return err
+}
+
+// RemoveUserFavReport removes a report of the conference from a user's list of favorite reports.
+func (c *Client) RemoveUserFavReport(tgID int, conferenceID, reportURL string) error {
+	_, err := c.exec(`DELETE FROM favorites WHERE tg_id = ? AND conference_id = ? AND url = ?`, tgID, conferenceID, reportURL)
+	return err
+}
+
+// RemoveFavReportFromAll removes a report of the conference from the favorite reports of every user.
+func (c *Client) RemoveFavReportFromAll(conferenceID, reportURL string) error {
+	_, err := c.exec(`DELETE FROM favorites WHERE conference_id = ? AND url = ?`, conferenceID, reportURL)
+	return err
+}
+
+// evaluationColumns are the columns of an evaluation in the order scanEvaluation reads them.
+const evaluationColumns = "tg_id, conference_id, url, content, performance, comment, answers"
+
+// scanEvaluation scans an evaluation from the evaluationColumns.
+func scanEvaluation(row scanner) (models.Evaluation, error) {
+	var (
+		evaluation models.Evaluation
+		answers    string
+	)
+	if err := row.Scan(&evaluation.TgID, &evaluation.ConferenceID, &evaluation.URL, &evaluation.Content, &evaluation.Performance, &evaluation.Comment, &answers); err != nil {
+		return evaluation, err
+	}
+	if answers != "" {
+		if err := json.Unmarshal([]byte(answers), &evaluation.Answers); err != nil {
+			return evaluation, err
+		}
+	}
+	return evaluation, nil
+}
+
+// encodeAnswers encodes the answers of an evaluation as JSON, no answers are stored as an empty string.
+// The keys are sorted by the encoder, so the same answers are always stored as the same string.
+func encodeAnswers(answers map[string]string) (string, error) {
+	if len(answers) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(answers)
+	return string(encoded), err
+}
+
+// selectEvaluations selects the evaluations matching the condition in the order they were made.
+func (c *Client) selectEvaluations(condition string, args ...interface{}) ([]models.Evaluation, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+evaluationColumns+` FROM evaluations `+condition+` ORDER BY created_at`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evaluations []models.Evaluation
+
+	for rows.Next() {
+		evaluation, errS := scanEvaluation(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return evaluations, rows.Err()
+}
+
+// InsertEvaluation inserts a new evaluation, an existing evaluation of the report by the user is left untouched.
+func (c *Client) InsertEvaluation(evaluation models.Evaluation) error {
+	answers, err := encodeAnswers(evaluation.Answers)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec(`INSERT INTO evaluations (`+evaluationColumns+`, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (tg_id, conference_id, url) DO NOTHING`,
+		evaluation.TgID, evaluation.ConferenceID, evaluation.URL, evaluation.Content, evaluation.Performance, evaluation.Comment, answers, time.Now().UTC())
+	return err
+}
+
+// SelectEvaluation selects an evaluation by the user's Telegram ID, the conference and the report URL.
+func (c *Client) SelectEvaluation(tgID int, conferenceID, url string) (bool, models.Evaluation, error) {
+	evaluation, err := scanEvaluation(c.db.QueryRow(c.rebind(`SELECT `+evaluationColumns+` FROM evaluations WHERE tg_id = ? AND conference_id = ? AND url = ?`),
+		tgID, conferenceID, url))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, models.Evaluation{}, nil
+		}
+		return false, models.Evaluation{}, err
+	}
+	return true, evaluation, nil
+}
+
+// SelectEvaluations selects the evaluations of the reports of the conference by the user's Telegram ID.
+func (c *Client) SelectEvaluations(tgID int, conferenceID string) ([]models.Evaluation, error) {
+	return c.selectEvaluations(`WHERE tg_id = ? AND conference_id = ?`, tgID, conferenceID)
+}
+
+// SelectAllEvaluations selects the evaluations of the reports of the conference.
+func (c *Client) SelectAllEvaluations(conferenceID string) ([]models.Evaluation, error) {
+	return c.selectEvaluations(`WHERE conference_id = ?`, conferenceID)
+}
+
+// UpdateEvaluation updates the marks, the comment and the answers of an evaluation. It reports whether anything changed.
+func (c *Client) UpdateEvaluation(tgID int, conferenceID, url string, evaluation models.Evaluation) (bool, error) {
+	answers, err := encodeAnswers(evaluation.Answers)
+	if err != nil {
+		return false, err
+	}
+	return affected(c.exec(`UPDATE evaluations SET content = ?, performance = ?, comment = ?, answers = ?
+WHERE tg_id = ? AND conference_id = ? AND url = ? AND NOT (content = ? AND performance = ? AND comment = ? AND answers = ?)`,
+		evaluation.Content, evaluation.Performance, evaluation.Comment, answers, tgID, conferenceID, url,
+		evaluation.Content, evaluation.Performance, evaluation.Comment, answers))
+}
+
+// DeleteEvaluation deletes an evaluation.
+func (c *Client) DeleteEvaluation(tgID int, conferenceID, url string) (bool, error) {
+	return affected(c.exec(`DELETE FROM evaluations WHERE tg_id = ? AND conference_id = ? AND url = ?`, tgID, conferenceID, url))
+}
+
+// announcementColumns are the columns of an announcement in the order scanAnnouncement reads them.
+const announcementColumns = "id, conference_id, text, send_at, status, created_by"
+
+// scanAnnouncement scans an announcement from the announcementColumns.
+func scanAnnouncement(row scanner) (models.Announcement, error) {
+	var (
+		announcement models.Announcement
+		id           int64
+	)
+	err := row.Scan(&id, &announcement.ConferenceID, &announcement.Text, &announcement.SendAt, &announcement.Status, &announcement.CreatedBy)
+	announcement.ID = strconv.FormatInt(id, 10)
+	announcement.SendAt = announcement.SendAt.UTC()
+	return announcement, err
+}
+
+// InsertAnnouncement inserts a new announcement and returns its ID.
+func (c *Client) InsertAnnouncement(announcement models.Announcement) (string, error) {
+	var id int64
+
+	err := c.db.QueryRow(c.rebind(`INSERT INTO announcements (conference_id, text, send_at, status, created_by) VALUES (?, ?, ?, ?, ?) RETURNING id`),
+		announcement.ConferenceID, announcement.Text, announcement.SendAt.UTC(), announcement.Status, announcement.CreatedBy).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// SelectAnnouncement selects an announcement by its ID.
+func (c *Client) SelectAnnouncement(id string) (models.Announcement, error) {
+	announcement, err := scanAnnouncement(c.db.QueryRow(c.rebind(`SELECT `+announcementColumns+` FROM announcements WHERE id = ?`), id))
+	if err != nil {
+		return models.Announcement{}, notFound(err)
+	}
+	return announcement, nil
+}
+
+// SelectAnnouncements selects all announcements with the given status, ordered by their send time.
+func (c *Client) SelectAnnouncements(status string) ([]models.Announcement, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+announcementColumns+` FROM announcements WHERE status = ? ORDER BY send_at`), status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var announcements []models.Announcement
+
+	for rows.Next() {
+		announcement, errS := scanAnnouncement(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		announcements = append(announcements, announcement)
+	}
+
+	return announcements, rows.Err()
+}
+
+// UpdateAnnouncement updates the text and the send time of a pending announcement.
+func (c *Client) UpdateAnnouncement(id string, text string, sendAt time.Time) (bool, error) {
+	return affected(c.exec(`UPDATE announcements SET text = ?, send_at = ? WHERE id = ? AND status = ?`,
+		text, sendAt.UTC(), id, models.AnnouncementPending))
+}
+
+// SetAnnouncementStatus changes the status of an announcement if it currently has the status from.
+// It reports whether the status was changed, so only one caller can claim an announcement.
+func (c *Client) SetAnnouncementStatus(id string, from, to string) (bool, error) {
+	return affected(c.exec(`UPDATE announcements SET status = ? WHERE id = ? AND status = ?`, to, id, from))
+}
+
+// InsertDeadLetter stores an undelivered message.
+func (c *Client) InsertDeadLetter(letter models.DeadLetter) error {
+	_, err := c.exec(`INSERT INTO dead_letters (chat_id, text, error, attempts, created_at) VALUES (?, ?, ?, ?, ?)`,
+		letter.ChatID, letter.Text, letter.Error, letter.Attempts, letter.CreatedAt.UTC())
+	return err
+}
+
+// InsertAbandonedFlow stores an abandoned flow.
+func (c *Client) InsertAbandonedFlow(flow models.AbandonedFlow) error {
+	_, err := c.exec(`INSERT INTO abandoned_flows (tg_id, state, step, entered_at, abandoned_at) VALUES (?, ?, ?, ?, ?)`,
+		flow.TgID, flow.State, flow.Step, flow.EnteredAt.UTC(), flow.AbandonedAt.UTC())
+	return err
+}
+
+// userRoleColumns are the columns of a role in the order scanUserRole reads them.
+const userRoleColumns = "tg_id, role, conference_id, granted_by, granted_at"
+
+// scanUserRole scans a role from the userRoleColumns.
+func scanUserRole(row scanner) (models.UserRole, error) {
+	var role models.UserRole
+	err := row.Scan(&role.TgID, &role.Role, &role.ConferenceID, &role.GrantedBy, &role.GrantedAt)
+	role.GrantedAt = role.GrantedAt.UTC()
+	return role, err
+}
+
+// selectUserRoles selects the roles matching the condition with ? placeholders.
+func (c *Client) selectUserRoles(condition string, args ...interface{}) ([]models.UserRole, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+userRoleColumns+` FROM user_roles WHERE `+condition+` ORDER BY granted_at, tg_id`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.UserRole
+
+	for rows.Next() {
+		role, errS := scanUserRole(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// insertRoleAudit records the change of the role in the audit trail within the transaction.
+func (c *Client) insertRoleAudit(tx *sql.Tx, entry models.RoleAudit) error {
+	_, err := tx.Exec(c.rebind(`INSERT INTO role_audit (tg_id, role, conference_id, action, by_tg_id, at) VALUES (?, ?, ?, ?, ?, ?)`),
+		entry.TgID, entry.Role, entry.ConferenceID, entry.Action, entry.By, entry.At.UTC())
+	return err
+}
+
+// GrantRole grants the role to the user and records it in the audit trail. It reports whether the user didn't have the role yet.
+func (c *Client) GrantRole(role models.UserRole) (bool, error) {
+	var granted bool
+
+	err := c.tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(c.rebind(`INSERT INTO user_roles (`+userRoleColumns+`) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`),
+			role.TgID, role.Role, role.ConferenceID, role.GrantedBy, role.GrantedAt.UTC())
+		if granted, err = affected(res, err); err != nil || !granted {
+			return err
+		}
+		return c.insertRoleAudit(tx, models.RoleAudit{TgID: role.TgID, Role: role.Role, ConferenceID: role.ConferenceID,
+			Action: models.RoleGranted, By: role.GrantedBy, At: role.GrantedAt})
+	})
+
+	return granted, err
+}
+
+// RevokeRole revokes the role of the conference from the user and records it in the audit trail. It reports whether the user had the role.
+func (c *Client) RevokeRole(tgID int, role string, conferenceID string, by int) (bool, error) {
+	var revoked bool
+
+	err := c.tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(c.rebind(`DELETE FROM user_roles WHERE tg_id = ? AND role = ? AND conference_id = ?`), tgID, role, conferenceID)
+		if revoked, err = affected(res, err); err != nil || !revoked {
+			return err
+		}
+		return c.insertRoleAudit(tx, models.RoleAudit{TgID: tgID, Role: role, ConferenceID: conferenceID,
+			Action: models.RoleRevoked, By: by, At: time.Now().UTC()})
+	})
+
+	return revoked, err
+}
+
+// SelectUserRoles selects the roles of the user.
+func (c *Client) SelectUserRoles(tgID int) ([]models.UserRole, error) {
+	return c.selectUserRoles(`tg_id = ?`, tgID)
+}
+
+// SelectRoles selects the owners and the roles granted for the conference.
+func (c *Client) SelectRoles(conferenceID string) ([]models.UserRole, error) {
+	return c.selectUserRoles(`role = ? OR conference_id = ?`, models.RoleOwner, conferenceID)
+}
+
+// SelectRoleAudit selects the latest entries of the audit trail, the newest first.
+func (c *Client) SelectRoleAudit(limit int) ([]models.RoleAudit, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT tg_id, role, conference_id, action, by_tg_id, at FROM role_audit ORDER BY id DESC LIMIT ?`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.RoleAudit
+
+	for rows.Next() {
+		var entry models.RoleAudit
+		if err = rows.Scan(&entry.TgID, &entry.Role, &entry.ConferenceID, &entry.Action, &entry.By, &entry.At); err != nil {
+			return nil, err
+		}
+		entry.At = entry.At.UTC()
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// LinkSpeaker links the user to the report. It reports whether the user wasn't linked to it yet.
+func (c *Client) LinkSpeaker(link models.SpeakerLink) (bool, error) {
+	return affected(c.exec(`INSERT INTO speaker_links (tg_id, url, conference_id, linked_by, linked_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		link.TgID, link.URL, link.ConferenceID, link.LinkedBy, link.LinkedAt.UTC()))
+}
+
+// UnlinkSpeaker unlinks the user from the report of the conference. It reports whether the user was linked to it.
+func (c *Client) UnlinkSpeaker(tgID int, conferenceID, url string) (bool, error) {
+	return affected(c.exec(`DELETE FROM speaker_links WHERE tg_id = ? AND conference_id = ? AND url = ?`, tgID, conferenceID, url))
+}
+
+// SelectSpeakerLinks selects the links of the conference ordered by the time they were made.
+func (c *Client) SelectSpeakerLinks(conferenceID string) ([]models.SpeakerLink, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT tg_id, url, conference_id, linked_by, linked_at FROM speaker_links WHERE conference_id = ? ORDER BY linked_at, tg_id`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []models.SpeakerLink
+
+	for rows.Next() {
+		var link models.SpeakerLink
+		if err = rows.Scan(&link.TgID, &link.URL, &link.ConferenceID, &link.LinkedBy, &link.LinkedAt); err != nil {
+			return nil, err
+		}
+		link.LinkedAt = link.LinkedAt.UTC()
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// questionColumns are the columns of a question in the order scanQuestion reads them.
+const questionColumns = "id, conference_id, url, tg_id, text, votes, answered, asked_at"
+
+// scanQuestion scans a question from the questionColumns.
+func scanQuestion(row scanner) (models.Question, error) {
+	var (
+		question models.Question
+		id       int64
+	)
+	err := row.Scan(&id, &question.ConferenceID, &question.URL, &question.TgID, &question.Text, &question.Votes, &question.Answered, &question.AskedAt)
+	question.ID = strconv.FormatInt(id, 10)
+	question.AskedAt = question.AskedAt.UTC()
+	return question, err
+}
+
+// InsertQuestion inserts a new question and returns its ID.
+func (c *Client) InsertQuestion(question models.Question) (string, error) {
+	var id int64
+
+	err := c.db.QueryRow(c.rebind(`INSERT INTO questions (conference_id, url, tg_id, text, asked_at) VALUES (?, ?, ?, ?, ?) RETURNING id`),
+		question.ConferenceID, question.URL, question.TgID, question.Text, question.AskedAt.UTC()).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// SelectQuestion selects a question by its ID.
+func (c *Client) SelectQuestion(id string) (models.Question, error) {
+	question, err := scanQuestion(c.db.QueryRow(c.rebind(`SELECT `+questionColumns+` FROM questions WHERE id = ?`), id))
+	if err != nil {
+		return models.Question{}, notFound(err)
+	}
+	return question, nil
+}
+
+// SelectQuestions selects the questions of the conference ordered by the time they were asked.
+func (c *Client) SelectQuestions(conferenceID string) ([]models.Question, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+questionColumns+` FROM questions WHERE conference_id = ? ORDER BY asked_at, id`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []models.Question
+
+	for rows.Next() {
+		question, errS := scanQuestion(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		questions = append(questions, question)
+	}
+
+	return questions, rows.Err()
+}
+
+// UpvoteQuestion records the vote of the user and increments the votes of the question. It reports whether the user hadn't voted for it yet.
+func (c *Client) UpvoteQuestion(id string, tgID int) (bool, error) {
+	var upvoted bool
+
+	err := c.tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(c.rebind(`INSERT INTO question_votes (question_id, tg_id) VALUES (?, ?) ON CONFLICT DO NOTHING`), id, tgID)
+		if upvoted, err = affected(res, err); err != nil || !upvoted {
+			return err
+		}
+		upvoted, err = affected(tx.Exec(c.rebind(`UPDATE questions SET votes = votes + 1 WHERE id = ?`), id))
+		return err
+	})
+
+	return upvoted, err
+}
+
+// SetQuestionAnswered marks the question as answered. It reports whether it wasn't answered yet.
+func (c *Client) SetQuestionAnswered(id string) (bool, error) {
+	return affected(c.exec(`UPDATE questions SET answered = TRUE WHERE id = ? AND answered = FALSE`, id))
+}
+
+// pollColumns are the columns of a poll in the order scanPoll reads them.
+const pollColumns = "id, conference_id, url, question, options, closed, created_by, results_message_id, created_at"
+
+// scanPoll scans a poll from the pollColumns. The options are stored one per line, the counts are filled by countPollVotes.
+func scanPoll(row scanner) (models.Poll, error) {
+	var (
+		poll    models.Poll
+		id      int64
+		options string
+	)
+	err := row.Scan(&id, &poll.ConferenceID, &poll.URL, &poll.Question, &options, &poll.Closed, &poll.CreatedBy, &poll.ResultsMessageID, &poll.CreatedAt)
+	poll.ID = strconv.FormatInt(id, 10)
+	poll.Options = strings.Split(options, "\n")
+	poll.Counts = make([]int, len(poll.Options))
+	poll.CreatedAt = poll.CreatedAt.UTC()
+	return poll, err
+}
+
+// countPollVotes fills the counts of the polls from the votes matching the condition with ? placeholders.
+func (c *Client) countPollVotes(polls []models.Poll, condition string, args ...interface{}) error {
+	byID := make(map[string]*models.Poll, len(polls))
+	for i := range polls {
+		byID[polls[i].ID] = &polls[i]
+	}
+
+	rows, err := c.db.Query(c.rebind(`SELECT v.poll_id, v.option, COUNT(*) FROM poll_votes v JOIN polls p ON p.id = v.poll_id WHERE `+condition+` GROUP BY v.poll_id, v.option`), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var option, count int
+		if err = rows.Scan(&id, &option, &count); err != nil {
+			return err
+		}
+		if poll, exists := byID[strconv.FormatInt(id, 10)]; exists && option < len(poll.Counts) {
+			poll.Counts[option] = count
+		}
+	}
+
+	return rows.Err()
+}
+
+// InsertPoll inserts a new poll and returns its ID.
+func (c *Client) InsertPoll(poll models.Poll) (string, error) {
+	var id int64
+
+	err := c.db.QueryRow(c.rebind(`INSERT INTO polls (conference_id, url, question, options, created_by, results_message_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		poll.ConferenceID, poll.URL, poll.Question, strings.Join(poll.Options, "\n"), poll.CreatedBy, poll.ResultsMessageID, poll.CreatedAt.UTC()).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// SelectPoll selects a poll by its ID with the counts of its votes.
+func (c *Client) SelectPoll(id string) (models.Poll, error) {
+	poll, err := scanPoll(c.db.QueryRow(c.rebind(`SELECT `+pollColumns+` FROM polls WHERE id = ?`), id))
+	if err != nil {
+		return models.Poll{}, notFound(err)
+	}
+
+	polls := []models.Poll{poll}
+	if err = c.countPollVotes(polls, `p.id = ?`, id); err != nil {
+		return models.Poll{}, err
+	}
+
+	return polls[0], nil
+}
+
+// SelectPolls selects the polls of the conference with the counts of their votes ordered by the time they were launched.
+func (c *Client) SelectPolls(conferenceID string) ([]models.Poll, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+pollColumns+` FROM polls WHERE conference_id = ? ORDER BY created_at, id`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []models.Poll
+
+	for rows.Next() {
+		poll, errS := scanPoll(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		polls = append(polls, poll)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return polls, c.countPollVotes(polls, `p.conference_id = ?`, conferenceID)
+}
+
+// VotePoll records the vote of the user for the option of an open poll. It reports whether the vote counted.
+func (c *Client) VotePoll(id string, tgID int, option int) (bool, error) {
+	var voted bool
+
+	err := c.tx(func(tx *sql.Tx) error {
+		var options string
+		var closed bool
+
+		err := tx.QueryRow(c.rebind(`SELECT options, closed FROM polls WHERE id = ?`), id).Scan(&options, &closed)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil || closed || option < 0 || option >= len(strings.Split(options, "\n")) {
+			return err
+		}
+
+		voted, err = affected(tx.Exec(c.rebind(`INSERT INTO poll_votes (poll_id, tg_id, option) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`), id, tgID, option))
+		return err
+	})
+
+	return voted, err
+}
+
+// ClosePoll closes the poll. It reports whether it was open.
+func (c *Client) ClosePoll(id string) (bool, error) {
+	return affected(c.exec(`UPDATE polls SET closed = TRUE WHERE id = ? AND closed = FALSE`, id))
+}
+
+// AddReportView records that the user opened the card of the report of the conference, repeated views are recorded once.
+func (c *Client) AddReportView(tgID int, conferenceID, url string) error {
+	_, err := c.exec(`INSERT INTO report_views (tg_id, conference_id, url, viewed_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		tgID, conferenceID, url, time.Now().UTC())
+	return err
+}
+
+// SelectReportViewers selects the Telegram IDs of the users who opened the card of the report of the conference in the order they opened it.
+func (c *Client) SelectReportViewers(conferenceID, url string) ([]int, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT tg_id FROM report_views WHERE conference_id = ? AND url = ? ORDER BY viewed_at, tg_id`), conferenceID, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var viewers []int
+
+	for rows.Next() {
+		var tgID int
+		if err = rows.Scan(&tgID); err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, tgID)
+	}
+
+	return viewers, rows.Err()
+}
+
+// SelectConferenceViewers selects the Telegram IDs of the users who opened the card of any report of the conference.
+func (c *Client) SelectConferenceViewers(conferenceID string) ([]int, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT DISTINCT tg_id FROM report_views WHERE conference_id = ? ORDER BY tg_id`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var viewers []int
+
+	for rows.Next() {
+		var tgID int
+		if err = rows.Scan(&tgID); err != nil {
+			return nil, err
+		}
+		viewers = append(viewers, tgID)
+	}
+
+	return viewers, rows.Err()
+}
+
+// SaveQuestionnaire inserts the questionnaire or replaces the one of the same conference and track.
+func (c *Client) SaveQuestionnaire(questionnaire models.Questionnaire) error {
+	items, err := json.Marshal(questionnaire.Items)
+	if err != nil {
+		return err
+	}
+	_, err = c.exec(`INSERT INTO questionnaires (conference_id, track, items, updated_by, updated_at) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (conference_id, track) DO UPDATE SET items = excluded.items, updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+		questionnaire.ConferenceID, questionnaire.Track, string(items), questionnaire.UpdatedBy, questionnaire.UpdatedAt)
+	return err
+}
+
+// SelectQuestionnaires returns the questionnaires of the conference ordered by their tracks.
+func (c *Client) SelectQuestionnaires(conferenceID string) ([]models.Questionnaire, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT conference_id, track, items, updated_by, updated_at FROM questionnaires WHERE conference_id = ? ORDER BY track`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questionnaires []models.Questionnaire
+
+	for rows.Next() {
+		var (
+			questionnaire models.Questionnaire
+			items         string
+		)
+		if err = rows.Scan(&questionnaire.ConferenceID, &questionnaire.Track, &items, &questionnaire.UpdatedBy, &questionnaire.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(items), &questionnaire.Items); err != nil {
+			return nil, err
+		}
+		questionnaire.UpdatedAt = questionnaire.UpdatedAt.UTC()
+		questionnaires = append(questionnaires, questionnaire)
+	}
+
+	return questionnaires, rows.Err()
+}
+
+// DeleteQuestionnaire deletes the questionnaire of the conference and track. It reports whether it existed.
+func (c *Client) DeleteQuestionnaire(conferenceID string, track string) (bool, error) {
+	return affected(c.exec(`DELETE FROM questionnaires WHERE conference_id = ? AND track = ?`, conferenceID, track))
+}
+
+// surveyColumns are the columns of a survey in the order scanSurvey reads them.
+const surveyColumns = "conference_id, tg_id, nps, venue, catering, organization, comment, answered_at"
+
+// scanSurvey scans a survey from the surveyColumns.
+func scanSurvey(row scanner) (models.Survey, error) {
+	var survey models.Survey
+	err := row.Scan(&survey.ConferenceID, &survey.TgID, &survey.NPS, &survey.Venue, &survey.Catering, &survey.Organization,
+		&survey.Comment, &survey.AnsweredAt)
+	survey.AnsweredAt = survey.AnsweredAt.UTC()
+	return survey, err
+}
+
+// InsertSurvey inserts the answers of the user. It reports whether the user hadn't answered the survey of the conference yet.
+func (c *Client) InsertSurvey(survey models.Survey) (bool, error) {
+	return affected(c.exec(`INSERT INTO surveys (`+surveyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		survey.ConferenceID, survey.TgID, survey.NPS, survey.Venue, survey.Catering, survey.Organization, survey.Comment, survey.AnsweredAt))
+}
+
+// SelectSurvey selects the answers of the user to the survey of the conference and reports whether they exist.
+func (c *Client) SelectSurvey(tgID int, conferenceID string) (bool, models.Survey, error) {
+	survey, err := scanSurvey(c.db.QueryRow(c.rebind(`SELECT `+surveyColumns+` FROM surveys WHERE tg_id = ? AND conference_id = ?`), tgID, conferenceID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, models.Survey{}, nil
+		}
+		return false, models.Survey{}, err
+	}
+	return true, survey, nil
+}
+
+// SelectSurveys selects the answers to the survey of the conference in the order they were given.
+func (c *Client) SelectSurveys(conferenceID string) ([]models.Survey, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT `+surveyColumns+` FROM surveys WHERE conference_id = ? ORDER BY answered_at, tg_id`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var surveys []models.Survey
+
+	for rows.Next() {
+		survey, errS := scanSurvey(rows)
+		if errS != nil {
+			return nil, errS
+		}
+		surveys = append(surveys, survey)
+	}
+
+	return surveys, rows.Err()
+}
+
+// MarkSurveyInvited records that the user was invited to the survey of the conference at invitedAt.
+// It reports whether the user hadn't been invited yet.
+func (c *Client) MarkSurveyInvited(tgID int, conferenceID string, invitedAt time.Time) (bool, error) {
+	return affected(c.exec(`INSERT INTO survey_invites (conference_id, tg_id, invited_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+		conferenceID, tgID, invitedAt.UTC()))
+}
+
+// SelectSurveyInvites selects the Telegram IDs of the users invited to the survey of the conference.
+func (c *Client) SelectSurveyInvites(conferenceID string) ([]int, error) {
+	rows, err := c.db.Query(c.rebind(`SELECT tg_id FROM survey_invites WHERE conference_id = ?`), conferenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invited []int
+
+	for rows.Next() {
+		var tgID int
+		if err = rows.Scan(&tgID); err != nil {
+			return nil, err
+		}
+		invited = append(invited, tgID)
+	}
+
+	return invited, rows.Err()
+}
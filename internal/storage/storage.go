@@ -0,0 +1,249 @@
+// Package storage defines the repositories of the bot data regardless of the database behind them.
+package storage
+
+import (
+	"errors"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Repository is the set of all repositories of the bot data.
+type Repository interface {
+	ConferenceRepo
+	ReportRepo
+	UserRepo
+	EvaluationRepo
+	AnnouncementRepo
+	DeadLetterRepo
+	AbandonedFlowRepo
+	RoleRepo
+	SpeakerRepo
+	QuestionRepo
+	PollRepo
+	ReportViewRepo
+	QuestionnaireRepo
+	SurveyRepo
+}
+
+// ConferenceRepo is an interface that defines methods for manipulating conference data.
+type ConferenceRepo interface {
+	// SaveConference inserts the conference or replaces the one with the same ID.
+	SaveConference(conference models.Conference) error
+	SelectConference(id string) (models.Conference, error)
+	// SelectConferences returns all conferences ordered by their start time.
+	SelectConferences() ([]models.Conference, error)
+}
+
+// ReportRepo is an interface that defines methods for manipulating report data.
+type ReportRepo interface {
+	// UpdateReports replaces the schedule of the conference with the given reports.
+	// It returns the changes of the previously scheduled reports: moved, retitled and cancelled ones.
+	UpdateReports(conferenceID string, reports []models.Report) ([]models.ReportChange, error)
+	// SelectReport returns the report of the conference with the URL. A URL is unique only within its conference.
+	SelectReport(conferenceID, url string) (models.Report, error)
+	// SelectReports returns the reports of the conference or of all conferences if conferenceID is empty.
+	SelectReports(conferenceID string) ([]models.Report, error)
+}
+
+// UserRepo is an interface that defines methods for manipulating user data.
+type UserRepo interface {
+	// InsertUser inserts a new user, an existing user with the same Telegram ID is left untouched.
+	InsertUser(user models.User) error
+	SelectUser(tgID int) (models.User, error)
+	SelectUsers() ([]models.User, error)
+	UpdateUserID(tgID int, identification string) (bool, error)
+	// SelectUserConference returns the conference the user picked without resolving their favorites,
+	// models.DefaultConferenceID if they haven't picked one.
+	SelectUserConference(tgID int) (string, error)
+	// SetUserConference sets the conference the user picked.
+	SetUserConference(tgID int, conferenceID string) error
+	// AddUserFavReport adds the report of the conference to the favorites of the user if it isn't there yet.
+	AddUserFavReport(tgID int, conferenceID, reportURL string) error
+	RemoveUserFavReport(tgID int, conferenceID, reportURL string) error
+	RemoveFavReportFromAll(conferenceID, reportURL string) error
+}
+
+// EvaluationRepo is an interface that defines methods for manipulating evaluation data.
+type EvaluationRepo interface {
+	// InsertEvaluation inserts a new evaluation, an existing evaluation of the report by the user is left untouched.
+	InsertEvaluation(evaluation models.Evaluation) error
+	SelectEvaluation(tgID int, conferenceID, url string) (bool, models.Evaluation, error)
+	// SelectEvaluations returns the evaluations of the reports of the conference made by the user.
+	SelectEvaluations(tgID int, conferenceID string) ([]models.Evaluation, error)
+	// SelectAllEvaluations returns the evaluations of the reports of the conference made by all users.
+	SelectAllEvaluations(conferenceID string) ([]models.Evaluation, error)
+	// UpdateEvaluation updates the marks, the comment and the answers of an evaluation. It reports whether anything changed.
+	UpdateEvaluation(tgID int, conferenceID, url string, evaluation models.Evaluation) (bool, error)
+	DeleteEvaluation(tgID int, conferenceID, url string) (bool, error)
+}
+
+// AnnouncementRepo is an interface that defines methods for manipulating scheduled announcements.
+type AnnouncementRepo interface {
+	// InsertAnnouncement inserts a new announcement and returns its ID.
+	InsertAnnouncement(announcement models.Announcement) (string, error)
+	SelectAnnouncement(id string) (models.Announcement, error)
+	// SelectAnnouncements returns the announcements with the status ordered by their send time.
+	SelectAnnouncements(status string) ([]models.Announcement, error)
+	// UpdateAnnouncement updates the text and the send time of a pending announcement. It reports whether it was pending.
+	UpdateAnnouncement(id string, text string, sendAt time.Time) (bool, error)
+	// SetAnnouncementStatus changes the status of an announcement if it currently has the status from.
+	// It reports whether the status was changed, so only one caller can claim an announcement.
+	SetAnnouncementStatus(id string, from, to string) (bool, error)
+}
+
+// DeadLetterRepo is an interface that defines methods for storing undelivered messages.
+type DeadLetterRepo interface {
+	InsertDeadLetter(letter models.DeadLetter) error
+}
+
+// AbandonedFlowRepo is an interface that defines methods for storing abandoned flows.
+type AbandonedFlowRepo interface {
+	InsertAbandonedFlow(flow models.AbandonedFlow) error
+}
+
+// RoleRepo is an interface that defines methods for manipulating the roles of the users and their audit trail.
+// Every grant and revoke is recorded in the audit trail.
+type RoleRepo interface {
+	// GrantRole grants the role to the user. It reports whether the user didn't have the role yet.
+	GrantRole(role models.UserRole) (bool, error)
+	// RevokeRole revokes the role of the conference from the user. It reports whether the user had the role.
+	RevokeRole(tgID int, role string, conferenceID string, by int) (bool, error)
+	// SelectUserRoles returns the roles of the user.
+	SelectUserRoles(tgID int) ([]models.UserRole, error)
+	// SelectRoles returns the owners and the roles granted for the conference ordered by the time they were granted.
+	SelectRoles(conferenceID string) ([]models.UserRole, error)
+	// SelectRoleAudit returns the latest entries of the audit trail, the newest first.
+	SelectRoleAudit(limit int) ([]models.RoleAudit, error)
+}
+
+// SpeakerRepo is an interface that defines methods for manipulating the links of the speakers to their reports.
+type SpeakerRepo interface {
+	// LinkSpeaker links the user to the report. It reports whether the user wasn't linked to it yet.
+	LinkSpeaker(link models.SpeakerLink) (bool, error)
+	// UnlinkSpeaker unlinks the user from the report of the conference. It reports whether the user was linked to it.
+	UnlinkSpeaker(tgID int, conferenceID, url string) (bool, error)
+	// SelectSpeakerLinks returns the links of the conference ordered by the time they were made.
+	SelectSpeakerLinks(conferenceID string) ([]models.SpeakerLink, error)
+}
+
+// QuestionRepo is an interface that defines methods for manipulating the questions of the audience to the speakers.
+type QuestionRepo interface {
+	// InsertQuestion inserts a new question and returns its ID.
+	InsertQuestion(question models.Question) (string, error)
+	SelectQuestion(id string) (models.Question, error)
+	// SelectQuestions returns the questions of the conference ordered by the time they were asked.
+	SelectQuestions(conferenceID string) ([]models.Question, error)
+	// UpvoteQuestion adds the vote of the user to the question. It reports whether the user hadn't voted for it yet.
+	UpvoteQuestion(id string, tgID int) (bool, error)
+	// SetQuestionAnswered marks the question as answered. It reports whether it wasn't answered yet.
+	SetQuestionAnswered(id string) (bool, error)
+}
+
+// PollRepo is an interface that defines methods for manipulating the live polls of the reports.
+type PollRepo interface {
+	// InsertPoll inserts a new poll and returns its ID.
+	InsertPoll(poll models.Poll) (string, error)
+	SelectPoll(id string) (models.Poll, error)
+	// SelectPolls returns the polls of the conference ordered by the time they were launched.
+	SelectPolls(conferenceID string) ([]models.Poll, error)
+	// VotePoll adds the vote of the user for the option of an open poll.
+	// It reports whether the vote counted: a user votes only once and only for an existing option.
+	VotePoll(id string, tgID int, option int) (bool, error)
+	// ClosePoll closes the poll. It reports whether it was open.
+	ClosePoll(id string) (bool, error)
+}
+
+// ReportViewRepo is an interface that defines methods for recording the users who opened the card of a report.
+type ReportViewRepo interface {
+	// AddReportView records that the user opened the card of the report of the conference, repeated views are recorded once.
+	AddReportView(tgID int, conferenceID, url string) error
+	// SelectReportViewers returns the Telegram IDs of the users who opened the card of the report of the conference.
+	SelectReportViewers(conferenceID, url string) ([]int, error)
+	// SelectConferenceViewers returns the Telegram IDs of the users who opened the card of any report of the conference.
+	SelectConferenceViewers(conferenceID string) ([]int, error)
+}
+
+// QuestionnaireRepo is an interface that defines methods for manipulating the review questionnaires.
+type QuestionnaireRepo interface {
+	// SaveQuestionnaire inserts the questionnaire or replaces the one of the same conference and track.
+	SaveQuestionnaire(questionnaire models.Questionnaire) error
+	// SelectQuestionnaires returns the questionnaires of the conference ordered by their tracks.
+	SelectQuestionnaires(conferenceID string) ([]models.Questionnaire, error)
+	// DeleteQuestionnaire deletes the questionnaire of the conference and track. It reports whether it existed.
+	DeleteQuestionnaire(conferenceID string, track string) (bool, error)
+}
+
+// SurveyRepo is an interface that defines methods for manipulating the answers to the conference surveys.
+type SurveyRepo interface {
+	// InsertSurvey inserts the answers of the user. It reports whether the user hadn't answered the survey of the conference yet.
+	InsertSurvey(survey models.Survey) (bool, error)
+	// SelectSurvey returns the answers of the user to the survey of the conference and reports whether they exist.
+	SelectSurvey(tgID int, conferenceID string) (bool, models.Survey, error)
+	// SelectSurveys returns the answers to the survey of the conference ordered by the time they were given.
+	SelectSurveys(conferenceID string) ([]models.Survey, error)
+	// MarkSurveyInvited records that the user was invited to the survey of the conference at invitedAt.
+	// It reports whether the user hadn't been invited yet.
+	MarkSurveyInvited(tgID int, conferenceID string, invitedAt time.Time) (bool, error)
+	// SelectSurveyInvites returns the Telegram IDs of the users invited to the survey of the conference.
+	SelectSurveyInvites(conferenceID string) ([]int, error)
+}
+
+// ResolveFavorites fills the favorite reports of the users from their references.
+// References to reports missing from the schedule are skipped.
+func ResolveFavorites(users []models.User, reports []models.Report) {
+	byRef := make(map[models.ReportRef]models.Report, len(reports))
+	for _, report := range reports {
+		byRef[report.Ref()] = report
+	}
+
+	for i := range users {
+		users[i].FavoriteReports = make([]models.Report, 0, len(users[i].Favorites))
+		for _, ref := range users[i].Favorites {
+			if report, exists := byRef[ref]; exists {
+				users[i].FavoriteReports = append(users[i].FavoriteReports, report)
+			}
+		}
+	}
+}
+
+// DiffReports returns the changes of the existing reports when the schedule is replaced with the given reports.
+func DiffReports(existing, reports []models.Report) []models.ReportChange {
+	previous := make(map[string]models.Report, len(existing))
+	for _, report := range existing {
+		previous[report.URL] = report
+	}
+
+	var changes []models.ReportChange
+
+	for _, report := range reports {
+		old, exists := previous[report.URL]
+		if !exists {
+			continue
+		}
+
+		change := models.ReportChange{
+			Previous:     old,
+			Current:      report,
+			TimeMoved:    !old.StartTime.Equal(report.StartTime) || old.Duration != report.Duration,
+			TitleChanged: old.Title != report.Title,
+		}
+		if change.TimeMoved || change.TitleChanged {
+			changes = append(changes, change)
+		}
+
+		delete(previous, report.URL)
+	}
+
+	if len(reports) != 0 {
+		for _, report := range existing {
+			if _, cancelled := previous[report.URL]; cancelled {
+				changes = append(changes, models.ReportChange{Previous: report, Cancelled: true})
+			}
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,145 @@
+package storage_test
+
+import (
+	"github.com/NOSTRADA88/telegram-bot-go/internal/models"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage"
+	"github.com/NOSTRADA88/telegram-bot-go/internal/storage/memory"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, time.May, 16, 10, 0, 0, 0, time.UTC)
+
+func report(conferenceID, url, title string, startTime time.Time, duration int) models.Report {
+	return models.Report{ConferenceID: conferenceID, URL: url, Title: title, StartTime: startTime, Duration: duration}
+}
+
+func TestDiffReports(t *testing.T) {
+	keynote := report("c1", "https://conf/keynote", "Keynote", start, 60)
+	golang := report("c1", "https://conf/go", "Go", start.Add(time.Hour), 45)
+
+	tests := []struct {
+		name     string
+		existing []models.Report
+		reports  []models.Report
+		want     []models.ReportChange
+	}{
+		{
+			name:    "first upload",
+			reports: []models.Report{keynote, golang},
+		},
+		{
+			name:     "unchanged schedule",
+			existing: []models.Report{keynote, golang},
+			reports:  []models.Report{keynote, golang},
+		},
+		{
+			name:     "new report",
+			existing: []models.Report{keynote},
+			reports:  []models.Report{keynote, golang},
+		},
+		{
+			name:     "moved start",
+			existing: []models.Report{keynote},
+			reports:  []models.Report{report("c1", keynote.URL, "Keynote", start.Add(30*time.Minute), 60)},
+			want: []models.ReportChange{{Previous: keynote,
+				Current: report("c1", keynote.URL, "Keynote", start.Add(30*time.Minute), 60), TimeMoved: true}},
+		},
+		{
+			name:     "changed duration",
+			existing: []models.Report{keynote},
+			reports:  []models.Report{report("c1", keynote.URL, "Keynote", start, 90)},
+			want:     []models.ReportChange{{Previous: keynote, Current: report("c1", keynote.URL, "Keynote", start, 90), TimeMoved: true}},
+		},
+		{
+			name:     "renamed",
+			existing: []models.Report{keynote},
+			reports:  []models.Report{report("c1", keynote.URL, "Opening", start, 60)},
+			want:     []models.ReportChange{{Previous: keynote, Current: report("c1", keynote.URL, "Opening", start, 60), TitleChanged: true}},
+		},
+		{
+			name:     "cancelled",
+			existing: []models.Report{keynote, golang},
+			reports:  []models.Report{keynote},
+			want:     []models.ReportChange{{Previous: golang, Cancelled: true}},
+		},
+		{
+			name:     "empty upload cancels nothing",
+			existing: []models.Report{keynote, golang},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storage.DiffReports(tt.existing, tt.reports); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffReports() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFavorites(t *testing.T) {
+	repo := memory.NewRepository()
+
+	first := report("c1", "https://conf/talk", "First", start, 30)
+	second := report("c2", "https://conf/talk", "Second", start, 30)
+	other := report("c1", "https://conf/other", "Other", start.Add(time.Hour), 30)
+
+	if _, err := repo.UpdateReports("c1", []models.Report{first, other}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.UpdateReports("c2", []models.Report{second}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		favorites []models.ReportRef
+		want      []models.Report
+	}{
+		{
+			name: "no favorites",
+			want: []models.Report{},
+		},
+		{
+			name:      "same URL in another conference",
+			favorites: []models.ReportRef{second.Ref()},
+			want:      []models.Report{second},
+		},
+		{
+			name:      "order of adding",
+			favorites: []models.ReportRef{other.Ref(), first.Ref()},
+			want:      []models.Report{other, first},
+		},
+		{
+			name:      "missing report is skipped",
+			favorites: []models.ReportRef{{ConferenceID: "c2", URL: other.URL}, first.Ref()},
+			want:      []models.Report{first},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tgID := i + 1
+
+			if err := repo.InsertUser(models.User{TgID: tgID, ChatID: tgID}); err != nil {
+				t.Fatal(err)
+			}
+			for _, ref := range tt.favorites {
+				if err := repo.AddUserFavReport(tgID, ref.ConferenceID, ref.URL); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			user, err := repo.SelectUser(tgID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(user.FavoriteReports, tt.want) {
+				t.Errorf("FavoriteReports = %+v, want %+v", user.FavoriteReports, tt.want)
+			}
+		})
+	}
+}